@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(
+		CatalogCommand(),
+	)
+}
+
+// catalogOptions configures where the mapper loads the catalog from
+type catalogOptions struct {
+	File     string
+	CacheDir string
+	CacheTTL time.Duration
+}
+
+// addFlags adds the catalog flags to the command. A snapshot isn't cached, so
+// --catalog and --catalog-cache-dir can't be used together.
+func (o *catalogOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.File, "catalog", "", "Load the catalog from a snapshot written by 'image-mapper catalog export', rather than querying the catalog endpoint.")
+	cmd.Flags().StringVar(&o.CacheDir, "catalog-cache-dir", "", "Cache the catalog in this directory between invocations.")
+	cmd.Flags().DurationVar(&o.CacheTTL, "catalog-cache-ttl", 24*time.Hour, "How long a cached catalog is used before it's refreshed.")
+	cmd.MarkFlagsMutuallyExclusive("catalog", "catalog-cache-dir")
+}
+
+// option returns the mapper option that configures the catalog source
+func (o *catalogOptions) option() mapper.Option {
+	return mapper.WithCatalogSource(o.source())
+}
+
+// source returns the configured catalog source
+func (o *catalogOptions) source() mapper.CatalogSource {
+	switch {
+	case o.File != "":
+		return mapper.NewFileCatalogSource(o.File)
+	case o.CacheDir != "":
+		return mapper.NewCacheCatalogSource(o.CacheDir, o.CacheTTL, mapper.NewLiveCatalogSource())
+	default:
+		return mapper.NewLiveCatalogSource()
+	}
+}
+
+func CatalogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Export and compare snapshots of the Chainguard catalog.",
+	}
+
+	cmd.AddCommand(
+		CatalogExportCommand(),
+		CatalogDiffCommand(),
+	)
+
+	return cmd
+}
+
+func CatalogExportCommand() *cobra.Command {
+	opts := struct {
+		InactiveTags bool
+	}{}
+	cmd := &cobra.Command{
+		Use:   "export [file]",
+		Short: "Write a snapshot of the catalog that can be used offline with --catalog.",
+		Example: `
+  # Export the catalog to a file
+  image-mapper catalog export catalog.json
+
+  # Include inactive tags, which are used when mapping Helm charts
+  image-mapper catalog export catalog.json --inactive-tags
+
+  # Map images without querying the catalog endpoint
+  image-mapper map nginx:1.25 --catalog=catalog.json
+`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			catalog, err := mapper.NewLiveCatalogSource().Load(cmd.Context(), opts.InactiveTags)
+			if err != nil {
+				return fmt.Errorf("loading catalog: %w", err)
+			}
+
+			if len(args) == 0 || args[0] == "-" {
+				if err := mapper.WriteCatalog(os.Stdout, catalog); err != nil {
+					return fmt.Errorf("writing catalog: %w", err)
+				}
+
+				return nil
+			}
+
+			f, err := os.Create(args[0])
+			if err != nil {
+				return fmt.Errorf("creating file: %s: %w", args[0], err)
+			}
+			if err := mapper.WriteCatalog(f, catalog); err != nil {
+				f.Close()
+				return fmt.Errorf("writing catalog: %w", err)
+			}
+
+			// The snapshot may not be written until the file is
+			// closed, so a failure to close it is a failure to write it
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("writing catalog: %s: %w", args[0], err)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.InactiveTags, "inactive-tags", false, "Include inactive tags in the snapshot.")
+
+	return cmd
+}
+
+func CatalogDiffCommand() *cobra.Command {
+	opts := struct {
+		OutputFormat string
+	}{}
+	cmd := &cobra.Command{
+		Use:   "diff <old> <new>",
+		Short: "Compare two catalog snapshots.",
+		Example: `
+  # Show what changed between two snapshots
+  image-mapper catalog diff catalog-old.json catalog-new.json
+`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			before, err := readCatalogFile(args[0])
+			if err != nil {
+				return err
+			}
+			after, err := readCatalogFile(args[1])
+			if err != nil {
+				return err
+			}
+
+			diff := mapper.DiffCatalogs(before, after)
+
+			switch strings.ToLower(opts.OutputFormat) {
+			case "json":
+				return json.NewEncoder(os.Stdout).Encode(diff)
+			case "text":
+				return writeCatalogDiff(os.Stdout, diff)
+			default:
+				return fmt.Errorf("unsupported output format: %s (supported: json, text)", opts.OutputFormat)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (json, text)")
+
+	return cmd
+}
+
+// readCatalogFile reads a catalog snapshot from disk
+func readCatalogFile(path string) (*mapper.Catalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening catalog: %w", err)
+	}
+	defer f.Close()
+
+	catalog, err := mapper.ReadCatalog(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading catalog: %s: %w", path, err)
+	}
+
+	return catalog, nil
+}
+
+// writeCatalogDiff writes a human readable catalog diff
+func writeCatalogDiff(w io.Writer, diff *mapper.CatalogDiff) error {
+	for _, name := range diff.Added {
+		fmt.Fprintf(w, "+ %s\n", name)
+	}
+	for _, name := range diff.Removed {
+		fmt.Fprintf(w, "- %s\n", name)
+	}
+	for _, repo := range diff.Changed {
+		fmt.Fprintf(w, "~ %s\n", repo.Name)
+		if repo.OldCatalogTier != repo.NewCatalogTier {
+			fmt.Fprintf(w, "    tier: %s -> %s\n", repo.OldCatalogTier, repo.NewCatalogTier)
+		}
+		if changes := formatChanges(repo.AddedAliases, repo.RemovedAliases); changes != "" {
+			fmt.Fprintf(w, "    aliases: %s\n", changes)
+		}
+		if changes := formatChanges(repo.AddedTags, repo.RemovedTags); changes != "" {
+			fmt.Fprintf(w, "    tags: %s\n", changes)
+		}
+	}
+
+	return nil
+}
+
+// formatChanges formats added and removed values like: +foo +bar -baz
+func formatChanges(added, removed []string) string {
+	var changes []string
+	for _, a := range added {
+		changes = append(changes, "+"+a)
+	}
+	for _, r := range removed {
+		changes = append(changes, "-"+r)
+	}
+
+	return strings.Join(changes, " ")
+}
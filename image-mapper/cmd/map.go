@@ -19,7 +19,13 @@ func MapCommand() *cobra.Command {
 		OutputFormat     string
 		IgnoreTiers      []string
 		IgnoreIamguarded bool
-		Repo             string
+		Mapper           mapperOptions
+		Catalog          catalogOptions
+		Tags             tagOptions
+		Explain          bool
+		PreferFIPS       bool
+		PreferTiers      []string
+		Workers          int
 	}{}
 	cmd := &cobra.Command{
 		Use:   "map",
@@ -38,7 +44,22 @@ func MapCommand() *cobra.Command {
 			if opts.IgnoreIamguarded {
 				ignoreFns = append(ignoreFns, mapper.IgnoreIamguarded())
 			}
-			m, err := mapper.NewMapper(cmd.Context(), mapper.WithRepository(opts.Repo), mapper.WithIgnoreFns(ignoreFns...))
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts,
+				mapper.WithIgnoreFns(ignoreFns...),
+				mapper.WithExplain(opts.Explain),
+				mapper.WithScorePolicy(mapper.ScorePolicy{
+					PreferFIPS:  opts.PreferFIPS,
+					PreferTiers: opts.PreferTiers,
+				}),
+				opts.Catalog.option(),
+			)
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			m, err := mapper.NewMapper(cmd.Context(), mapperOpts...)
 			if err != nil {
 				return fmt.Errorf("creating mapper: %w", err)
 			}
@@ -48,7 +69,7 @@ func MapCommand() *cobra.Command {
 				it = mapper.NewReaderIterator(os.Stdin)
 			}
 
-			mappings, err := m.MapAll(it)
+			mappings, err := mapper.MapAll(m, it, opts.Workers)
 			if err != nil {
 				return fmt.Errorf("mapping images: %w", err)
 			}
@@ -57,15 +78,27 @@ func MapCommand() *cobra.Command {
 		},
 	}
 
-	rootCmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (csv, json, text, customer-yaml)")
-	rootCmd.Flags().StringSliceVar(&opts.IgnoreTiers, "ignore-tiers", []string{}, "Ignore Chainguard repos of specific tiers (PREMIUM, APPLICATION, BASE, FIPS, AI)")
-	rootCmd.Flags().BoolVar(&opts.IgnoreIamguarded, "ignore-iamguarded", false, "Ignore iamguarded images")
-	rootCmd.Flags().StringVar(&opts.Repo, "repository", "cgr.dev/chainguard", "Modifies the repository URI in the mappings. For instance, registry.internal.dev/chainguard would result in registry.internal.dev/chainguard/<image> in the output.")
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (csv, customer-yaml, html, json, markdown, text, tsv)")
+	cmd.Flags().StringSliceVar(&opts.IgnoreTiers, "ignore-tiers", []string{}, "Ignore Chainguard repos of specific tiers (PREMIUM, APPLICATION, BASE, FIPS, AI)")
+	cmd.Flags().BoolVar(&opts.IgnoreIamguarded, "ignore-iamguarded", false, "Ignore iamguarded images")
+	opts.Mapper.addFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.PreferFIPS, "prefer-fips", false, "Rank FIPS images above their non-FIPS equivalents")
+	cmd.Flags().StringSliceVar(&opts.PreferTiers, "prefer-tiers", []string{}, "Rank Chainguard repos in these tiers above others, in order of preference (PREMIUM, APPLICATION, BASE, FIPS, AI)")
+	cmd.Flags().BoolVar(&opts.Explain, "explain", false, "Explain which matchers and filters produced (or dropped) each result")
+	cmd.Flags().IntVar(&opts.Workers, "workers", 0, "The number of images to map concurrently. Defaults to the number of CPUs.")
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
 
 	cmd.AddCommand(
 		MapDockerfileCommand(),
 		MapHelmChartCommand(),
 		MapHelmValuesCommand(),
+		MapK8sCommand(),
+		MapKustomizeCommand(),
+		MapComposeCommand(),
+		MapHelmfileCommand(),
+		MapArgoCDAppCommand(),
+		MapClusterCommand(),
 	)
 
 	return cmd
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func MapClusterCommand() *cobra.Command {
+	opts := struct {
+		OutputFormat  string
+		Kubeconfig    string
+		Context       string
+		Namespaces    []string
+		AllNamespaces bool
+		Selector      string
+		Mapper        mapperOptions
+		Workers       int
+		Catalog       catalogOptions
+		Tags          tagOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "cluster",
+		Short: "Map the images running in a Kubernetes cluster to their Chainguard equivalents.",
+		Example: `
+# Map the images running in the current namespace
+image-mapper map cluster
+
+# Map the images running in every namespace
+image-mapper map cluster -A
+
+# Map the images running in specific namespaces, using a different context
+image-mapper map cluster --context=prod -n frontend -n backend
+
+# Map the images run by pods with specific labels
+image-mapper map cluster -A -l app.kubernetes.io/part-of=shop
+
+# Write the mappings, and the workloads that run each image, as JSON
+image-mapper map cluster -A -o json
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := mapper.NewOutput(opts.OutputFormat)
+			if err != nil {
+				return fmt.Errorf("constructing output: %w", err)
+			}
+
+			loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+			loadingRules.ExplicitPath = opts.Kubeconfig
+			clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+				CurrentContext: opts.Context,
+			})
+
+			config, err := clientConfig.ClientConfig()
+			if err != nil {
+				return fmt.Errorf("loading kubeconfig: %w", err)
+			}
+			client, err := kubernetes.NewForConfig(config)
+			if err != nil {
+				return fmt.Errorf("constructing client: %w", err)
+			}
+
+			// Like kubectl, default to the namespace of the context
+			namespaces := opts.Namespaces
+			if len(namespaces) == 0 && !opts.AllNamespaces {
+				ns, _, err := clientConfig.Namespace()
+				if err != nil {
+					return fmt.Errorf("loading namespace: %w", err)
+				}
+				namespaces = []string{ns}
+			}
+
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			m, err := k8s.NewMapper(cmd.Context(), mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("constructing mapper: %w", err)
+			}
+
+			it := k8s.NewClusterIterator(cmd.Context(), client, k8s.ClusterOptions{
+				Namespaces:    namespaces,
+				LabelSelector: opts.Selector,
+			})
+
+			mappings, err := mapper.MapAll(m, it, opts.Workers)
+			if err != nil {
+				return fmt.Errorf("mapping images: %w", err)
+			}
+
+			return output(os.Stdout, mappings)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "text", "Output format (csv, customer-yaml, html, json, markdown, text, tsv)")
+	cmd.Flags().StringVar(&opts.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config.")
+	cmd.Flags().StringVar(&opts.Context, "context", "", "The kubeconfig context to use. Defaults to the current context.")
+	cmd.Flags().StringSliceVarP(&opts.Namespaces, "namespace", "n", []string{}, "Namespaces to list pods in. Defaults to the namespace of the context.")
+	cmd.Flags().BoolVarP(&opts.AllNamespaces, "all-namespaces", "A", false, "List pods in all namespaces.")
+	cmd.Flags().StringVarP(&opts.Selector, "selector", "l", "", "Only map the images of pods that match this label selector, i.e app=web")
+	opts.Mapper.addFlags(cmd.Flags())
+	cmd.Flags().IntVar(&opts.Workers, "workers", 0, "The number of images to map concurrently. Defaults to the number of CPUs.")
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+
+	cmd.MarkFlagsMutuallyExclusive("namespace", "all-namespaces")
+
+	return cmd
+}
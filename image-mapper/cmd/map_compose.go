@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/compose"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/filetype"
+	"github.com/spf13/cobra"
+)
+
+func MapComposeCommand() *cobra.Command {
+	opts := struct {
+		Mapper  mapperOptions
+		EnvFile string
+		Catalog catalogOptions
+		Tags    tagOptions
+		Rewrite rewriteOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "compose",
+		Short: "Map service images in a Docker Compose file to their Chainguard equivalents.",
+		Example: `
+# Map a Compose file
+image-mapper map compose docker-compose.yaml
+
+# Map a Compose file from stdin
+cat docker-compose.yaml | image-mapper map compose -
+
+# Interpolate variables from a specific env file
+image-mapper map compose docker-compose.yaml --env-file=.env.dev
+
+# Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
+image-mapper map compose docker-compose.yaml --repository=registry.internal/cgr
+
+# Rewrite every Compose file in a directory tree in place
+image-mapper map compose . --write
+
+# Print a diff of the changes and fail if there are any, i.e in CI
+image-mapper map compose . --diff --check
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+
+				m, err := compose.NewMapper(cmd.Context(), mapperOpts...)
+				if err != nil {
+					return fmt.Errorf("constructing mapper: %w", err)
+				}
+
+				return opts.Rewrite.rewrite(cmd, args, filetype.IsComposeFile, func(path string, input []byte) ([]byte, error) {
+					env, err := compose.LoadEnv(filepath.Dir(path), opts.EnvFile)
+					if err != nil {
+						return nil, err
+					}
+
+					output, unmapped, err := compose.Rewrite(m, input, env)
+					if err != nil {
+						return nil, err
+					}
+					writeUnmappedServices(path, unmapped)
+
+					return output, nil
+				})
+			}
+
+			var (
+				input []byte
+				dir   = "."
+			)
+			switch args[0] {
+			case "-":
+				input, err = io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("reading stdin: %w", err)
+				}
+			default:
+				input, err = os.ReadFile(args[0])
+				if err != nil {
+					return fmt.Errorf("reading file: %s: %w", args[0], err)
+				}
+				dir = filepath.Dir(args[0])
+			}
+
+			env, err := compose.LoadEnv(dir, opts.EnvFile)
+			if err != nil {
+				return err
+			}
+
+			output, unmapped, err := compose.Map(cmd.Context(), input, env, mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("mapping compose file: %w", err)
+			}
+
+			if _, err := os.Stdout.Write(output); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+
+			writeUnmappedServices(args[0], unmapped)
+
+			return nil
+		},
+	}
+
+	opts.Mapper.addFlags(cmd.Flags())
+	cmd.Flags().StringVar(&opts.EnvFile, "env-file", "", "A file of variables to interpolate into images. Defaults to the .env file alongside the Compose file, if there is one. Variables in the environment take precedence.")
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	opts.Rewrite.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+// writeUnmappedServices reports the services in a Compose file that weren't
+// mapped on stderr
+func writeUnmappedServices(path string, unmapped []compose.UnmappedService) {
+	if len(unmapped) == 0 {
+		return
+	}
+
+	if path == "-" {
+		fmt.Fprintln(os.Stderr, "Unmapped services:")
+	} else {
+		fmt.Fprintf(os.Stderr, "Unmapped services in %s:\n", path)
+	}
+	for _, svc := range unmapped {
+		fmt.Fprintf(os.Stderr, "  %s\n", strings.Join(nonEmpty(svc.Service, svc.Image, svc.Reason), ": "))
+	}
+}
+
+// nonEmpty returns the strings that aren't empty
+func nonEmpty(ss ...string) []string {
+	var result []string
+	for _, s := range ss {
+		if s != "" {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
@@ -4,15 +4,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/dockerfile"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/filetype"
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
 	"github.com/spf13/cobra"
 )
 
 func MapDockerfileCommand() *cobra.Command {
 	opts := struct {
-		Repo string
+		Mapper    mapperOptions
+		Catalog   catalogOptions
+		Tags      tagOptions
+		StageTags bool
+		BuildArgs []string
+		Rewrite   rewriteOptions
 	}{}
 	cmd := &cobra.Command{
 		Use:   "dockerfile",
@@ -26,13 +33,57 @@ cat Dockerfile | image-mapper map dockerfile -
 
 # Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
 image-mapper map dockerfile Dockerfile --repository=registry.internal/cgr
+
+# Use -dev tags for the build stages of a multi-stage Dockerfile, but not the final stage
+image-mapper map dockerfile Dockerfile --stage-tags
+
+# Set the value of an ARG, like docker build. Images that use it aren't rewritten, but what they map to is reported.
+image-mapper map dockerfile Dockerfile --build-arg BASE_IMAGE=python:3.13
+
+# Rewrite every Dockerfile in a directory tree in place
+image-mapper map dockerfile . --write
+
+# Print a diff of the changes and fail if there are any, i.e in CI
+image-mapper map dockerfile . --diff --check
 `,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var (
-				input []byte
-				err   error
-			)
+			buildArgs, err := parseBuildArgs(opts.BuildArgs)
+			if err != nil {
+				return err
+			}
+
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			newMapper := dockerfile.NewMapper
+			if opts.StageTags {
+				newMapper = dockerfile.NewStageMapper
+				// Each stage is mapped with its own mapper, so
+				// load the catalog once and share it between them
+				mapperOpts = append(mapperOpts, mapper.WithCatalogSource(mapper.NewMemoryCatalogSource(opts.Catalog.source())))
+			}
+
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+
+				m, err := newMapper(cmd.Context(), mapperOpts...)
+				if err != nil {
+					return fmt.Errorf("constructing mapper: %w", err)
+				}
+
+				return opts.Rewrite.rewrite(cmd, args, filetype.IsDockerfile, func(_ string, input []byte) ([]byte, error) {
+					return dockerfile.Rewrite(m, input, buildArgs)
+				})
+			}
+
+			var input []byte
 			switch args[0] {
 			case "-":
 				input, err = io.ReadAll(os.Stdin)
@@ -46,7 +97,12 @@ image-mapper map dockerfile Dockerfile --repository=registry.internal/cgr
 				}
 			}
 
-			output, err := dockerfile.Map(cmd.Context(), input, mapper.WithRepository(opts.Repo))
+			m, err := newMapper(cmd.Context(), mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("constructing mapper: %w", err)
+			}
+
+			output, err := dockerfile.Rewrite(m, input, buildArgs)
 			if err != nil {
 				return fmt.Errorf("mapping dockerfile: %w", err)
 			}
@@ -59,7 +115,36 @@ image-mapper map dockerfile Dockerfile --repository=registry.internal/cgr
 		},
 	}
 
-	cmd.Flags().StringVar(&opts.Repo, "repository", "cgr.dev/chainguard", "Modifies the repository URI in the mappings. For instance, registry.internal.dev/chainguard would result in registry.internal.dev/chainguard/<image> in the output.")
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.StageTags, "stage-tags", false, "Prefer -dev tags, which include a shell and package manager, for the build stages of a multi-stage Dockerfile and exclude them from the final stage.")
+	cmd.Flags().StringArrayVar(&opts.BuildArgs, "build-arg", []string{}, "Set the value of an ARG, like docker build. KEY=VALUE sets the value and KEY uses the value of the environment variable.")
+	opts.Rewrite.addFlags(cmd.Flags())
+
+	cmd.MarkFlagsMutuallyExclusive("tag-filter", "stage-tags")
 
 	return cmd
 }
+
+// parseBuildArgs parses --build-arg flags. Like docker build, an arg without a
+// value takes its value from the environment, and is ignored if the variable
+// isn't set.
+func parseBuildArgs(flags []string) (map[string]string, error) {
+	buildArgs := map[string]string{}
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid --build-arg: %s", flag)
+		}
+		if !ok {
+			value, ok = os.LookupEnv(key)
+			if !ok {
+				continue
+			}
+		}
+		buildArgs[key] = value
+	}
+
+	return buildArgs, nil
+}
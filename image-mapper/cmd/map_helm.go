@@ -3,8 +3,11 @@ package cmd
 import (
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"path/filepath"
 
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/filetype"
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
 	"github.com/spf13/cobra"
@@ -12,9 +15,19 @@ import (
 
 func MapHelmChartCommand() *cobra.Command {
 	opts := struct {
-		Repo         string
+		Mapper       mapperOptions
 		ChartRepo    string
 		ChartVersion string
+		Username     string
+		Password     string
+		PlainHTTP    bool
+		Render       bool
+		Verify       bool
+		ValuesFiles  []string
+		Values       []string
+		Catalog      catalogOptions
+		Tags         tagOptions
+		Rewrite      rewriteOptions
 	}{}
 	cmd := &cobra.Command{
 		Use:   "helm-chart",
@@ -34,15 +47,107 @@ func MapHelmChartCommand() *cobra.Command {
   
   # Specify a specific version of a remote Chart.
   image-mapper map helm-chart argo-cd --chart-repo=https://argoproj.github.io/argo-helm --chart-version=9.0.0
+
+  # Map a chart in an OCI registry. Credentials are read from 'helm registry login', or can be provided with --username and --password.
+  image-mapper map helm-chart oci://ghcr.io/argoproj/argo-helm/argo-cd --chart-version=9.0.0
+
+  # Map a chart directory or a packaged chart on disk.
+  image-mapper map helm-chart ./charts/my-chart
+  image-mapper map helm-chart ./my-chart-1.0.0.tgz
+
+  # Rewrite the values files of a local chart, and its subcharts, in place.
+  image-mapper map helm-chart ./charts/my-chart --write
+
+  # Print a diff of the changes to a local chart and fail if there are any, i.e in CI.
+  image-mapper map helm-chart ./charts/my-chart --diff --check
+
+  # Render the chart's templates with your values and warn about images that the mapped values can't override.
+  image-mapper map helm-chart argocd/argo-cd --render --values=values.yaml --set=redis.enabled=false
+
+  # Render the chart with and without the mapped values and fail if any images weren't mapped as expected, i.e in CI.
+  image-mapper map helm-chart argocd/argo-cd --verify --values=values.yaml
 `,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			// Rewriting in place only makes sense for charts on
+			// disk, so the values files are rewritten directly
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+				if opts.Render || opts.Verify {
+					return fmt.Errorf("--render and --verify can't be used with --write, --diff or --check")
+				}
+				for _, arg := range args {
+					if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+						return fmt.Errorf("--write, --diff and --check require a chart directory on disk: %s", arg)
+					}
+				}
+
+				return rewriteValues(cmd, opts.Rewrite, args, func(path string) bool {
+					return filepath.Base(path) == "values.yaml"
+				}, mapperOpts...)
+			}
+
 			chart := helm.ChartDescriptor{
 				Name:       args[0],
 				Repository: opts.ChartRepo,
 				Version:    opts.ChartVersion,
+				Username:   opts.Username,
+				Password:   opts.Password,
+				PlainHTTP:  opts.PlainHTTP,
+			}
+			render := helm.RenderOptions{
+				ValuesFiles: opts.ValuesFiles,
+				Values:      opts.Values,
+			}
+			var (
+				output      []byte
+				regressions int
+			)
+			switch {
+			case opts.Render && opts.Verify:
+				return fmt.Errorf("--render and --verify can't be used together")
+			case opts.Render:
+				var hardcoded []helm.HardcodedImage
+				output, hardcoded, err = helm.RenderChart(cmd.Context(), chart, render, mapperOpts...)
+				for _, img := range hardcoded {
+					if img.Rendered != img.Image {
+						log.Printf("WARN: %s/%s: container %s: image %s is rendered as %s with the mapped values (maps to %s)", img.Kind, img.Name, img.Container, img.Image, img.Rendered, img.Mapped)
+						continue
+					}
+					log.Printf("WARN: %s/%s: container %s: image %s isn't changed by the mapped values, so it can't be overridden (maps to %s)", img.Kind, img.Name, img.Container, img.Image, img.Mapped)
+				}
+			case opts.Verify:
+				var verified []helm.VerifiedImage
+				output, verified, err = helm.VerifyChart(cmd.Context(), chart, render, mapperOpts...)
+				for _, img := range verified {
+					if !img.Regression() {
+						continue
+					}
+					regressions++
+
+					switch img.Status {
+					case helm.VerifyStatusUpstream:
+						log.Printf("WARN: %s/%s: container %s: image %s wasn't changed by the values (expected %s)", img.Kind, img.Name, img.Container, img.Original, img.Expected)
+					case helm.VerifyStatusMissing:
+						log.Printf("WARN: %s/%s: container %s: container isn't rendered with the values (image %s)", img.Kind, img.Name, img.Container, img.Original)
+					default:
+						log.Printf("WARN: %s/%s: container %s: image %s was changed to %s by the values (expected %s)", img.Kind, img.Name, img.Container, img.Original, img.Image, img.Expected)
+					}
+				}
+			case len(opts.ValuesFiles) > 0 || len(opts.Values) > 0:
+				return fmt.Errorf("--values and --set require --render or --verify")
+			default:
+				output, err = helm.MapChart(cmd.Context(), chart, mapperOpts...)
 			}
-			output, err := helm.MapChart(cmd.Context(), chart, mapper.WithRepository(opts.Repo))
 			if err != nil {
 				return fmt.Errorf("mapping values: %w", err)
 			}
@@ -51,20 +156,40 @@ func MapHelmChartCommand() *cobra.Command {
 				return fmt.Errorf("writing output: %w", err)
 			}
 
+			if regressions > 0 {
+				// The failure of the verification isn't a
+				// usage error
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d image(s) weren't mapped as expected", regressions)
+			}
+
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&opts.Repo, "repository", "cgr.dev/chainguard", "Modifies the repository URI in the mappings. For instance, registry.internal.dev/chainguard would result in registry.internal.dev/chainguard/<image> in the output.")
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	opts.Rewrite.addFlags(cmd.Flags())
 	cmd.Flags().StringVar(&opts.ChartRepo, "chart-repo", "", "The chart repository url to locate the requested chart.")
 	cmd.Flags().StringVar(&opts.ChartVersion, "chart-version", "", "A version constraint for the chart version.")
+	cmd.Flags().StringVar(&opts.Username, "username", "", "The username for the chart repository or OCI registry.")
+	cmd.Flags().StringVar(&opts.Password, "password", "", "The password for the chart repository or OCI registry.")
+	cmd.Flags().BoolVar(&opts.PlainHTTP, "plain-http", false, "Pull OCI charts over HTTP, rather than HTTPS.")
+	cmd.Flags().BoolVar(&opts.Render, "render", false, "Render the chart's templates, without a cluster, and warn about images in the manifests that the mapped values can't override.")
+	cmd.Flags().BoolVar(&opts.Verify, "verify", false, "Render the chart's templates with and without the mapped values, without a cluster, and exit with a non-zero status if any images weren't mapped as expected.")
+	cmd.Flags().StringArrayVarP(&opts.ValuesFiles, "values", "f", nil, "A values file to render the chart with. Can be repeated. Requires --render or --verify.")
+	cmd.Flags().StringArrayVar(&opts.Values, "set", nil, "A value to render the chart with, in the form key=value. Can be repeated. Requires --render or --verify.")
 
 	return cmd
 }
 
 func MapHelmValuesCommand() *cobra.Command {
 	opts := struct {
-		Repo string
+		Mapper  mapperOptions
+		Catalog catalogOptions
+		Tags    tagOptions
+		Rewrite rewriteOptions
 	}{}
 	cmd := &cobra.Command{
 		Use:   "helm-values",
@@ -79,13 +204,31 @@ func MapHelmValuesCommand() *cobra.Command {
   
   # Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
   image-mapper map helm-values values.yaml --repository=registry.internal/cgr
+
+  # Map the images in a values file in place, rather than extracting them.
+  image-mapper map helm-values values.yaml --write
+
+  # Print a diff of the changes to the values files in a directory tree and fail if there are any, i.e in CI.
+  image-mapper map helm-values . --diff --check
 `,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			var (
-				input []byte
-				err   error
-			)
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+
+				return rewriteValues(cmd, opts.Rewrite, args, filetype.IsValuesFile, mapperOpts...)
+			}
+
+			var input []byte
 			switch args[0] {
 			case "-":
 				input, err = io.ReadAll(os.Stdin)
@@ -99,7 +242,7 @@ func MapHelmValuesCommand() *cobra.Command {
 				}
 			}
 
-			output, err := helm.MapValues(cmd.Context(), input, mapper.WithRepository(opts.Repo))
+			output, err := helm.MapValues(cmd.Context(), input, mapperOpts...)
 			if err != nil {
 				return fmt.Errorf("mapping values: %w", err)
 			}
@@ -112,7 +255,22 @@ func MapHelmValuesCommand() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVar(&opts.Repo, "repository", "cgr.dev/chainguard", "Modifies the repository URI in the mappings. For instance, registry.internal.dev/chainguard would result in registry.internal.dev/chainguard/<image> in the output.")
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	opts.Rewrite.addFlags(cmd.Flags())
 
 	return cmd
 }
+
+// rewriteValues maps the images in values files in place
+func rewriteValues(cmd *cobra.Command, o rewriteOptions, paths []string, match func(path string) bool, opts ...mapper.Option) error {
+	m, err := helm.NewMapper(cmd.Context(), opts...)
+	if err != nil {
+		return fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return o.rewrite(cmd, paths, match, func(_ string, input []byte) ([]byte, error) {
+		return helm.RewriteValues(m, input)
+	})
+}
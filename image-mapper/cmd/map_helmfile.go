@@ -0,0 +1,194 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/argocd"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/filetype"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helmfile"
+	"github.com/spf13/cobra"
+)
+
+func MapHelmfileCommand() *cobra.Command {
+	opts := struct {
+		Mapper  mapperOptions
+		Catalog catalogOptions
+		Tags    tagOptions
+		Rewrite rewriteOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "helmfile",
+		Short: "Map the images in the charts of the releases in a helmfile to their Chainguard equivalents.",
+		Long: `Map the images in the charts of the releases in a helmfile to their Chainguard equivalents.
+
+The chart of each release is pulled and mapped like 'map helm-chart', along with the values of the release. The values that override the images are added as the last values of each release.`,
+		Example: `
+# Map a helmfile
+image-mapper map helmfile helmfile.yaml
+
+# Map a helmfile from stdin. Paths to charts and values files are relative to the current directory.
+cat helmfile.yaml | image-mapper map helmfile -
+
+# Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
+image-mapper map helmfile helmfile.yaml --repository=registry.internal/cgr
+
+# Rewrite every helmfile in a directory tree in place
+image-mapper map helmfile . --write
+
+# Print a diff of the changes and fail if there are any, i.e in CI
+image-mapper map helmfile . --diff --check
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+
+				m, err := helm.NewMapper(cmd.Context(), mapperOpts...)
+				if err != nil {
+					return fmt.Errorf("constructing mapper: %w", err)
+				}
+
+				return opts.Rewrite.rewrite(cmd, args, filetype.IsHelmfile, func(path string, input []byte) ([]byte, error) {
+					return helmfile.Rewrite(cmd.Context(), m, input, filepath.Dir(path))
+				})
+			}
+
+			var (
+				input []byte
+				dir   = "."
+			)
+			switch args[0] {
+			case "-":
+				input, err = io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("reading stdin: %w", err)
+				}
+			default:
+				input, err = os.ReadFile(args[0])
+				if err != nil {
+					return fmt.Errorf("reading file: %s: %w", args[0], err)
+				}
+				dir = filepath.Dir(args[0])
+			}
+
+			output, err := helmfile.Map(cmd.Context(), input, dir, mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("mapping helmfile: %w", err)
+			}
+
+			if _, err := os.Stdout.Write(output); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	opts.Rewrite.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+func MapArgoCDAppCommand() *cobra.Command {
+	opts := struct {
+		Mapper  mapperOptions
+		Catalog catalogOptions
+		Tags    tagOptions
+		Rewrite rewriteOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "argocd-app",
+		Short: "Map the images in the Helm charts of Argo CD Applications to their Chainguard equivalents.",
+		Long: `Map the images in the Helm charts of Argo CD Applications to their Chainguard equivalents.
+
+The chart of each Helm source is pulled and mapped like 'map helm-chart', along with the values of the source. The values that override the images are merged into the values of each source.`,
+		Example: `
+# Map an Application
+image-mapper map argocd-app application.yaml
+
+# Map the Applications in a cluster
+kubectl get applications -n argocd -o yaml | image-mapper map argocd-app -
+
+# Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
+image-mapper map argocd-app application.yaml --repository=registry.internal/cgr
+
+# Rewrite every Application in a directory tree in place
+image-mapper map argocd-app apps/ --write
+
+# Print a diff of the changes and fail if there are any, i.e in CI
+image-mapper map argocd-app apps/ --diff --check
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+
+				m, err := helm.NewMapper(cmd.Context(), mapperOpts...)
+				if err != nil {
+					return fmt.Errorf("constructing mapper: %w", err)
+				}
+
+				return opts.Rewrite.rewrite(cmd, args, filetype.IsYAML, func(_ string, input []byte) ([]byte, error) {
+					return argocd.Rewrite(cmd.Context(), m, input)
+				})
+			}
+
+			var input []byte
+			switch args[0] {
+			case "-":
+				input, err = io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("reading stdin: %w", err)
+				}
+			default:
+				input, err = os.ReadFile(args[0])
+				if err != nil {
+					return fmt.Errorf("reading file: %s: %w", args[0], err)
+				}
+			}
+
+			output, err := argocd.Map(cmd.Context(), input, mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("mapping applications: %w", err)
+			}
+
+			if _, err := os.Stdout.Write(output); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	opts.Rewrite.addFlags(cmd.Flags())
+
+	return cmd
+}
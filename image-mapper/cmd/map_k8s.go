@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/filetype"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
+	"github.com/spf13/cobra"
+)
+
+func MapK8sCommand() *cobra.Command {
+	opts := struct {
+		Mapper  mapperOptions
+		Catalog catalogOptions
+		Tags    tagOptions
+		Rewrite rewriteOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "k8s",
+		Short: "Map container images in Kubernetes manifests to their Chainguard equivalents.",
+		Example: `
+# Map the images in a file of manifests
+image-mapper map k8s deployment.yaml
+
+# Map manifests from stdin
+kubectl get deployments -o yaml | image-mapper map k8s -
+
+# Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
+image-mapper map k8s deployment.yaml --repository=registry.internal/cgr
+
+# Rewrite every manifest in a directory tree in place
+image-mapper map k8s manifests/ --write
+
+# Print a diff of the changes and fail if there are any, i.e in CI
+image-mapper map k8s manifests/ --diff --check
+`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			if opts.Rewrite.enabled() {
+				if err := opts.Rewrite.validate(args); err != nil {
+					return err
+				}
+
+				m, err := k8s.NewMapper(cmd.Context(), mapperOpts...)
+				if err != nil {
+					return fmt.Errorf("constructing mapper: %w", err)
+				}
+
+				return opts.Rewrite.rewrite(cmd, args, filetype.IsYAML, func(_ string, input []byte) ([]byte, error) {
+					return k8s.Rewrite(m, input)
+				})
+			}
+
+			var input []byte
+			switch args[0] {
+			case "-":
+				input, err = io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("reading stdin: %w", err)
+				}
+			default:
+				input, err = os.ReadFile(args[0])
+				if err != nil {
+					return fmt.Errorf("reading file: %s: %w", args[0], err)
+				}
+			}
+
+			output, err := k8s.Map(cmd.Context(), input, mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("mapping manifests: %w", err)
+			}
+
+			if _, err := os.Stdout.Write(output); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+	opts.Rewrite.addFlags(cmd.Flags())
+
+	return cmd
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/kustomize"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/spf13/cobra"
+)
+
+func MapKustomizeCommand() *cobra.Command {
+	opts := struct {
+		Mapper     mapperOptions
+		ImagesOnly bool
+		Catalog    catalogOptions
+		Tags       tagOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "kustomize <dir>",
+		Short: "Map container images in a kustomization to Chainguard with an images transformer.",
+		Example: `
+# Print the kustomization in the current directory with its images list patched to map images to Chainguard
+image-mapper map kustomize .
+
+# Print only the images list
+image-mapper map kustomize overlays/prod --images-only
+
+# Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
+image-mapper map kustomize . --repository=registry.internal/cgr
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Catalog.option())
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			var output []byte
+			if opts.ImagesOnly {
+				output, err = mapKustomizeImages(cmd.Context(), args[0], mapperOpts...)
+			} else {
+				output, err = kustomize.Map(cmd.Context(), args[0], mapperOpts...)
+			}
+			if err != nil {
+				return fmt.Errorf("mapping kustomization: %w", err)
+			}
+
+			if _, err := os.Stdout.Write(output); err != nil {
+				return fmt.Errorf("writing output: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	opts.Mapper.addFlags(cmd.Flags())
+	cmd.Flags().BoolVar(&opts.ImagesOnly, "images-only", false, "Print only the images list, rather than the whole kustomization")
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+
+	return cmd
+}
+
+// mapKustomizeImages returns only the images list for the kustomization in dir
+func mapKustomizeImages(ctx context.Context, dir string, opts ...mapper.Option) ([]byte, error) {
+	images, err := kustomize.MapImages(ctx, dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return kustomize.EncodeImages(images)
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/spf13/pflag"
+)
+
+// mapperOptions configure the repository that images are mapped to, and the
+// user supplied mappings
+type mapperOptions struct {
+	Repo         string
+	MappingsFile string
+	PinDigests   bool
+}
+
+// addFlags adds the mapper flags to the flag set
+func (o *mapperOptions) addFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&o.Repo, "repository", "cgr.dev/chainguard", "Modifies the repository URI in the mappings. For instance, registry.internal.dev/chainguard would result in registry.internal.dev/chainguard/<image> in the output.")
+	flags.StringVar(&o.MappingsFile, "mappings-file", "", "A YAML or JSON file of mappings that pin images to specific Chainguard repos and tags, exclude images or add aliases. These take precedence over the built-in matching.")
+	flags.BoolVar(&o.PinDigests, "pin-digests", false, "Pin each mapped image to the current digest of its tag, i.e cgr.dev/chainguard/nginx:1.27@sha256:... Registry credentials are read from the Docker config.")
+}
+
+// options returns the mapper options for the flags. The mappings file is read
+// once here, rather than by every mapper that's constructed with the options.
+func (o *mapperOptions) options() ([]mapper.Option, error) {
+	opts := []mapper.Option{
+		mapper.WithRepository(o.Repo),
+		mapper.WithPinDigests(o.PinDigests),
+	}
+	if o.MappingsFile != "" {
+		overrides, err := mapper.ReadOverridesFile(o.MappingsFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading mappings file: %w", err)
+		}
+		opts = append(opts, mapper.WithOverrides(overrides))
+	}
+
+	return opts, nil
+}
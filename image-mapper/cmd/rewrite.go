@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/rewrite"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// rewriteOptions are the options for subcommands that can rewrite files in
+// place
+type rewriteOptions struct {
+	Write bool
+	Diff  bool
+	Check bool
+}
+
+// addFlags adds the rewrite flags to a command
+func (o *rewriteOptions) addFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(&o.Write, "write", "w", false, "Rewrite the files in place. Directories are searched recursively for matching files.")
+	flags.BoolVar(&o.Diff, "diff", false, "Print a unified diff of the changes instead of the rewritten content. Directories are searched recursively for matching files.")
+	flags.BoolVar(&o.Check, "check", false, "Exit with a non-zero status if any files would be changed. Directories are searched recursively for matching files.")
+}
+
+// enabled returns true if any of the rewrite flags are set
+func (o rewriteOptions) enabled() bool {
+	return o.Write || o.Diff || o.Check
+}
+
+// validate checks that the paths can be rewritten
+func (o rewriteOptions) validate(paths []string) error {
+	for _, path := range paths {
+		if path == "-" {
+			return fmt.Errorf("stdin can't be used with --write, --diff or --check")
+		}
+	}
+
+	return nil
+}
+
+// rewrite rewrites each of the paths with fn. Directories are searched
+// recursively for files that match. Depending on the options, the changes are
+// written back to the files, printed as a diff and/or checked.
+func (o rewriteOptions) rewrite(cmd *cobra.Command, paths []string, match func(path string) bool, fn rewrite.Fn) error {
+	// Errors from here on aren't usage errors, like the failure of a
+	// check, so there's no need to print the usage
+	cmd.SilenceUsage = true
+
+	return rewrite.Files(cmd.OutOrStdout(), rewrite.Options{
+		Write: o.Write,
+		Diff:  o.Diff,
+		Check: o.Check,
+	}, paths, match, fn)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/scan"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(
+		ScanCommand(),
+	)
+}
+
+func ScanCommand() *cobra.Command {
+	opts := struct {
+		OutputFormat string
+		Mapper       mapperOptions
+		Catalog      catalogOptions
+		Tags         tagOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "scan <dir>",
+		Short: "Report the images referenced by the Dockerfiles, Helm values, charts, Compose files and Kubernetes manifests in a directory tree.",
+		Example: `
+# Scan the current directory
+image-mapper scan .
+
+# Write the report as JSON
+image-mapper scan . -o json
+
+# Write the report as CSV, for a spreadsheet
+image-mapper scan . -o csv > images.csv
+
+# Override the repository in the mappings with your own mirror or proxy. For instance, cgr.dev/chainguard/<image> would become registry.internal/cgr/<image> in the output.
+image-mapper scan . --repository=registry.internal/cgr
+`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := scan.NewOutput(opts.OutputFormat)
+			if err != nil {
+				return fmt.Errorf("constructing output: %w", err)
+			}
+
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			// Each type of file is mapped with its own mapper, so load
+			// the catalog once and share it between them
+			mapperOpts = append(mapperOpts, mapper.WithCatalogSource(mapper.NewMemoryCatalogSource(opts.Catalog.source())))
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			refs, err := scan.Scan(cmd.Context(), args[0], mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("scanning directory: %w", err)
+			}
+
+			return output(os.Stdout, refs)
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.OutputFormat, "output", "o", "markdown", "Output format (csv, json, markdown)")
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+
+	return cmd
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/server"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(
+		ServeCommand(),
+	)
+}
+
+func ServeCommand() *cobra.Command {
+	opts := struct {
+		Addr            string
+		RefreshInterval time.Duration
+		Mapper          mapperOptions
+		Catalog         catalogOptions
+		Tags            tagOptions
+	}{}
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve an HTTP API that maps images, Dockerfiles and Helm values to Chainguard.",
+		Example: `
+  # Serve the API on port 8080
+  image-mapper serve
+
+  # Map an image
+  curl 'http://localhost:8080/v1/map?image=nginx:1.25'
+
+  # Map a batch of images
+  curl -X POST http://localhost:8080/v1/map -d '{"images": ["nginx:1.25", "golang:1.24"]}'
+
+  # Map a Dockerfile
+  curl -X POST http://localhost:8080/v1/map/dockerfile --data-binary @Dockerfile
+
+  # Refresh the catalog every 15 minutes, rather than every hour
+  image-mapper serve --refresh-interval=15m
+`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			mapperOpts, err := opts.Mapper.options()
+			if err != nil {
+				return err
+			}
+			mapperOpts = append(mapperOpts, opts.Tags.options()...)
+
+			s, err := server.New(ctx, opts.Catalog.source(), mapperOpts...)
+			if err != nil {
+				return fmt.Errorf("constructing server: %w", err)
+			}
+			if opts.RefreshInterval > 0 {
+				go s.RefreshEvery(ctx, opts.RefreshInterval)
+			}
+
+			srv := &http.Server{
+				Addr:              opts.Addr,
+				Handler:           s.Handler(),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if err := srv.Shutdown(shutdownCtx); err != nil {
+					log.Printf("WARN: shutting down server: %s", err)
+				}
+			}()
+
+			log.Printf("Listening on %s", opts.Addr)
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("serving: %w", err)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.Addr, "addr", ":8080", "The address to listen on.")
+	cmd.Flags().DurationVar(&opts.RefreshInterval, "refresh-interval", time.Hour, "How often the catalog is reloaded. Set to 0 to never reload it.")
+	opts.Mapper.addFlags(cmd.Flags())
+	opts.Catalog.addFlags(cmd)
+	opts.Tags.addFlags(cmd.Flags())
+
+	return cmd
+}
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/spf13/pflag"
+)
+
+// tagFilters are the tag filters that can be selected with --tag-filter
+var tagFilters = map[string][]mapper.TagFilter{
+	"any":         {},
+	"exclude-dev": {mapper.TagFilterExcludeDev},
+	"include-dev": {mapper.TagFilterIncludeDev},
+	"prefer-dev":  {mapper.TagFilterPreferDev},
+}
+
+// tagFilterValue is a flag value that only accepts the names of tag filters
+type tagFilterValue string
+
+func (v *tagFilterValue) String() string {
+	return string(*v)
+}
+
+func (v *tagFilterValue) Set(s string) error {
+	if _, ok := tagFilters[s]; !ok {
+		return fmt.Errorf("must be one of %s", strings.Join(tagFilterNames(), ", "))
+	}
+	*v = tagFilterValue(s)
+
+	return nil
+}
+
+func (v *tagFilterValue) Type() string {
+	return "string"
+}
+
+// tagOptions configure which tags images are mapped to
+type tagOptions struct {
+	Filter       tagFilterValue
+	InactiveTags bool
+}
+
+// addFlags adds the tag flags to the flag set
+func (o *tagOptions) addFlags(flags *pflag.FlagSet) {
+	flags.Var(&o.Filter, "tag-filter", fmt.Sprintf("Filter the tags that images are mapped to (%s). Defaults to the filter that suits the input.", strings.Join(tagFilterNames(), ", ")))
+	flags.BoolVar(&o.InactiveTags, "inactive-tags", false, "Match against inactive tags, as well as active tags, so that older versions can be mapped to the closest version.")
+}
+
+// options returns the mapper options that configure the tags. Options are only
+// returned for the flags that are set, so that they don't override the
+// defaults of each subcommand.
+func (o *tagOptions) options() []mapper.Option {
+	var opts []mapper.Option
+	if o.Filter != "" {
+		opts = append(opts, mapper.WithTagFilters(tagFilters[string(o.Filter)]...))
+	}
+	if o.InactiveTags {
+		opts = append(opts, mapper.WithInactiveTags(true))
+	}
+
+	return opts
+}
+
+// tagFilterNames returns the names of the tag filters, sorted
+func tagFilterNames() []string {
+	var names []string
+	for name := range tagFilters {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
@@ -0,0 +1,266 @@
+package argocd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"gopkg.in/yaml.v3"
+)
+
+// Map maps the images in the Helm charts of Argo CD Applications to Chainguard,
+// and returns the Applications with the values that override them merged into
+// the Helm values of each source
+func Map(ctx context.Context, input []byte, opts ...mapper.Option) ([]byte, error) {
+	m, err := helm.NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return Rewrite(ctx, m, input)
+}
+
+// Rewrite maps the Applications with the provided mapper, so that many files
+// can be mapped without constructing a new mapper for each one
+func Rewrite(ctx context.Context, m mapper.Mapper, input []byte) ([]byte, error) {
+	docs, err := yamlhelpers.DecodeDocuments(input)
+	if err != nil {
+		return nil, fmt.Errorf("decoding manifests: %w", err)
+	}
+
+	var found bool
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		for _, app := range findApplications(doc.Content[0]) {
+			found = true
+			if err := mapApplication(ctx, m, app); err != nil {
+				return nil, fmt.Errorf("application %s: %w", yamlhelpers.ScalarValue(yamlhelpers.Lookup(app, "metadata", "name")), err)
+			}
+		}
+	}
+
+	// Files without any Applications are returned as they are, rather
+	// than re-encoded, so that they aren't changed when a directory of
+	// manifests is rewritten
+	if !found {
+		return input, nil
+	}
+
+	output, err := yamlhelpers.EncodeDocuments(docs)
+	if err != nil {
+		return nil, fmt.Errorf("encoding manifests: %w", err)
+	}
+
+	return output, nil
+}
+
+// findApplications returns the Argo CD Applications in a manifest, including
+// the items of a List
+func findApplications(node *yaml.Node) []*yaml.Node {
+	kind := yamlhelpers.ScalarValue(yamlhelpers.Lookup(node, "kind"))
+	if strings.HasSuffix(kind, "List") {
+		items := yamlhelpers.Lookup(node, "items")
+		if items == nil || items.Kind != yaml.SequenceNode {
+			return nil
+		}
+
+		var apps []*yaml.Node
+		for _, item := range items.Content {
+			apps = append(apps, findApplications(item)...)
+		}
+		return apps
+	}
+
+	apiVersion := yamlhelpers.ScalarValue(yamlhelpers.Lookup(node, "apiVersion"))
+	if kind != "Application" || !strings.HasPrefix(apiVersion, "argoproj.io/") {
+		return nil
+	}
+
+	return []*yaml.Node{node}
+}
+
+// mapApplication maps the Helm charts in the sources of an Application
+func mapApplication(ctx context.Context, m mapper.Mapper, app *yaml.Node) error {
+	var sources []*yaml.Node
+	if source := yamlhelpers.Lookup(app, "spec", "source"); source != nil {
+		sources = append(sources, source)
+	}
+	if seq := yamlhelpers.Lookup(app, "spec", "sources"); seq != nil && seq.Kind == yaml.SequenceNode {
+		sources = append(sources, seq.Content...)
+	}
+
+	for _, source := range sources {
+		if yamlhelpers.Lookup(source, "chart") == nil {
+			// Charts in Git repositories can't be resolved
+			// without cloning the repository
+			if yamlhelpers.Lookup(source, "helm") != nil {
+				log.Printf("WARN: skipping source: %s: only sources that reference a chart in a Helm repository are supported", yamlhelpers.ScalarValue(yamlhelpers.Lookup(source, "repoURL")))
+			}
+			continue
+		}
+
+		if err := mapSource(ctx, m, source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapSource maps the images in the chart of a source, and in its values, and
+// merges the values that override them into the values of the source.
+//
+// The values are merged into valuesObject, if it's set, because it takes
+// precedence over values. Otherwise, they're merged into values.
+func mapSource(ctx context.Context, m mapper.Mapper, source *yaml.Node) error {
+	chart := resolveChart(source)
+
+	// The helm node is only added to the source if there are values to
+	// add to it
+	helmNode := yamlhelpers.Lookup(source, "helm")
+	valuesNode := yamlhelpers.Lookup(helmNode, "values")
+	valuesObject := yamlhelpers.Lookup(helmNode, "valuesObject")
+
+	if files := yamlhelpers.Lookup(helmNode, "valueFiles"); files != nil && len(files.Content) > 0 {
+		log.Printf("WARN: %s: valueFiles aren't read, so the images in them aren't mapped", chart.Name)
+	}
+
+	// The values are in the order that Argo CD applies them
+	var values [][]byte
+	if valuesNode != nil && valuesNode.Kind == yaml.ScalarNode {
+		values = append(values, []byte(valuesNode.Value))
+	}
+	if valuesObject != nil {
+		v, err := yaml.Marshal(valuesObject)
+		if err != nil {
+			return fmt.Errorf("marshalling valuesObject: %w", err)
+		}
+		values = append(values, v)
+	}
+
+	overrides, err := helm.MapRelease(ctx, m, chart, values...)
+	if err != nil {
+		return err
+	}
+	for _, name := range imageParameters(helmNode, overrides) {
+		log.Printf("WARN: %s: parameter %s isn't mapped, and takes precedence over the mapped values", chart.Name, name)
+	}
+	if len(overrides.Content) == 0 {
+		return nil
+	}
+
+	switch {
+	case valuesObject != nil && valuesObject.Kind == yaml.MappingNode:
+		yamlhelpers.MergeNode(valuesObject, overrides)
+	case valuesNode != nil && valuesNode.Kind == yaml.ScalarNode:
+		merged, err := mergeValues(valuesNode.Value, overrides)
+		if err != nil {
+			return err
+		}
+		valuesNode.Value = merged
+		valuesNode.Style = yaml.LiteralStyle
+	default:
+		if helmNode == nil {
+			helmNode = &yaml.Node{Kind: yaml.MappingNode}
+			yamlhelpers.AddNode([]string{"helm"}, source, helmNode)
+		}
+		yamlhelpers.AddNode([]string{"valuesObject"}, helmNode, overrides)
+	}
+
+	return nil
+}
+
+// imageKeys are the keys of values that typically configure an image
+var imageKeys = map[string]bool{
+	"image":      true,
+	"repository": true,
+	"registry":   true,
+	"tag":        true,
+	"digest":     true,
+}
+
+// imageParameters returns the names of the parameters of a source that set
+// image related values, or values that are in the overrides. Argo CD applies
+// parameters after the values, so they take precedence over the overrides.
+func imageParameters(helmNode, overrides *yaml.Node) []string {
+	params := yamlhelpers.Lookup(helmNode, "parameters")
+	if params == nil || params.Kind != yaml.SequenceNode {
+		return nil
+	}
+
+	var names []string
+	for _, param := range params.Content {
+		name := yamlhelpers.ScalarValue(yamlhelpers.Lookup(param, "name"))
+		if name == "" {
+			continue
+		}
+		path := strings.Split(name, ".")
+		if imageKeys[path[len(path)-1]] || yamlhelpers.Lookup(overrides, path...) != nil {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// mergeValues merges the overrides into the values in a values string
+func mergeValues(values string, overrides *yaml.Node) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(values), &doc); err != nil {
+		return "", fmt.Errorf("unmarshalling values: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+	yamlhelpers.MergeNode(doc.Content[0], overrides)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return "", fmt.Errorf("encoding values: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return "", fmt.Errorf("encoding values: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// resolveChart returns the chart of a source. Helm repositories are referenced
+// by URL, while OCI registries are referenced without a scheme, i.e
+// ghcr.io/argoproj/argo-helm.
+func resolveChart(source *yaml.Node) helm.ChartDescriptor {
+	repoURL := yamlhelpers.ScalarValue(yamlhelpers.Lookup(source, "repoURL"))
+	name := yamlhelpers.ScalarValue(yamlhelpers.Lookup(source, "chart"))
+
+	// Argo CD treats * as the latest version, which is what Helm does
+	// when there's no version
+	version := yamlhelpers.ScalarValue(yamlhelpers.Lookup(source, "targetRevision"))
+	if version == "*" {
+		version = ""
+	}
+
+	if strings.HasPrefix(repoURL, "http://") || strings.HasPrefix(repoURL, "https://") {
+		return helm.ChartDescriptor{
+			Name:       name,
+			Repository: repoURL,
+			Version:    version,
+		}
+	}
+
+	return helm.ChartDescriptor{
+		Name:    fmt.Sprintf("oci://%s/%s", strings.TrimSuffix(strings.TrimPrefix(repoURL, "oci://"), "/"), name),
+		Version: version,
+	}
+}
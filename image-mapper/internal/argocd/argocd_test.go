@@ -0,0 +1,215 @@
+package argocd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+type mockMapper struct {
+	mappings map[string][]string
+}
+
+func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
+	mapping := &mapper.Mapping{
+		Image:   img,
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
+}
+
+// serveChart serves the chart from a Helm repository and returns its URL
+func serveChart(t *testing.T, path string) string {
+	t.Helper()
+
+	// Keep the repository cache out of the home directory
+	t.Setenv("HELM_CACHE_HOME", t.TempDir())
+	t.Setenv("HELM_CONFIG_HOME", t.TempDir())
+
+	chrt, err := loader.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading chart: %s", err)
+	}
+	dir := t.TempDir()
+	if _, err := chartutil.Save(chrt, dir); err != nil {
+		t.Fatalf("unexpected error packaging chart: %s", err)
+	}
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(srv.Close)
+
+	index, err := repo.IndexDirectory(dir, srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error indexing charts: %s", err)
+	}
+	if err := index.WriteFile(dir+"/index.yaml", 0o644); err != nil {
+		t.Fatalf("unexpected error writing index: %s", err)
+	}
+
+	return srv.URL
+}
+
+func TestRewrite(t *testing.T) {
+	repoURL := serveChart(t, "testdata/charts/app")
+
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"nginx:1.27": {
+				"cgr.dev/chainguard/nginx:1.27",
+			},
+			"prom/nginx-prometheus-exporter:1.4.0": {
+				"cgr.dev/chainguard/prometheus-nginx-exporter:1.4.0",
+			},
+			"envoyproxy/envoy:v1.32.0": {
+				"cgr.dev/chainguard/envoy:1.32",
+			},
+		},
+	}
+
+	before, err := os.ReadFile("testdata/application.before.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading before file: %s", err)
+	}
+	after, err := os.ReadFile("testdata/application.after.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading after file: %s", err)
+	}
+
+	input := strings.ReplaceAll(string(before), "REPO_URL", repoURL)
+	want := strings.ReplaceAll(string(after), "REPO_URL", repoURL)
+
+	got, err := Rewrite(t.Context(), m, []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error mapping applications: %s", err)
+	}
+
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestRewriteNoImages(t *testing.T) {
+	// The chart doesn't have any images, so there's nothing to add to the
+	// source
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"values.yaml": "replicas: 1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error writing chart: %s", err)
+		}
+	}
+	repoURL := serveChart(t, dir)
+
+	input := fmt.Sprintf(`apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: app
+spec:
+  source:
+    repoURL: %s
+    chart: app
+    targetRevision: 1.0.0
+`, repoURL)
+
+	got, err := Rewrite(t.Context(), &mockMapper{}, []byte(input))
+	if err != nil {
+		t.Fatalf("unexpected error mapping applications: %s", err)
+	}
+
+	if diff := cmp.Diff(input, string(got)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestResolveChart(t *testing.T) {
+	testCases := map[string]struct {
+		repoURL        string
+		targetRevision string
+		want           string
+		wantRepo       string
+		wantVersion    string
+	}{
+		"helm repository": {
+			repoURL:        "https://argoproj.github.io/argo-helm",
+			targetRevision: "9.1.0",
+			want:           "argo-cd",
+			wantRepo:       "https://argoproj.github.io/argo-helm",
+			wantVersion:    "9.1.0",
+		},
+		"oci registry": {
+			repoURL:        "ghcr.io/argoproj/argo-helm",
+			targetRevision: "9.1.0",
+			want:           "oci://ghcr.io/argoproj/argo-helm/argo-cd",
+			wantVersion:    "9.1.0",
+		},
+		"latest version": {
+			repoURL:        "https://argoproj.github.io/argo-helm",
+			targetRevision: "*",
+			want:           "argo-cd",
+			wantRepo:       "https://argoproj.github.io/argo-helm",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			source := &yaml.Node{
+				Kind: yaml.MappingNode,
+			}
+			yamlhelpers.AddNode([]string{"repoURL"}, source, &yaml.Node{Kind: yaml.ScalarNode, Value: tc.repoURL})
+			yamlhelpers.AddNode([]string{"chart"}, source, &yaml.Node{Kind: yaml.ScalarNode, Value: "argo-cd"})
+			yamlhelpers.AddNode([]string{"targetRevision"}, source, &yaml.Node{Kind: yaml.ScalarNode, Value: tc.targetRevision})
+
+			got := resolveChart(source)
+			if got.Name != tc.want || got.Repository != tc.wantRepo || got.Version != tc.wantVersion {
+				t.Errorf("unexpected chart: %+v", got)
+			}
+		})
+	}
+}
+
+func TestImageParameters(t *testing.T) {
+	var helmNode yaml.Node
+	if err := yaml.Unmarshal([]byte(`parameters:
+  - name: replicas
+    value: "3"
+  - name: image.tag
+    value: "1.26"
+  - name: metrics.enabled
+    value: "true"
+  - name: sidecars
+    value: "[]"
+`), &helmNode); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var overrides yaml.Node
+	if err := yaml.Unmarshal([]byte(`sidecars:
+  - name: proxy
+    image: cgr.dev/chainguard/envoy:1.32
+`), &overrides); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got := imageParameters(helmNode.Content[0], overrides.Content[0])
+	if diff := cmp.Diff([]string{"image.tag", "sidecars"}, got); diff != "" {
+		t.Errorf("unexpected parameters (-want +got):\n%s", diff)
+	}
+}
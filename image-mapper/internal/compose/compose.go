@@ -0,0 +1,212 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"gopkg.in/yaml.v3"
+)
+
+// UnmappedService is a service whose image wasn't mapped, and why
+type UnmappedService struct {
+	Service string
+	Image   string
+	Reason  string
+
+	// Line is the line the service is defined on
+	Line int
+}
+
+// Map maps the images of the services in a Compose file to Chainguard.
+// Variables in the images are interpolated from env.
+//
+// Only the images are rewritten. Everything else in the file, including
+// comments and formatting, is preserved.
+func Map(ctx context.Context, input []byte, env map[string]string, opts ...mapper.Option) ([]byte, []UnmappedService, error) {
+	m, err := NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return mapCompose(m, input, env)
+}
+
+// Rewrite maps the images in a Compose file with the provided mapper, so that
+// many files can be mapped without constructing a new mapper for each one
+func Rewrite(m mapper.Mapper, input []byte, env map[string]string) ([]byte, []UnmappedService, error) {
+	return mapCompose(m, input, env)
+}
+
+// ServiceImage is the image of a service in a Compose file
+type ServiceImage struct {
+	Service string
+
+	// Image is the image with any variables interpolated
+	Image string
+
+	// Line is the line the image is defined on
+	Line int
+
+	serviceLine int
+	node        *yaml.Node
+}
+
+// FindImages returns the images of the services in a Compose file, with
+// variables interpolated from env, and the services that don't have an image
+// that can be mapped
+func FindImages(input []byte, env map[string]string) ([]ServiceImage, []UnmappedService, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(input, &doc); err != nil {
+		return nil, nil, fmt.Errorf("decoding compose file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("provided input document is empty")
+	}
+
+	services := yamlhelpers.Lookup(doc.Content[0], "services")
+	if services == nil || services.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("no services found")
+	}
+
+	var (
+		images   []ServiceImage
+		unmapped []UnmappedService
+	)
+	for i := 0; i < len(services.Content); i += 2 {
+		service := services.Content[i].Value
+		line := services.Content[i].Line
+		node := services.Content[i+1]
+
+		image := yamlhelpers.Lookup(node, "image")
+
+		// The image of a service with a build section is the name given
+		// to the image that is built, rather than an image to pull
+		if yamlhelpers.Lookup(node, "build") != nil {
+			unmapped = append(unmapped, UnmappedService{
+				Service: service,
+				Image:   yamlhelpers.ScalarValue(image),
+				Reason:  "built from source",
+				Line:    line,
+			})
+			continue
+		}
+
+		if image == nil || image.Kind != yaml.ScalarNode || image.Value == "" {
+			unmapped = append(unmapped, UnmappedService{
+				Service: service,
+				Reason:  "no image",
+				Line:    line,
+			})
+			continue
+		}
+
+		resolved, err := interpolate(env, image.Value)
+		if err != nil {
+			unmapped = append(unmapped, UnmappedService{
+				Service: service,
+				Image:   image.Value,
+				Reason:  err.Error(),
+				Line:    line,
+			})
+			continue
+		}
+
+		images = append(images, ServiceImage{
+			Service: service,
+			Image:   resolved,
+			Line:    image.Line,
+
+			serviceLine: line,
+			node:        image,
+		})
+	}
+
+	return images, unmapped, nil
+}
+
+// mapCompose maps the images of the services in a Compose file with the
+// provided mapper
+func mapCompose(m mapper.Mapper, input []byte, env map[string]string) ([]byte, []UnmappedService, error) {
+	images, unmapped, err := FindImages(input, env)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var edits []yamlhelpers.Edit
+	for _, img := range images {
+		mapped, err := mapper.MapImage(m, img.Image)
+		if err != nil {
+			unmapped = append(unmapped, UnmappedService{
+				Service: img.Service,
+				Image:   img.Image,
+				Reason:  err.Error(),
+				Line:    img.serviceLine,
+			})
+			continue
+		}
+
+		// Images with variables are only rewritten if the image is
+		// the default of a variable that isn't set, because that can
+		// be rewritten without losing the variable. Otherwise, the
+		// variables would be replaced by the image they resolve to.
+		value := mapped.String()
+		if strings.Contains(img.node.Value, "$") {
+			var ok bool
+			value, ok = rewriteDefault(env, img.node.Value, value)
+			if !ok {
+				unmapped = append(unmapped, UnmappedService{
+					Service: img.Service,
+					Image:   img.node.Value,
+					Reason:  fmt.Sprintf("set by variables, so it isn't rewritten: %s maps to %s", img.Image, mapped),
+					Line:    img.serviceLine,
+				})
+				continue
+			}
+		}
+
+		edits = append(edits, yamlhelpers.Edit{
+			Node:  img.node,
+			Value: value,
+		})
+	}
+
+	// Report the unmapped services in the order they're defined
+	slices.SortStableFunc(unmapped, func(a, b UnmappedService) int {
+		return a.Line - b.Line
+	})
+
+	output, err := yamlhelpers.ApplyEdits(input, edits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("editing compose file: %w", err)
+	}
+
+	return output, unmapped, nil
+}
+
+// defaultPattern matches an image that is entirely a variable with a default,
+// like ${IMAGE:-nginx:1.25} or ${IMAGE-nginx:1.25}
+var defaultPattern = regexp.MustCompile(`^\$\{([A-Za-z_][A-Za-z0-9_]*)(:?-)([^}]*)\}$`)
+
+// rewriteDefault replaces the default of a variable that an image is entirely
+// made up of, like ${IMAGE:-nginx:1.25}, with the mapped image. It returns
+// false if the image isn't a variable with a default, or if the variable is
+// set, because then the default isn't the image that's used.
+func rewriteDefault(env map[string]string, image string, mapped string) (string, bool) {
+	match := defaultPattern.FindStringSubmatch(image)
+	if match == nil {
+		return "", false
+	}
+	name, op := match[1], match[2]
+
+	// With a colon, empty variables are treated as if they were unset
+	if val, ok := env[name]; ok && (val != "" || op == "-") {
+		return "", false
+	}
+
+	return fmt.Sprintf("${%s%s%s}", name, op, mapped), true
+}
@@ -0,0 +1,174 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type mockMapper struct {
+	mappings map[string][]string
+}
+
+func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
+	mapping := &mapper.Mapping{
+		Image:   img,
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
+}
+
+func TestMapCompose(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"nginx:1.25": {
+				"cgr.dev/chainguard/nginx:1.27",
+			},
+			"docker.io/library/postgres:16": {
+				"cgr.dev/chainguard/postgres:16",
+			},
+			"redis:7": {
+				"cgr.dev/chainguard/redis:7",
+			},
+			"python:3.13": {
+				"cgr.dev/chainguard/python:3.13",
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		env          map[string]string
+		wantUnmapped []UnmappedService
+	}{
+		"services": {
+			env: map[string]string{
+				"POSTGRES_TAG": "16",
+				"REGISTRY":     "",
+			},
+			wantUnmapped: []UnmappedService{
+				{Service: "db", Image: "${REGISTRY:-docker.io}/library/postgres:${POSTGRES_TAG}", Reason: "set by variables, so it isn't rewritten: docker.io/library/postgres:16 maps to cgr.dev/chainguard/postgres:16", Line: 7},
+				{Service: "cache", Image: "redis:${REDIS_TAG:-7}", Reason: "set by variables, so it isn't rewritten: redis:7 maps to cgr.dev/chainguard/redis:7", Line: 11},
+				{Service: "app", Image: "example/app:latest", Reason: "built from source", Line: 13},
+				{Service: "missing", Image: "${MISSING_IMAGE}", Reason: "variable MISSING_IMAGE is not set", Line: 18},
+				{Service: "unknown", Image: "unknown/image:1.0", Reason: "no results found", Line: 20},
+				{Service: "extended", Reason: "no image", Line: 22},
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			before, err := os.ReadFile(fmt.Sprintf("testdata/%s.before.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading before file: %s", err)
+			}
+
+			after, err := os.ReadFile(fmt.Sprintf("testdata/%s.after.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading after file: %s", err)
+			}
+
+			result, unmapped, err := mapCompose(m, before, tc.env)
+			if err != nil {
+				t.Fatalf("unexpected error mapping compose file: %s", err)
+			}
+
+			if diff := cmp.Diff(string(after), string(result)); diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tc.wantUnmapped, unmapped); diff != "" {
+				t.Errorf("unexpected unmapped services (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMapComposeNoServices(t *testing.T) {
+	if _, _, err := mapCompose(&mockMapper{}, []byte("volumes: {}\n"), nil); err == nil {
+		t.Error("expected error for a file without services")
+	}
+}
+
+func TestFindImages(t *testing.T) {
+	input, err := os.ReadFile("testdata/services.before.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %s", err)
+	}
+
+	images, _, err := FindImages(input, map[string]string{"POSTGRES_TAG": "16"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []ServiceImage{
+		{Service: "web", Image: "nginx:1.25", Line: 4},
+		{Service: "db", Image: "docker.io/library/postgres:16", Line: 8},
+		{Service: "cache", Image: "redis:7", Line: 12},
+		{Service: "worker", Image: "python:3.13", Line: 17},
+		{Service: "unknown", Image: "unknown/image:1.0", Line: 21},
+	}
+	if diff := cmp.Diff(want, images, cmpopts.IgnoreUnexported(ServiceImage{})); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+}
+
+func TestRewriteDefault(t *testing.T) {
+	testCases := map[string]struct {
+		image  string
+		env    map[string]string
+		want   string
+		wantOK bool
+	}{
+		"unset": {
+			image:  "${IMAGE:-nginx:1.25}",
+			want:   "${IMAGE:-cgr.dev/chainguard/nginx:1.25}",
+			wantOK: true,
+		},
+		"unset without colon": {
+			image:  "${IMAGE-nginx:1.25}",
+			want:   "${IMAGE-cgr.dev/chainguard/nginx:1.25}",
+			wantOK: true,
+		},
+		"empty": {
+			image:  "${IMAGE:-nginx:1.25}",
+			env:    map[string]string{"IMAGE": ""},
+			want:   "${IMAGE:-cgr.dev/chainguard/nginx:1.25}",
+			wantOK: true,
+		},
+		"empty without colon": {
+			image: "${IMAGE-nginx:1.25}",
+			env:   map[string]string{"IMAGE": ""},
+		},
+		"set": {
+			image: "${IMAGE:-nginx:1.25}",
+			env:   map[string]string{"IMAGE": "nginx:1.25"},
+		},
+		"part of the image": {
+			image: "nginx:${TAG:-1.25}",
+		},
+		"required": {
+			image: "${IMAGE:?image is required}",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			got, ok := rewriteDefault(tc.env, tc.image, "cgr.dev/chainguard/nginx:1.25")
+			if ok != tc.wantOK {
+				t.Fatalf("expected ok to be %t, got %t", tc.wantOK, ok)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
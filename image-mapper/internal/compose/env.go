@@ -0,0 +1,98 @@
+package compose
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadEnv reads variables from a .env file, in the format Compose expects:
+//
+//	# Comments and blank lines are ignored
+//	REGISTRY=docker.io
+//	export TAG="1.25"
+func ReadEnv(r io.Reader) (map[string]string, error) {
+	env := map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+
+		// Quotes are removed from quoted values. Otherwise, inline
+		// comments are removed.
+		switch {
+		case len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0]:
+			val = val[1 : len(val)-1]
+		default:
+			if i := strings.Index(val, " #"); i != -1 {
+				val = strings.TrimSpace(val[:i])
+			}
+		}
+
+		env[key] = val
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading env: %w", err)
+	}
+
+	return env, nil
+}
+
+// ReadEnvFile reads variables from a .env file on disk
+func ReadEnvFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening env file: %w", err)
+	}
+	defer f.Close()
+
+	env, err := ReadEnv(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return env, nil
+}
+
+// LoadEnv returns the variables to interpolate into a Compose file in dir.
+// They're read from envFile or, if it's empty, the optional .env file in dir.
+// Like Compose, variables in the environment take precedence.
+func LoadEnv(dir, envFile string) (map[string]string, error) {
+	env := map[string]string{}
+
+	path := envFile
+	if path == "" {
+		path = filepath.Join(dir, ".env")
+	}
+	fileEnv, err := ReadEnvFile(path)
+	switch {
+	case err == nil:
+		env = fileEnv
+	case envFile == "" && errors.Is(err, fs.ErrNotExist):
+		// The default env file is optional
+	default:
+		return nil, err
+	}
+
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		env[k] = v
+	}
+
+	return env, nil
+}
@@ -0,0 +1,100 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// varPattern matches the variables that Compose interpolates: $$ (an escaped
+// $), $VAR, ${VAR} and ${VAR<op><arg>}
+var varPattern = regexp.MustCompile(`\$(\$|[A-Za-z_][A-Za-z0-9_]*|\{[^}]*\})`)
+
+// interpolate resolves the variables in s from env, following the same rules
+// as Compose:
+//
+//	${VAR:-default}  default if VAR is unset or empty
+//	${VAR-default}   default if VAR is unset
+//	${VAR:?err}      error if VAR is unset or empty
+//	${VAR?err}       error if VAR is unset
+//	${VAR:+alt}      alt if VAR is set and not empty
+//	${VAR+alt}       alt if VAR is set
+//
+// Unlike Compose, which substitutes an empty string, it returns an error if a
+// variable is unset and has no default because the result is unlikely to be a
+// valid image.
+func interpolate(env map[string]string, s string) (string, error) {
+	var errs []string
+	result := varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$$" {
+			return "$"
+		}
+
+		content := strings.TrimPrefix(match, "$")
+		if strings.HasPrefix(content, "{") {
+			content = content[1 : len(content)-1]
+		}
+
+		val, err := resolveVar(env, content)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return match
+		}
+
+		return val
+	})
+	if len(errs) > 0 {
+		return "", errors.New(strings.Join(errs, ", "))
+	}
+
+	return result, nil
+}
+
+// resolveVar resolves the content of a variable, i.e VAR:-default
+func resolveVar(env map[string]string, content string) (string, error) {
+	i := strings.IndexFunc(content, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if i == -1 {
+		val, ok := env[content]
+		if !ok {
+			return "", fmt.Errorf("variable %s is not set", content)
+		}
+		return val, nil
+	}
+
+	name, op := content[:i], content[i:]
+
+	// With a colon, empty variables are treated as if they were unset
+	val, set := env[name]
+	if strings.HasPrefix(op, ":") {
+		set = set && val != ""
+		op = op[1:]
+	}
+	if op == "" {
+		return "", fmt.Errorf("invalid variable: %s", content)
+	}
+	arg := op[1:]
+
+	switch op[0] {
+	case '-':
+		if set {
+			return val, nil
+		}
+		return arg, nil
+	case '?':
+		if set {
+			return val, nil
+		}
+		return "", fmt.Errorf("variable %s is required: %s", name, arg)
+	case '+':
+		if set {
+			return arg, nil
+		}
+		return "", nil
+	}
+
+	return "", fmt.Errorf("invalid variable: %s", content)
+}
@@ -0,0 +1,87 @@
+package compose
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{
+		"REGISTRY": "ghcr.io",
+		"TAG":      "1.25",
+		"EMPTY":    "",
+	}
+
+	testCases := []struct {
+		input       string
+		want        string
+		expectError string
+	}{
+		{input: "nginx:1.25", want: "nginx:1.25"},
+		{input: "$REGISTRY/nginx:$TAG", want: "ghcr.io/nginx:1.25"},
+		{input: "${REGISTRY}/nginx:${TAG}", want: "ghcr.io/nginx:1.25"},
+		{input: "nginx:${UNSET:-latest}", want: "nginx:latest"},
+		{input: "nginx:${EMPTY:-latest}", want: "nginx:latest"},
+		{input: "nginx${EMPTY-:latest}", want: "nginx"},
+		{input: "nginx${UNSET-:latest}", want: "nginx:latest"},
+		{input: "nginx${TAG:+:stable}", want: "nginx:stable"},
+		{input: "nginx${EMPTY:+:stable}", want: "nginx"},
+		{input: "nginx${EMPTY+:stable}", want: "nginx:stable"},
+		{input: "nginx:${TAG:?tag is required}", want: "nginx:1.25"},
+		{input: "nginx:${UNSET:?tag is required}", expectError: "variable UNSET is required: tag is required"},
+		{input: "nginx:${EMPTY:?}", expectError: "variable EMPTY is required"},
+		{input: "nginx:${EMPTY?}", want: "nginx:"},
+		{input: "nginx:$UNSET", expectError: "variable UNSET is not set"},
+		{input: "nginx:$$TAG", want: "nginx:$TAG"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got, err := interpolate(env, tc.input)
+			if tc.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectError) {
+					t.Fatalf("expected error containing %q, got: %v", tc.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReadEnv(t *testing.T) {
+	env, err := ReadEnv(strings.NewReader(`
+# Registry settings
+REGISTRY=docker.io
+export TAG="1.25"
+SUFFIX='-slim'
+POSTGRES_TAG=16 # Latest supported
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := map[string]string{
+		"REGISTRY":     "docker.io",
+		"TAG":          "1.25",
+		"SUFFIX":       "-slim",
+		"POSTGRES_TAG": "16",
+	}
+	for k, v := range want {
+		if env[k] != v {
+			t.Errorf("expected %s=%q, got %q", k, v, env[k])
+		}
+	}
+	if len(env) != len(want) {
+		t.Errorf("expected %d variables, got %d", len(want), len(env))
+	}
+
+	if _, err := ReadEnv(strings.NewReader("INVALID")); err == nil {
+		t.Error("expected error for a line without =")
+	}
+}
@@ -0,0 +1,27 @@
+package compose
+
+import (
+	"context"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+)
+
+// NewMapper returns a mapper.Mapper configured specifically for mapping images
+// in Compose files
+func NewMapper(ctx context.Context, opts ...mapper.Option) (mapper.Mapper, error) {
+	defaultOpts := []mapper.Option{
+		mapper.WithIgnoreFns(
+			// Iamguarded images are only designed to be
+			// used with our Helm charts.
+			mapper.IgnoreIamguarded(),
+			// TODO: make it possible select only
+			// FIPS images
+			mapper.IgnoreTiers([]string{"FIPS"}),
+		),
+		// Services run the images as they are, so exclude -dev tags
+		// like we do for Kubernetes manifests.
+		mapper.WithTagFilters(mapper.TagFilterExcludeDev),
+	}
+
+	return mapper.NewMapper(ctx, append(defaultOpts, opts...)...)
+}
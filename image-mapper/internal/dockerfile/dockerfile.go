@@ -3,9 +3,11 @@ package dockerfile
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
@@ -19,10 +21,19 @@ func Map(ctx context.Context, input []byte, opts ...mapper.Option) ([]byte, erro
 		return nil, fmt.Errorf("constructing mapper: %w", err)
 	}
 
-	return mapDockerfile(m, input)
+	return mapDockerfile(m, input, nil)
 }
 
-func mapDockerfile(m mapper.Mapper, input []byte) ([]byte, error) {
+// Rewrite maps images in a Dockerfile with the provided mapper, so that many
+// Dockerfiles can be mapped without constructing a new mapper for each one.
+//
+// The build args override the default values of ARGs, like they do for
+// docker build --build-arg.
+func Rewrite(m mapper.Mapper, input []byte, buildArgs map[string]string) ([]byte, error) {
+	return mapDockerfile(m, input, buildArgs)
+}
+
+func mapDockerfile(m mapper.Mapper, input []byte, buildArgs map[string]string) ([]byte, error) {
 	res, err := parser.Parse(bytes.NewReader(input))
 	if err != nil {
 		return nil, fmt.Errorf("parse dockerfile: %w", err)
@@ -33,22 +44,51 @@ func mapDockerfile(m mapper.Mapper, input []byte) ([]byte, error) {
 	// RUN `--mount=type=bind,from=<image>` style instructions.
 	stages := map[string]struct{}{}
 
-	// Keep track of args so we can resolve them in `FROM` instructions.
+	// Keep track of args so we can resolve them in `FROM` instructions,
+	// and of those that are set by build args
 	args := map[string]string{}
+	overridden := map[string]bool{}
+
+	// Keep track of where the default values of args are, so that we can
+	// rewrite them when a `FROM` instruction gets its image from an arg,
+	// and the values we've rewritten them to
+	argDefaults := map[string]edit{}
+	argEdits := map[string]string{}
+
+	// Args used anywhere other than as the whole image of a `FROM`
+	// instruction can't be rewritten without breaking those uses
+	shared := sharedArgs(res.AST.Children)
 
 	// Track when we hit the first `FROM` instruction, because any ARGs after that
 	// point aren't usable in `FROM` instructions.
 	beforeFrom := true
 
-	// We'll compose the output by replacing lines in the input
-	output := string(input)
-
-	// Track the number of lines we've removed so we can adjust the line
-	// numbers we modify accordingly
-	offset := 0
+	// We'll compose the output by editing the image tokens in the input,
+	// so everything else is preserved exactly
+	src := newSource(input, res.EscapeToken)
+	var edits []edit
+
+	// Find the start of the final stage, because a stage aware mapper maps
+	// the images in it differently to those in the build stages
+	finalFrom := -1
+	for i, child := range res.AST.Children {
+		if strings.ToLower(child.Value) == "from" {
+			finalFrom = i
+		}
+	}
+	current := stage(m, false)
 
-	for _, child := range res.AST.Children {
-		var replacement string
+	for i, child := range res.AST.Children {
+		// Only instructions that reference images are tokenized,
+		// because they're the only ones we edit
+		var tokens []token
+		switch strings.ToLower(child.Value) {
+		case "arg", "from", "copy", "run":
+			tokens, err = src.tokens(child)
+			if err != nil {
+				return nil, fmt.Errorf("reading instruction: %w", err)
+			}
+		}
 
 		switch strings.ToLower(child.Value) {
 
@@ -61,17 +101,32 @@ func mapDockerfile(m mapper.Mapper, input []byte) ([]byte, error) {
 				continue
 			}
 
-			// Save the args, if there's a value
+			// Save the args, if there's a value. Build args take
+			// precedence over the default value.
 			for n := child.Next; n != nil; n = n.Next {
-				parts := strings.Split(n.Value, "=")
-				if len(parts) == 2 {
-					args[parts[0]] = strings.Trim(parts[1], "\"")
+				name, value, ok := parseArg(args, n.Value)
+				delete(argDefaults, name)
+				if override, ok := buildArgs[name]; ok {
+					args[name] = override
+					overridden[name] = true
+					continue
+				}
+				if !ok {
+					continue
+				}
+				args[name] = value
+
+				if e, ok := argDefault(tokens, name); ok {
+					argDefaults[name] = e
 				}
 			}
 
 		// FROM <image> [AS <stage>]
 		case "from":
 			beforeFrom = false
+			if i == finalFrom {
+				current = stage(m, true)
+			}
 			if child.Next == nil {
 				continue
 			}
@@ -92,13 +147,53 @@ func mapDockerfile(m mapper.Mapper, input []byte) ([]byte, error) {
 			from := resolveArgs(args, child.Next.Value)
 
 			// Map the image to Chainguard
-			img, err := mapper.MapImage(m, from)
+			img, err := mapper.MapImage(current, from)
+			// The registry being unavailable isn't a problem with
+			// the Dockerfile, so it fails the rewrite rather than
+			// leaving the image unpinned
+			if errors.Is(err, mapper.ErrResolveDigest) {
+				return nil, fmt.Errorf("mapping image: %s: %w", from, err)
+			}
 			if err != nil {
 				log.Printf("WARN: error mapping image: %s: %s", from, err)
 				continue
 			}
 
-			replacement = strings.ReplaceAll(child.Original, child.Next.Value, img.String())
+			// If the image comes from build args, then neither the
+			// instruction nor the defaults of the args can be
+			// rewritten to the mapped image, because the build args
+			// would still take precedence over them
+			if names := argNames(child.Next.Value, overridden); len(names) > 0 {
+				log.Printf("WARN: line %d: %s is set by the build args %s, so it isn't rewritten: %s maps to %s", child.StartLine, child.Next.Value, strings.Join(names, ", "), from, img)
+				continue
+			}
+
+			// If the image comes from the default value of an
+			// arg, then rewrite the default, so that the arg can
+			// still be overridden. If another stage has already
+			// rewritten it to a different image, then fall back
+			// to replacing the image in this instruction.
+			if name, ok := argRef(child.Next.Value); ok && args[name] != "" && !shared[name] {
+				if e, ok := argDefaults[name]; ok {
+					rewritten, done := argEdits[name]
+					if !done {
+						e.value = img.String()
+						edits = append(edits, e)
+						argEdits[name] = e.value
+						continue
+					}
+					if rewritten == img.String() {
+						continue
+					}
+				}
+			}
+
+			tok, ok := findToken(tokens, child.Next.Value)
+			if !ok {
+				log.Printf("WARN: line %d: can't find image in instruction: %s", child.StartLine, child.Next.Value)
+				continue
+			}
+			edits = append(edits, edit{start: tok.start, end: tok.end, value: img.String()})
 
 		// COPY --from=<image>
 		case "copy":
@@ -114,32 +209,38 @@ func mapDockerfile(m mapper.Mapper, input []byte) ([]byte, error) {
 					continue
 				}
 
-				img, err := mapper.MapImage(m, from)
+				img, err := mapper.MapImage(current, from)
+				if errors.Is(err, mapper.ErrResolveDigest) {
+					return nil, fmt.Errorf("mapping image: %s: %w", from, err)
+				}
 				if err != nil {
 					log.Printf("WARN: error mapping image: %s: %s", from, err)
 					continue
 				}
 
-				replacement = strings.ReplaceAll(child.Original, flag, fmt.Sprintf("--from=%s", img))
+				tok, ok := findToken(tokens, flag)
+				if !ok {
+					log.Printf("WARN: line %d: can't find flag in instruction: %s", child.StartLine, flag)
+					break
+				}
+				edits = append(edits, edit{start: tok.start + len("--from="), end: tok.end, value: img.String()})
 
 				break
 			}
 
 		// RUN --mount=type=bind,target=/usr/bin,from=python
 		case "run":
-			original := child.Original
-
 			for _, flag := range child.Flags {
 				if !strings.HasPrefix(flag, "--mount=") {
 					continue
 				}
 
 				// Extract the image from a from=<image> option
-				match := fromPattern.FindStringSubmatch(flag)
-				if len(match) < 2 {
+				match := fromPattern.FindStringSubmatchIndex(flag)
+				if len(match) < 4 {
 					continue
 				}
-				from := match[1]
+				from := flag[match[2]:match[3]]
 
 				// Skip if from= refers to a stage, rather than
 				// an image
@@ -147,73 +248,251 @@ func mapDockerfile(m mapper.Mapper, input []byte) ([]byte, error) {
 					continue
 				}
 
-				img, err := mapper.MapImage(m, from)
+				img, err := mapper.MapImage(current, from)
+				if errors.Is(err, mapper.ErrResolveDigest) {
+					return nil, fmt.Errorf("mapping image: %s: %w", from, err)
+				}
 				if err != nil {
 					log.Printf("WARN: error mapping image: %s: %s", from, err)
 					continue
 				}
-				// Replace the from= option in the flag
-				// with the mapped image
-				modifiedFlag := strings.ReplaceAll(flag, fmt.Sprintf("from=%s", from), fmt.Sprintf("from=%s", img))
 
-				// Replace the flag with the modified flag in
-				// the original line
-				original = strings.ReplaceAll(original, flag, modifiedFlag)
+				// Replace only the image in the from= option
+				tok, ok := findToken(tokens, flag)
+				if !ok {
+					log.Printf("WARN: line %d: can't find flag in instruction: %s", child.StartLine, flag)
+					continue
+				}
+				edits = append(edits, edit{start: tok.start + match[2], end: tok.start + match[3], value: img.String()})
+			}
+		}
+	}
+
+	return applyEdits(input, edits), nil
+
+}
+
+// Image is an image referenced by a Dockerfile
+type Image struct {
+	// Image is the image reference, with any args resolved
+	Image string
+
+	// Instruction is the instruction that references the image, i.e FROM
+	Instruction string
+
+	// Line is the line the instruction starts on
+	Line int
+}
+
+// FindImages returns the images referenced by the FROM, COPY --from and
+// RUN --mount instructions in a Dockerfile. References to other stages are
+// ignored.
+func FindImages(input []byte) ([]Image, error) {
+	res, err := parser.Parse(bytes.NewReader(input))
+	if err != nil {
+		return nil, fmt.Errorf("parse dockerfile: %w", err)
+	}
+
+	var (
+		images     []Image
+		stages     = map[string]struct{}{}
+		args       = map[string]string{}
+		beforeFrom = true
+	)
+	for _, child := range res.AST.Children {
+		add := func(from string) {
+			if _, ok := stages[from]; ok {
+				return
+			}
+			images = append(images, Image{
+				Image:       from,
+				Instruction: strings.ToUpper(child.Value),
+				Line:        child.StartLine,
+			})
+		}
+
+		switch strings.ToLower(child.Value) {
+		case "arg":
+			if !beforeFrom {
+				continue
+			}
+			for n := child.Next; n != nil; n = n.Next {
+				if name, value, ok := parseArg(args, n.Value); ok {
+					args[name] = value
+				}
+			}
 
+		case "from":
+			beforeFrom = false
+			if child.Next == nil {
+				continue
 			}
 
-			if original != child.Original {
-				replacement = original
+			// Resolve the image before recording the stage name, so
+			// that FROM base AS base refers to the image
+			add(resolveArgs(args, child.Next.Value))
+
+			for n := child.Next; n != nil; n = n.Next {
+				if strings.ToLower(n.Value) == "as" && n.Next != nil {
+					stages[n.Next.Value] = struct{}{}
+				}
 			}
+
+		case "copy":
+			for _, flag := range child.Flags {
+				if from, ok := strings.CutPrefix(flag, "--from="); ok {
+					add(from)
+				}
+			}
+
+		case "run":
+			for _, flag := range child.Flags {
+				if !strings.HasPrefix(flag, "--mount=") {
+					continue
+				}
+				if match := fromPattern.FindStringSubmatch(flag); len(match) == 2 {
+					add(match[1])
+				}
+			}
+		}
+	}
+
+	return images, nil
+}
+
+// fromPattern extracts images in `from=` options in `RUN --mount` instructions
+var fromPattern = regexp.MustCompile(`\bfrom=([^,]+)`)
+
+// argPattern identifies arguments like `${ARG_NAME}` or `$ARG_NAME`
+var argPattern = regexp.MustCompile(`\$(?:\{([^}]+)\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// argRefPattern identifies values that are entirely an argument, like
+// `${ARG_NAME}`, `$ARG_NAME` or `${ARG_NAME:-default}`
+var argRefPattern = regexp.MustCompile(`^\$(?:\{([A-Za-z_][A-Za-z0-9_]*)(?::-[^}]*)?\}|([A-Za-z_][A-Za-z0-9_]*))$`)
+
+// argRef returns the name of the argument, if the value is entirely an
+// argument
+func argRef(value string) (string, bool) {
+	match := argRefPattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+
+	return match[1] + match[2], true
+}
+
+// parseArg returns the name of an arg declared in an `ARG` instruction and
+// its default value, if it has one, with the args it references resolved
+func parseArg(args map[string]string, decl string) (string, string, bool) {
+	name, value, ok := strings.Cut(decl, "=")
+	if !ok {
+		return name, "", false
+	}
+
+	return name, resolveArgs(args, strings.Trim(value, "\"")), true
+}
+
+// argNames returns the names of the args in the filter that are referenced in
+// a value, sorted
+func argNames(value string, filter map[string]bool) []string {
+	var names []string
+	for _, match := range argPattern.FindAllStringSubmatch(value, -1) {
+		name, _, _ := strings.Cut(match[1]+match[2], ":")
+		if filter[name] && !slices.Contains(names, name) {
+			names = append(names, name)
 		}
+	}
+	slices.Sort(names)
+
+	return names
+}
 
-		if replacement == "" {
+// argDefault returns an edit covering the default value of the arg in the
+// tokens of an `ARG` instruction. Quotes around the value are preserved.
+func argDefault(tokens []token, name string) (edit, bool) {
+	for _, tok := range tokens[min(1, len(tokens)):] {
+		value, ok := strings.CutPrefix(tok.value, name+"=")
+		if !ok {
 			continue
 		}
 
-		// If the original instruction was spread over multiple lines
-		// then we will flatten it onto one line and remove the other
-		// lines to keep things tidy.
-		//
-		// One consequence of this is that we need to adjust the line
-		// numbers we write to after that point to account for the
-		// offset.
-		output = replaceLines(output, child.StartLine-offset, child.EndLine-offset, replacement)
-		offset = offset + (child.EndLine - child.StartLine)
+		e := edit{start: tok.end - len(value), end: tok.end}
+		if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+			e.start++
+			e.end--
+		}
+
+		return e, true
 	}
 
-	return []byte(output), nil
+	return edit{}, false
 }
 
-// fromPattern extracts images in `from=` options in `RUN --mount` instructions
-var fromPattern = regexp.MustCompile(`\bfrom=([^,]+)`)
+// sharedArgs returns the args that are used by the default values of other
+// args, or as part of the image in a `FROM` instruction, rather than the whole
+// image
+func sharedArgs(children []*parser.Node) map[string]bool {
+	shared := map[string]bool{}
+	for _, child := range children {
+		var values []string
+		switch strings.ToLower(child.Value) {
+		case "arg":
+			for n := child.Next; n != nil; n = n.Next {
+				if _, value, ok := strings.Cut(n.Value, "="); ok {
+					values = append(values, value)
+				}
+			}
+		case "from":
+			if child.Next == nil {
+				continue
+			}
+			if _, ok := argRef(child.Next.Value); ok {
+				continue
+			}
+			values = append(values, child.Next.Value)
+		}
 
-// argPattern identifies arguments like `${ARG_NAME}`
-var argPattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+		for _, value := range values {
+			for _, match := range argPattern.FindAllStringSubmatch(value, -1) {
+				name, _, _ := strings.Cut(match[1]+match[2], ":")
+				shared[name] = true
+			}
+		}
+	}
+
+	return shared
+}
 
-// resolveArgs resolves args in a Dockerfile line
+// resolveArgs resolves args in a Dockerfile line. Args can be referenced as
+// `$ARG`, `${ARG}`, `${ARG:-default}` (the default if the arg isn't set) or
+// `${ARG:+alternative}` (the alternative if the arg is set). References to
+// args that aren't set, without a default, are left as they are.
 func resolveArgs(args map[string]string, line string) string {
 	return argPattern.ReplaceAllStringFunc(line, func(match string) string {
-		// Extract the inside of ${...}
-		content := match[2 : len(match)-1]
-
-		// Check for default syntax: VAR:-default
-		argName := content
-		argDefault := ""
+		// Extract the name from $ARG_NAME or the inside of ${...}
+		content := strings.TrimPrefix(match, "$")
+		if strings.HasPrefix(content, "{") {
+			content = content[1 : len(content)-1]
+		}
 
-		parts := strings.Split(content, ":-")
-		if len(parts) > 1 {
-			argName = parts[0]
-			argDefault = parts[1]
+		if argName, alternative, ok := strings.Cut(content, ":+"); ok {
+			if args[argName] != "" {
+				return alternative
+			}
+			return ""
 		}
 
-		// If the variable exists in map, use it
-		if val, ok := args[argName]; ok {
+		// Check for default syntax: VAR:-default
+		argName, argDefault, hasDefault := strings.Cut(content, ":-")
+
+		// If the variable is set, use it. The default is also used
+		// if it's set to an empty value.
+		if val, ok := args[argName]; ok && (val != "" || !hasDefault) {
 			return val
 		}
 
 		// Otherwise, if a default is provided, use it
-		if argDefault != "" {
+		if hasDefault {
 			return argDefault
 		}
 
@@ -221,18 +500,3 @@ func resolveArgs(args map[string]string, line string) string {
 		return match
 	})
 }
-
-// replaceLines replaces the indicated lines in the output with the replacement
-// value
-func replaceLines(output string, start, end int, replacement string) string {
-	lines := strings.Split(output, "\n")
-	if start < 0 || end >= len(lines) || start > end {
-		return output
-	}
-
-	lines[start-1] = replacement
-
-	lines = append(lines[:start], lines[end:]...)
-
-	return strings.Join(lines, "\n")
-}
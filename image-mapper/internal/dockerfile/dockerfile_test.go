@@ -14,10 +14,15 @@ type mockMapper struct {
 }
 
 func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
-	return &mapper.Mapping{
+	mapping := &mapper.Mapping{
 		Image:   img,
-		Results: m.mappings[img],
-	}, nil
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
 }
 
 func TestMapDockerfile(t *testing.T) {
@@ -41,6 +46,9 @@ func TestMapDockerfile(t *testing.T) {
 		"args":        {},
 		"copyfrom":    {},
 		"runmount":    {},
+		"formatting":  {},
+		"escape":      {},
+		"argdefault":  {},
 	}
 
 	for name := range testCases {
@@ -55,7 +63,7 @@ func TestMapDockerfile(t *testing.T) {
 				t.Fatalf("unexpected error reading before file: %s", err)
 			}
 
-			result, err := mapDockerfile(m, before)
+			result, err := mapDockerfile(m, before, nil)
 			if err != nil {
 				t.Fatalf("unexpected error mapping dockerfile: %s", err)
 			}
@@ -66,3 +74,187 @@ func TestMapDockerfile(t *testing.T) {
 		})
 	}
 }
+
+func TestMapDockerfileStages(t *testing.T) {
+	m := &stageMapper{
+		build: &mockMapper{
+			mappings: map[string][]string{
+				"golang:1.24": {"cgr.dev/chainguard/go:1.24-dev"},
+				"python:3.13": {"cgr.dev/chainguard/python:3.13-dev"},
+				"node:22":     {"cgr.dev/chainguard/node:22-dev"},
+			},
+		},
+		final: &mockMapper{
+			mappings: map[string][]string{
+				"golang:1.24": {"cgr.dev/chainguard/go:1.24"},
+				"python:3.13": {"cgr.dev/chainguard/python:3.13"},
+				"node:22":     {"cgr.dev/chainguard/node:22"},
+			},
+		},
+	}
+
+	before, err := os.ReadFile("testdata/stages.before.Dockerfile")
+	if err != nil {
+		t.Fatalf("unexpected error reading before file: %s", err)
+	}
+
+	after, err := os.ReadFile("testdata/stages.after.Dockerfile")
+	if err != nil {
+		t.Fatalf("unexpected error reading after file: %s", err)
+	}
+
+	result, err := mapDockerfile(m, before, nil)
+	if err != nil {
+		t.Fatalf("unexpected error mapping dockerfile: %s", err)
+	}
+
+	if diff := cmp.Diff(string(after), string(result)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestMapDockerfileArgs(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"python":      {"cgr.dev/chainguard/python:latest-dev"},
+			"python:3.13": {"cgr.dev/chainguard/python:3.13-dev"},
+			"python:3.12": {"cgr.dev/chainguard/python:3.12-dev"},
+		},
+	}
+
+	testCases := []struct {
+		name      string
+		mapper    mapper.Mapper
+		input     string
+		buildArgs map[string]string
+		want      string
+	}{
+		{
+			name:  "default",
+			input: "ARG IMAGE=python:3.13\nFROM ${IMAGE}\n",
+			want:  "ARG IMAGE=cgr.dev/chainguard/python:3.13-dev\nFROM ${IMAGE}\n",
+		},
+		{
+			name:      "build arg overrides default",
+			input:     "ARG IMAGE=python:3.13\nFROM ${IMAGE}\n",
+			buildArgs: map[string]string{"IMAGE": "python:3.12"},
+			want:      "ARG IMAGE=python:3.13\nFROM ${IMAGE}\n",
+		},
+		{
+			name:      "build arg without default",
+			input:     "ARG TAG\nFROM python:$TAG\n",
+			buildArgs: map[string]string{"TAG": "3.12"},
+			want:      "ARG TAG\nFROM python:$TAG\n",
+		},
+		{
+			name:      "build arg isn't declared",
+			input:     "FROM python:${TAG:-3.13}\n",
+			buildArgs: map[string]string{"TAG": "3.12"},
+			want:      "FROM cgr.dev/chainguard/python:3.13-dev\n",
+		},
+		{
+			name:  "arg used by another arg",
+			input: "ARG IMAGE=python\nARG FULL=${IMAGE}:3.13\nFROM ${IMAGE}\nFROM ${FULL}\n",
+			want:  "ARG IMAGE=python\nARG FULL=cgr.dev/chainguard/python:3.13-dev\nFROM cgr.dev/chainguard/python:latest-dev\nFROM ${FULL}\n",
+		},
+		{
+			name: "arg mapped differently by stages",
+			mapper: &stageMapper{
+				build: m,
+				final: &mockMapper{
+					mappings: map[string][]string{
+						"python:3.13": {"cgr.dev/chainguard/python:3.13"},
+					},
+				},
+			},
+			input: "ARG IMAGE=python:3.13\nFROM ${IMAGE} AS build\nFROM ${IMAGE}\n",
+			want:  "ARG IMAGE=cgr.dev/chainguard/python:3.13-dev\nFROM ${IMAGE} AS build\nFROM cgr.dev/chainguard/python:3.13\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mm mapper.Mapper = m
+			if tc.mapper != nil {
+				mm = tc.mapper
+			}
+
+			got, err := mapDockerfile(mm, []byte(tc.input), tc.buildArgs)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("unexpected result (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolveArgs(t *testing.T) {
+	args := map[string]string{
+		"IMAGE": "python",
+		"TAG":   "3.13",
+		"EMPTY": "",
+	}
+
+	testCases := map[string]string{
+		"${IMAGE}:${TAG}":                      "python:3.13",
+		"$IMAGE:$TAG":                          "python:3.13",
+		"$IMAGE-slim":                          "python-slim",
+		"${MISSING}":                           "${MISSING}",
+		"$MISSING":                             "$MISSING",
+		"${MISSING:-docker.io}/python":         "docker.io/python",
+		"${EMPTY:-docker.io}/python":           "docker.io/python",
+		"python${EMPTY}":                       "python",
+		"${TAG:+registry.internal/}python":     "registry.internal/python",
+		"${MISSING:+registry.internal/}python": "python",
+	}
+
+	for input, want := range testCases {
+		t.Run(input, func(t *testing.T) {
+			if got := resolveArgs(args, input); got != want {
+				t.Errorf("expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestFindImages(t *testing.T) {
+	testCases := map[string][]Image{
+		"args": {
+			{Image: "python", Instruction: "FROM", Line: 4},
+			{Image: "${IGNORED}", Instruction: "FROM", Line: 5},
+			{Image: "python:3.13", Instruction: "FROM", Line: 6},
+			{Image: "docker.io/python", Instruction: "FROM", Line: 14},
+		},
+		"copyfrom": {
+			{Image: "python:3.13", Instruction: "FROM", Line: 1},
+			{Image: "python:3.13", Instruction: "FROM", Line: 9},
+			{Image: "python:3.13", Instruction: "COPY", Line: 12},
+		},
+		"runmount": {
+			{Image: "python:3.13", Instruction: "FROM", Line: 1},
+			{Image: "python:3.13", Instruction: "RUN", Line: 7},
+			{Image: "docker.io/python", Instruction: "RUN", Line: 18},
+		},
+	}
+
+	for name, want := range testCases {
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(fmt.Sprintf("testdata/%s.before.Dockerfile", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading file: %s", err)
+			}
+
+			got, err := FindImages(input)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("unexpected images (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
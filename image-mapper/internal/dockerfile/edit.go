@@ -0,0 +1,157 @@
+package dockerfile
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+// edit replaces the bytes between start and end in a Dockerfile with value
+type edit struct {
+	start, end int
+	value      string
+}
+
+// applyEdits applies the edits to the input. Everything other than the edited
+// bytes is left as it is.
+func applyEdits(input []byte, edits []edit) []byte {
+	// Apply the edits from the end of the input backwards, so the offsets
+	// of the earlier edits remain valid
+	slices.SortFunc(edits, func(a, b edit) int {
+		return b.start - a.start
+	})
+
+	output := slices.Clone(input)
+	for _, e := range edits {
+		output = slices.Concat(output[:e.start], []byte(e.value), output[e.end:])
+	}
+
+	return output
+}
+
+// token is a word in an instruction, and its position in the Dockerfile
+type token struct {
+	value      string
+	start, end int
+}
+
+// source is a Dockerfile, split into lines, so that the tokens of the
+// instructions in the AST can be located
+type source struct {
+	input  []byte
+	lines  [][2]int
+	escape byte
+}
+
+// newSource returns the source of a Dockerfile parsed with the escape token
+func newSource(input []byte, escape rune) *source {
+	s := &source{
+		input:  input,
+		escape: byte(escape),
+	}
+	start := 0
+	for i, b := range input {
+		if b == '\n' {
+			s.lines = append(s.lines, [2]int{start, i})
+			start = i + 1
+		}
+	}
+	s.lines = append(s.lines, [2]int{start, len(input)})
+
+	return s
+}
+
+// tokens returns the words of the instruction, with their positions.
+//
+// The instruction is read from the line it starts on until the end of its
+// last continuation line. Comments and empty lines between continuation lines
+// are skipped, like they are by the parser, and so are the bodies of heredocs,
+// which follow the instruction.
+func (s *source) tokens(node *parser.Node) ([]token, error) {
+	if node.StartLine < 1 || node.StartLine > len(s.lines) {
+		return nil, fmt.Errorf("line %d: out of range", node.StartLine)
+	}
+
+	var tokens []token
+	for i := node.StartLine - 1; i < len(s.lines) && i < node.EndLine; i++ {
+		start, end := s.lines[i][0], s.lines[i][1]
+		line := s.input[start:end]
+
+		if i > node.StartLine-1 && (isComment(line) || len(bytes.TrimSpace(line)) == 0) {
+			continue
+		}
+
+		// Drop the escape character from continued lines, so that
+		// it isn't mistaken for part of a word
+		content := bytes.TrimRight(line, " \t\r")
+		continued := s.isContinued(content)
+		if continued {
+			content = content[:len(content)-1]
+		}
+
+		tokens = append(tokens, splitWords(content, start)...)
+		if !continued {
+			break
+		}
+	}
+
+	return tokens, nil
+}
+
+// isContinued returns true if the line, without trailing whitespace, is
+// continued on the next line
+func (s *source) isContinued(line []byte) bool {
+	n := len(line)
+
+	return n > 0 && line[n-1] == s.escape && (n == 1 || line[n-2] != s.escape)
+}
+
+// isComment returns true if the line is a comment
+func isComment(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, " \t"), []byte("#"))
+}
+
+// splitWords splits the line into words separated by whitespace. offset is the
+// position of the line in the Dockerfile.
+func splitWords(line []byte, offset int) []token {
+	var (
+		tokens []token
+		start  = -1
+	)
+	for i := 0; i <= len(line); i++ {
+		if i < len(line) && !isSpace(line[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{
+				value: string(line[start:i]),
+				start: offset + start,
+				end:   offset + i,
+			})
+			start = -1
+		}
+	}
+
+	return tokens
+}
+
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r'
+}
+
+// findToken returns the first token, after the instruction itself, with the
+// value
+func findToken(tokens []token, value string) (token, bool) {
+	for _, t := range tokens[min(1, len(tokens)):] {
+		if t.value == value {
+			return t, true
+		}
+	}
+
+	return token{}, false
+}
@@ -0,0 +1,85 @@
+package dockerfile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/moby/buildkit/frontend/dockerfile/parser"
+)
+
+func TestSourceTokens(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "single line",
+			input: "FROM  python:3.13\tAS build\n",
+			want:  []string{"FROM", "python:3.13", "AS", "build"},
+		},
+		{
+			name:  "continuation lines",
+			input: "RUN --mount=from=python \\\n  # from=node\n\n  echo \\ \n  done\n",
+			want:  []string{"RUN", "--mount=from=python", "echo", "done"},
+		},
+		{
+			name:  "heredoc",
+			input: "RUN --mount=from=python <<EOF\nFROM node\nEOF\n",
+			want:  []string{"RUN", "--mount=from=python", "<<EOF"},
+		},
+		{
+			name:  "crlf",
+			input: "COPY --from=python \\\r\n  /a /b\r\n",
+			want:  []string{"COPY", "--from=python", "/a", "/b"},
+		},
+		{
+			name:  "escape directive",
+			input: "# escape=`\nFROM python `\n  AS build\n",
+			want:  []string{"FROM", "python", "AS", "build"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := []byte(tc.input)
+			res, err := parser.Parse(bytes.NewReader(input))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			tokens, err := newSource(input, res.EscapeToken).tokens(res.AST.Children[0])
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var got []string
+			for _, tok := range tokens {
+				// The positions of the tokens must match the input
+				if value := string(input[tok.start:tok.end]); value != tok.value {
+					t.Errorf("token %q is at the position of %q", tok.value, value)
+				}
+				got = append(got, tok.value)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected tokens (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	input := []byte("FROM python AS python\n")
+	got := applyEdits(input, []edit{
+		{start: 5, end: 11, value: "cgr.dev/chainguard/python"},
+		{start: 15, end: 21, value: "base"},
+	})
+
+	if diff := cmp.Diff("FROM cgr.dev/chainguard/python AS base\n", string(got)); diff != "" {
+		t.Errorf("unexpected output (-want +got):\n%s", diff)
+	}
+	if string(input) != "FROM python AS python\n" {
+		t.Errorf("input was modified: %s", input)
+	}
+}
@@ -2,6 +2,7 @@ package dockerfile
 
 import (
 	"context"
+	"slices"
 
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
 )
@@ -25,3 +26,50 @@ func NewMapper(ctx context.Context, opts ...mapper.Option) (mapper.Mapper, error
 
 	return mapper.NewMapper(ctx, append(defaultOpts, opts...)...)
 }
+
+// stageMapper maps images in the build stages of a Dockerfile to -dev tags,
+// which have a shell and package manager, and images in the final stage to
+// non-dev tags
+type stageMapper struct {
+	build mapper.Mapper
+	final mapper.Mapper
+}
+
+// NewStageMapper returns a mapper that prefers -dev tags for the images in the
+// build stages of a Dockerfile and excludes them from the final stage. Outside
+// of a Dockerfile, images are mapped as if they were in the final stage.
+//
+// Any tag filters in the options are overridden.
+func NewStageMapper(ctx context.Context, opts ...mapper.Option) (mapper.Mapper, error) {
+	// The options are cloned, so that the two mappers don't share the
+	// backing array of the caller's slice
+	build, err := NewMapper(ctx, append(slices.Clone(opts), mapper.WithTagFilters(mapper.TagFilterPreferDev))...)
+	if err != nil {
+		return nil, err
+	}
+	final, err := NewMapper(ctx, append(slices.Clone(opts), mapper.WithTagFilters(mapper.TagFilterExcludeDev))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stageMapper{build: build, final: final}, nil
+}
+
+// Map maps the image as if it was in the final stage
+func (m *stageMapper) Map(image string) (*mapper.Mapping, error) {
+	return m.final.Map(image)
+}
+
+// stage returns the mapper for images in a stage of a Dockerfile. Mappers
+// that aren't stage aware map every stage the same way.
+func stage(m mapper.Mapper, final bool) mapper.Mapper {
+	sm, ok := m.(*stageMapper)
+	if !ok {
+		return m
+	}
+	if final {
+		return sm.final
+	}
+
+	return sm.build
+}
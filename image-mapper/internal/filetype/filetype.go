@@ -0,0 +1,48 @@
+package filetype
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// IsDockerfile matches Dockerfiles, including those with a prefix or suffix
+// like Dockerfile.dev or app.Dockerfile
+func IsDockerfile(path string) bool {
+	base := strings.ToLower(filepath.Base(path))
+	for _, name := range []string{"dockerfile", "containerfile"} {
+		if base == name || strings.HasPrefix(base, name+".") || strings.HasSuffix(base, "."+name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsYAML matches YAML files
+func IsYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// IsValuesFile matches Helm values files, like values.yaml or
+// values-prod.yaml
+func IsValuesFile(path string) bool {
+	return IsYAML(path) && hasPrefix(path, "values")
+}
+
+// IsComposeFile matches Compose files, like docker-compose.yaml or
+// compose.override.yml
+func IsComposeFile(path string) bool {
+	return IsYAML(path) && (hasPrefix(path, "docker-compose") || hasPrefix(path, "compose"))
+}
+
+// IsHelmfile matches helmfiles, like helmfile.yaml or helmfile.prod.yaml
+func IsHelmfile(path string) bool {
+	return IsYAML(path) && hasPrefix(path, "helmfile")
+}
+
+// hasPrefix returns true if the name of the file at path starts with the
+// prefix, ignoring case
+func hasPrefix(path string, prefix string) bool {
+	return strings.HasPrefix(strings.ToLower(filepath.Base(path)), prefix)
+}
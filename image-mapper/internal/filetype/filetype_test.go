@@ -0,0 +1,48 @@
+package filetype
+
+import "testing"
+
+func TestFileTypes(t *testing.T) {
+	testCases := map[string]struct {
+		dockerfile bool
+		yaml       bool
+		values     bool
+		compose    bool
+		helmfile   bool
+	}{
+		"Dockerfile":                      {dockerfile: true},
+		"app/Dockerfile.dev":              {dockerfile: true},
+		"app.Dockerfile":                  {dockerfile: true},
+		"Containerfile":                   {dockerfile: true},
+		"dockerfiles/README.md":           {},
+		"deploy/deployment.yaml":          {yaml: true},
+		"deploy/deployment.YML":           {yaml: true},
+		"chart/values.yaml":               {yaml: true, values: true},
+		"chart/values-prod.yml":           {yaml: true, values: true},
+		"docker-compose.yaml":             {yaml: true, compose: true},
+		"compose.override.yml":            {yaml: true, compose: true},
+		"helmfile.yaml":                   {yaml: true, helmfile: true},
+		"environments/helmfile.prod.yaml": {yaml: true, helmfile: true},
+		"helmfile.yaml.gotmpl":            {},
+	}
+
+	for path, tc := range testCases {
+		t.Run(path, func(t *testing.T) {
+			if got := IsDockerfile(path); got != tc.dockerfile {
+				t.Errorf("IsDockerfile: expected %t, got %t", tc.dockerfile, got)
+			}
+			if got := IsYAML(path); got != tc.yaml {
+				t.Errorf("IsYAML: expected %t, got %t", tc.yaml, got)
+			}
+			if got := IsValuesFile(path); got != tc.values {
+				t.Errorf("IsValuesFile: expected %t, got %t", tc.values, got)
+			}
+			if got := IsComposeFile(path); got != tc.compose {
+				t.Errorf("IsComposeFile: expected %t, got %t", tc.compose, got)
+			}
+			if got := IsHelmfile(path); got != tc.helmfile {
+				t.Errorf("IsHelmfile: expected %t, got %t", tc.helmfile, got)
+			}
+		})
+	}
+}
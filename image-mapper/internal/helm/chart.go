@@ -5,36 +5,46 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
 	"gopkg.in/yaml.v3"
 	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
 	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
 )
 
 // ChartDescriptor describes a chart
 type ChartDescriptor struct {
+	// Name is a chart reference (i.e argocd/argo-cd), the name of a chart
+	// in Repository, an OCI reference (i.e
+	// oci://ghcr.io/argoproj/argo-helm/argo-cd) or the path to a chart
+	// directory or packaged chart on disk
 	Name       string
 	Repository string
 	Version    string
+
+	// Username and Password authenticate with the chart repository or
+	// OCI registry. Otherwise, the credentials from 'helm registry login'
+	// are used for OCI registries.
+	Username string
+	Password string
+
+	// PlainHTTP pulls OCI charts over HTTP, rather than HTTPS
+	PlainHTTP bool
 }
 
 // MapChart extracts image related values from a Helm chart and maps them to
 // Chainguard
 func MapChart(ctx context.Context, chart ChartDescriptor, opts ...mapper.Option) ([]byte, error) {
-	// Create a temporary directory where we'll untar the chart
-	dir, err := os.MkdirTemp("", "")
+	dir, cleanup, err := fetchChart(ctx, chart)
 	if err != nil {
-		return nil, fmt.Errorf("creating temporary directory: %w", err)
-	}
-	defer os.RemoveAll(dir)
-
-	// Pull the helm chart down to the temp dir
-	if err := helmPull(ctx, chart, dir); err != nil {
-		return nil, fmt.Errorf("pulling chart: %w", err)
+		return nil, err
 	}
+	defer cleanup()
 
 	// Construct a mapper
 	m, err := NewMapper(ctx, opts...)
@@ -80,23 +90,35 @@ func mapChart(m mapper.Mapper, chartPath string) ([]byte, error) {
 		Content: []*yaml.Node{},
 	}
 
+	// The global values of the chart apply to its subcharts too
+	globals := findGlobals(nil)
+	if len(valuesFiles) > 0 {
+		inputNode, err := readValuesFile(valuesFiles[0])
+		if err != nil {
+			return nil, fmt.Errorf("reading values file: %s: %w", valuesFiles[0], err)
+		}
+		globals = findGlobals(inputNode)
+	}
+
 	// Iterate backwards over the collected values files so that we map the
 	// child values before the parents, prefering any overrides configured
 	// in the parent values.
 	for i := len(valuesFiles) - 1; i >= 0; i-- {
 		path := valuesFiles[i]
 
-		yamlPath := buildPath(strings.TrimPrefix(path, chartPath))
-
 		inputNode, err := readValuesFile(path)
 		if err != nil {
 			return nil, fmt.Errorf("reading values file: %s: %w", path, err)
 		}
 
-		if err := yamlhelpers.WalkNode(inputNode, mapNode(m, yamlPath, outputNode)); err != nil {
-			return nil, err
+		for _, yamlPath := range buildPaths(chartPath, path) {
+			if err := yamlhelpers.WalkNode(inputNode, mapNode(m, globals, yamlPath, outputNode)); err != nil {
+				return nil, err
+			}
 		}
-
+	}
+	if registry, _ := globals.mappedRegistry(); registry != nil {
+		yamlhelpers.AddNode([]string{"global", "imageRegistry"}, outputNode, registry)
 	}
 
 	// Marshal the modified nodes to a new document
@@ -132,34 +154,150 @@ func readValuesFile(path string) (*yaml.Node, error) {
 	return &yaml.Node{Kind: yaml.MappingNode}, nil
 }
 
-// buildPath infers the appropriate nesting in the yaml structure based on the
-// path to a values file.
+// buildPaths infers the appropriate nesting in the yaml structure based on the
+// path to a values file in the chart.
 //
 // For instance, values in charts/grafana/values.yaml would be nested under
 // "grafana".
 //
 // And values in charts/grafana/charts/redis/values.yaml would be nested under
 // "grafana.redis".
-func buildPath(path string) []string {
-	parent := []string{}
-	parts := strings.Split(filepath.Clean(path), string(filepath.Separator))
+//
+// Subcharts that are aliased in the dependencies of their parent are nested
+// under the alias instead, so a subchart that's a dependency more than once
+// has more than one path.
+func buildPaths(chartPath, path string) [][]string {
+	paths := [][]string{{}}
+
+	rel, err := filepath.Rel(chartPath, filepath.Dir(path))
+	if err != nil {
+		return paths
+	}
+
+	dir := chartPath
+	parts := strings.Split(filepath.Clean(rel), string(filepath.Separator))
 	for i, part := range parts {
-		if part != "charts" {
+		if part != "charts" || i+1 >= len(parts) {
+			dir = filepath.Join(dir, part)
 			continue
 		}
 
-		parent = append(parent, parts[i+1])
+		subchart := filepath.Join(dir, part, parts[i+1])
+		names := dependencyNames(dir, subchart, parts[i+1])
+
+		var next [][]string
+		for _, p := range paths {
+			for _, name := range names {
+				next = append(next, append(slices.Clone(p), name))
+			}
+		}
+		paths = next
+		dir = subchart
 	}
 
-	return parent
+	return paths
 }
 
-// helmPull pulls a remote chart and extracts it to the specified directory
+// dependencyNames returns the keys that the values of a subchart are nested
+// under in the values of its parent: the aliases of the subchart in the
+// dependencies of the parent, or its name. The name of the subchart's
+// directory is used when the subchart isn't listed in the dependencies.
+func dependencyNames(parent, subchart, dirName string) []string {
+	parentMeta, err := chartutil.LoadChartfile(filepath.Join(parent, "Chart.yaml"))
+	if err != nil {
+		return []string{dirName}
+	}
+	subchartMeta, err := chartutil.LoadChartfile(filepath.Join(subchart, "Chart.yaml"))
+	if err != nil {
+		return []string{dirName}
+	}
+
+	var names []string
+	for _, dep := range parentMeta.Dependencies {
+		if dep.Name != subchartMeta.Name {
+			continue
+		}
+		name := dep.Name
+		if dep.Alias != "" {
+			name = dep.Alias
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{dirName}
+	}
+
+	return names
+}
+
+// fetchChart returns the directory that the chart is in. Charts on disk are
+// used in place, while packaged charts are extracted, and remote charts are
+// pulled, to a temporary directory that's removed by cleanup.
+func fetchChart(ctx context.Context, chart ChartDescriptor) (string, func(), error) {
+	noop := func() {}
+
+	info, err := os.Stat(chart.Name)
+	if err == nil && info.IsDir() {
+		return chart.Name, noop, nil
+	}
+
+	// Create a temporary directory where we'll untar the chart
+	dir, err := os.MkdirTemp("", "")
+	if err != nil {
+		return "", noop, fmt.Errorf("creating temporary directory: %w", err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	// Extract a packaged chart on disk
+	if info != nil {
+		if err := chartutil.ExpandFile(dir, chart.Name); err != nil {
+			cleanup()
+			return "", noop, fmt.Errorf("extracting chart: %w", err)
+		}
+
+		return dir, cleanup, nil
+	}
+
+	// Pull the helm chart down to the temp dir
+	if err := helmPull(ctx, chart, dir); err != nil {
+		cleanup()
+		return "", noop, fmt.Errorf("pulling chart: %w", err)
+	}
+
+	return dir, cleanup, nil
+}
+
+// helmPull pulls a remote chart, from a chart repository or an OCI registry,
+// and extracts it to the specified directory
 func helmPull(ctx context.Context, chart ChartDescriptor, dir string) error {
-	client := action.NewPullWithOpts(action.WithConfig(&action.Configuration{}))
-	client.Settings = cli.New()
+	settings := cli.New()
+
+	registryOpts := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptCredentialsFile(settings.RegistryConfig),
+		registry.ClientOptBasicAuth(chart.Username, chart.Password),
+	}
+	if chart.PlainHTTP {
+		registryOpts = append(registryOpts, registry.ClientOptPlainHTTP())
+	}
+	registryClient, err := registry.NewClient(registryOpts...)
+	if err != nil {
+		return fmt.Errorf("constructing registry client: %w", err)
+	}
+
+	client := action.NewPullWithOpts(action.WithConfig(&action.Configuration{
+		RegistryClient: registryClient,
+	}))
+	client.Settings = settings
 	client.DestDir = dir
 	client.Untar = true
+	client.Username = chart.Username
+	client.Password = chart.Password
+	client.PlainHTTP = chart.PlainHTTP
 
 	if chart.Version != "" {
 		client.Version = chart.Version
@@ -168,7 +306,7 @@ func helmPull(ctx context.Context, chart ChartDescriptor, dir string) error {
 		client.RepoURL = chart.Repository
 	}
 
-	_, err := client.Run(chart.Name)
+	_, err = client.Run(chart.Name)
 	if err != nil {
 		return fmt.Errorf("pulling chart: %w", err)
 	}
@@ -1,10 +1,20 @@
 package helm
 
 import (
+	"io"
+	"log"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
 )
 
 func TestMapChart(t *testing.T) {
@@ -146,3 +156,321 @@ server:
 		t.Errorf("unexpected values:\n%s", diff)
 	}
 }
+
+func TestRenderChart(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"nginx": {
+				"cgr.dev/chainguard/nginx:latest",
+			},
+			"prom/nginx-prometheus-exporter:1.4.0": {
+				"cgr.dev/chainguard/prometheus-nginx-exporter:1.4.0",
+			},
+			"busybox:1.36": {
+				"cgr.dev/chainguard/busybox:1.36",
+			},
+			"docker.io/bitnami/kubectl:1.31": {
+				"cgr.dev/chainguard/kubectl:1.31",
+			},
+			"library/redis:7": {
+				"cgr.dev/chainguard/redis:7",
+			},
+			"docker.io/library/redis:7": {
+				"cgr.dev/chainguard/redis:7",
+			},
+			"ghcr.io/example/proxy:v1.0.0": {
+				"cgr.dev/chainguard/proxy:v1.0.0",
+			},
+		},
+	}
+
+	wantValues := `image:
+    repository: cgr.dev/chainguard/nginx # Original: nginx
+sidecar:
+    image: cgr.dev/chainguard/redis:7 # Original: library/redis:7
+metrics:
+    image:
+        repository: cgr.dev/chainguard/prometheus-nginx-exporter # Original: prom/nginx-prometheus-exporter
+`
+
+	// The metrics image is controlled by the values, so it isn't reported
+	// when the values enable it. The sidecar image is set by the values, but
+	// the template prefixes it with a registry, so it isn't mapped either.
+	want := []HardcodedImage{
+		{
+			ContainerImage: k8s.ContainerImage{
+				Kind:      "Deployment",
+				Name:      "image-mapper",
+				Container: "init",
+				Image:     "busybox:1.36",
+			},
+			Mapped:   "cgr.dev/chainguard/busybox:1.36",
+			Rendered: "busybox:1.36",
+		},
+		{
+			ContainerImage: k8s.ContainerImage{
+				Kind:      "Deployment",
+				Name:      "image-mapper",
+				Container: "proxy",
+				Image:     "ghcr.io/example/proxy:v1.0.0",
+			},
+			Mapped:   "cgr.dev/chainguard/proxy:v1.0.0",
+			Rendered: "ghcr.io/example/proxy:v1.0.0",
+		},
+		{
+			ContainerImage: k8s.ContainerImage{
+				Kind:      "Deployment",
+				Name:      "image-mapper",
+				Container: "sidecar",
+				Image:     "docker.io/library/redis:7",
+			},
+			Mapped:   "cgr.dev/chainguard/redis:7",
+			Rendered: "docker.io/cgr.dev/chainguard/redis:7",
+		},
+		{
+			ContainerImage: k8s.ContainerImage{
+				Kind:      "Job",
+				Name:      "image-mapper-migrate",
+				Container: "migrate",
+				Image:     "docker.io/bitnami/kubectl:1.31",
+			},
+			Mapped:   "cgr.dev/chainguard/kubectl:1.31",
+			Rendered: "docker.io/bitnami/kubectl:1.31",
+		},
+	}
+
+	gotValues, got, err := renderChart(t.Context(), m, "testdata/render-chart", RenderOptions{
+		Values: []string{"metrics.enabled=true"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error rendering chart: %s", err)
+	}
+
+	if diff := cmp.Diff(wantValues, string(gotValues)); diff != "" {
+		t.Errorf("unexpected values:\n%s", diff)
+	}
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(k8s.ContainerImage{}), cmpopts.IgnoreFields(k8s.ContainerImage{}, "Line")); diff != "" {
+		t.Errorf("unexpected hardcoded images (-want +got):\n%s", diff)
+	}
+}
+
+func TestMapChartAliases(t *testing.T) {
+	want := `cache:
+    image:
+        repository: cgr.dev/chainguard/redis # Original: ecr-public.aws.com/docker/library/redis
+        tag: 8.2.2 # Original: 8.2.2-alpine
+queue:
+    image:
+        repository: cgr.dev/chainguard/redis # Original: ecr-public.aws.com/docker/library/redis
+        tag: 8.2.2 # Original: 8.2.2-alpine
+dex:
+    image:
+        repository: cgr.dev/chainguard/dex # Original: ghcr.io/dexidp/dex
+image:
+    repository: cgr.dev/chainguard/argocd # Original: quay.io/argoproj/argocd
+`
+
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"ecr-public.aws.com/docker/library/redis:8.2.2-alpine": {
+				"cgr.dev/chainguard/redis:8.2.2",
+			},
+			"ghcr.io/dexidp/dex:v2.44.0": {
+				"cgr.dev/chainguard/dex:v2.44.0",
+			},
+			"quay.io/argoproj/argocd": {
+				"cgr.dev/chainguard/argocd:latest",
+			},
+		},
+	}
+
+	got, err := mapChart(m, "testdata/alias-chart")
+	if err != nil {
+		t.Fatalf("unexpected error mapping chart: %s", err)
+	}
+
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected values:\n%s", diff)
+	}
+}
+
+func TestBuildPaths(t *testing.T) {
+	testCases := map[string][][]string{
+		"testdata/alias-chart/values.yaml":                     {{}},
+		"testdata/alias-chart/charts/redis/values.yaml":        {{"cache"}, {"queue"}},
+		"testdata/alias-chart/charts/dex-chart/values.yaml":    {{"dex"}},
+		"testdata/test-chart/charts/test-subchart/values.yaml": {{"test-subchart"}},
+	}
+
+	for path, want := range testCases {
+		t.Run(path, func(t *testing.T) {
+			chartPath := strings.Join(strings.Split(path, "/")[:2], "/")
+			if diff := cmp.Diff(want, buildPaths(chartPath, path)); diff != "" {
+				t.Errorf("unexpected paths (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFetchChart(t *testing.T) {
+	chrt, err := loader.Load("testdata/test-chart")
+	if err != nil {
+		t.Fatalf("unexpected error loading chart: %s", err)
+	}
+	archive, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error packaging chart: %s", err)
+	}
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatalf("unexpected error reading packaged chart: %s", err)
+	}
+
+	// Push the packaged chart to a local OCI registry
+	srv := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	client, err := registry.NewClient(registry.ClientOptPlainHTTP(), registry.ClientOptWriter(io.Discard))
+	if err != nil {
+		t.Fatalf("unexpected error constructing registry client: %s", err)
+	}
+	if _, err := client.Push(data, host+"/charts/test-chart:1.0.0"); err != nil {
+		t.Fatalf("unexpected error pushing chart: %s", err)
+	}
+
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"quay.io/argoproj/argocd": {
+				"cgr.dev/chainguard/argocd:latest",
+			},
+		},
+	}
+	want, err := mapChart(m, "testdata/test-chart")
+	if err != nil {
+		t.Fatalf("unexpected error mapping chart: %s", err)
+	}
+
+	testCases := map[string]ChartDescriptor{
+		"directory": {
+			Name: "testdata/test-chart",
+		},
+		"packaged": {
+			Name: archive,
+		},
+		"oci": {
+			Name:      "oci://" + host + "/charts/test-chart",
+			Version:   "1.0.0",
+			PlainHTTP: true,
+		},
+	}
+
+	for name, chart := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir, cleanup, err := fetchChart(t.Context(), chart)
+			if err != nil {
+				t.Fatalf("unexpected error fetching chart: %s", err)
+			}
+			defer cleanup()
+
+			got, err := mapChart(m, dir)
+			if err != nil {
+				t.Fatalf("unexpected error mapping chart: %s", err)
+			}
+			if diff := cmp.Diff(string(want), string(got)); diff != "" {
+				t.Errorf("unexpected values:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestVerifyChart(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"nginx": {
+				"cgr.dev/chainguard/nginx:latest",
+			},
+			"nginx:1.27.3": {
+				"cgr.dev/chainguard/nginx:1.27.3",
+			},
+			"busybox:1.36": {
+				"cgr.dev/chainguard/busybox:1.36",
+			},
+			"library/redis:7": {
+				"cgr.dev/chainguard/redis:7",
+			},
+			"docker.io/library/redis:7": {
+				"cgr.dev/chainguard/redis:7",
+			},
+			"docker.io/bitnami/kubectl:1.31": {
+				"cgr.dev/chainguard/kubectl:1.31",
+			},
+		},
+	}
+
+	want := []VerifiedImage{
+		{
+			Kind:      "Deployment",
+			Name:      "image-mapper",
+			Container: "init",
+			Original:  "busybox:1.36",
+			Image:     "busybox:1.36",
+			Expected:  "cgr.dev/chainguard/busybox:1.36",
+			Status:    VerifyStatusUpstream,
+		},
+		{
+			Kind:      "Deployment",
+			Name:      "image-mapper",
+			Container: "nginx",
+			Original:  "nginx:1.27.3",
+			Image:     "cgr.dev/chainguard/nginx:1.27.3",
+			Expected:  "cgr.dev/chainguard/nginx:1.27.3",
+			Status:    VerifyStatusMapped,
+		},
+		{
+			Kind:      "Deployment",
+			Name:      "image-mapper",
+			Container: "proxy",
+			Original:  "ghcr.io/example/proxy:v1.0.0",
+			Image:     "ghcr.io/example/proxy:v1.0.0",
+			Status:    VerifyStatusUnmapped,
+		},
+		{
+			Kind:      "Deployment",
+			Name:      "image-mapper",
+			Container: "sidecar",
+			Original:  "docker.io/library/redis:7",
+			Image:     "docker.io/cgr.dev/chainguard/redis:7",
+			Expected:  "cgr.dev/chainguard/redis:7",
+			Status:    VerifyStatusUnexpected,
+		},
+		{
+			Kind:      "Job",
+			Name:      "image-mapper-migrate",
+			Container: "migrate",
+			Original:  "docker.io/bitnami/kubectl:1.31",
+			Image:     "docker.io/bitnami/kubectl:1.31",
+			Expected:  "cgr.dev/chainguard/kubectl:1.31",
+			Status:    VerifyStatusUpstream,
+		},
+	}
+
+	_, got, err := verifyChart(t.Context(), m, "testdata/render-chart", RenderOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error verifying chart: %s", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+
+	var regressions []string
+	for _, img := range got {
+		if img.Regression() {
+			regressions = append(regressions, img.Container)
+		}
+	}
+	if diff := cmp.Diff([]string{"init", "sidecar", "migrate"}, regressions); diff != "" {
+		t.Errorf("unexpected regressions (-want +got):\n%s", diff)
+	}
+}
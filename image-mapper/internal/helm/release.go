@@ -0,0 +1,72 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"gopkg.in/yaml.v3"
+)
+
+// MapRelease maps the images in a chart, and in the values that a release of
+// the chart is installed with, and returns the values that override them.
+//
+// The values are in the order Helm applies them, so the images in the later
+// values take precedence over the earlier ones, and over the chart. This uses
+// the provided mapper, so that many releases can be mapped without
+// constructing a new mapper for each one.
+func MapRelease(ctx context.Context, m mapper.Mapper, chart ChartDescriptor, values ...[]byte) (*yaml.Node, error) {
+	dir, cleanup, err := fetchChart(ctx, chart)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	output, err := mapChart(m, dir)
+	if err != nil {
+		return nil, fmt.Errorf("mapping chart: %w", err)
+	}
+	overrides, err := readMapping(output)
+	if err != nil {
+		return nil, fmt.Errorf("reading mapped chart values: %w", err)
+	}
+
+	for _, v := range values {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(v, &doc); err != nil {
+			return nil, fmt.Errorf("unmarshalling values: %w", err)
+		}
+		// Values that are empty, or only comments, don't reference
+		// any images
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+
+		output, err := mapValues(m, v)
+		if err != nil {
+			return nil, fmt.Errorf("mapping values: %w", err)
+		}
+		mapped, err := readMapping(output)
+		if err != nil {
+			return nil, fmt.Errorf("reading mapped values: %w", err)
+		}
+		yamlhelpers.MergeNode(overrides, mapped)
+	}
+
+	return overrides, nil
+}
+
+// readMapping unmarshals a document that contains a mapping node, and returns
+// the mapping node
+func readMapping(input []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(input, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+
+	return doc.Content[0], nil
+}
@@ -0,0 +1,188 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-containerregistry/pkg/name"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/cli/values"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// RenderOptions are the values a chart is rendered with, in the same form as
+// the flags of 'helm template'
+type RenderOptions struct {
+	// ValuesFiles are the values files, like --values
+	ValuesFiles []string
+
+	// Values are values in the form key=value, like --set
+	Values []string
+}
+
+// HardcodedImage is an image in the rendered manifests of a chart that isn't
+// changed to the image it maps to by the values that MapChart returns. It's
+// either hardcoded in the templates or built from the values in a way that
+// isn't recognised.
+type HardcodedImage struct {
+	k8s.ContainerImage
+
+	// Mapped is the Chainguard image that the image maps to
+	Mapped string
+
+	// Rendered is the image in the manifests rendered with the values that
+	// MapChart returns
+	Rendered string
+}
+
+// RenderChart extracts image related values from a Helm chart and maps them to
+// Chainguard, like MapChart. It also renders the chart with the values in the
+// options and the mapped values, without a cluster, and returns the images in
+// the rendered manifests that the mapped values don't override.
+func RenderChart(ctx context.Context, chart ChartDescriptor, render RenderOptions, opts ...mapper.Option) ([]byte, []HardcodedImage, error) {
+	dir, cleanup, err := fetchChart(ctx, chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	// Construct a mapper
+	m, err := NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return renderChart(ctx, m, dir, render)
+}
+
+// renderChart maps the images in the values of the chart and returns the
+// images in the rendered manifests that the mapped values don't override
+func renderChart(ctx context.Context, m mapper.Mapper, dir string, render RenderOptions) ([]byte, []HardcodedImage, error) {
+	output, originals, mapped, err := renderMapped(ctx, m, dir, render)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hardcoded []HardcodedImage
+	for _, img := range originals {
+		ref, err := mapper.MapImage(m, img.Image)
+		if err != nil {
+			continue
+		}
+
+		// Containers that aren't rendered with the mapped values can't be
+		// checked
+		image, ok := mapped[containerKey(img)]
+		if !ok || repoName(image) == repoName(ref.String()) {
+			continue
+		}
+
+		hardcoded = append(hardcoded, HardcodedImage{
+			ContainerImage: img,
+			Mapped:         ref.String(),
+			Rendered:       image,
+		})
+	}
+
+	return output, hardcoded, nil
+}
+
+// renderImages renders the chart and returns the container images in the
+// rendered manifests
+func renderImages(ctx context.Context, chartPath string, render RenderOptions, overrides map[string]any) ([]k8s.ContainerImage, error) {
+	manifests, err := renderManifests(ctx, chartPath, render, overrides)
+	if err != nil {
+		return nil, fmt.Errorf("rendering chart: %w", err)
+	}
+	images, err := k8s.FindImages(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("finding images in rendered manifests: %w", err)
+	}
+
+	return images, nil
+}
+
+// renderManifests renders the templates of the chart with the values in the
+// options, like 'helm template', and returns the manifests, including hooks.
+// The overrides, if any, take precedence over the values in the options.
+func renderManifests(ctx context.Context, chartPath string, render RenderOptions, overrides map[string]any) ([]byte, error) {
+	chrt, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart: %w", err)
+	}
+
+	opts := values.Options{
+		ValueFiles: render.ValuesFiles,
+		Values:     render.Values,
+	}
+	vals, err := opts.MergeValues(getter.All(cli.New()))
+	if err != nil {
+		return nil, fmt.Errorf("reading values: %w", err)
+	}
+	if overrides != nil {
+		vals = chartutil.MergeTables(overrides, vals)
+	}
+
+	client := action.NewInstall(&action.Configuration{
+		Log: func(string, ...interface{}) {},
+	})
+	client.DryRun = true
+	client.ClientOnly = true
+	client.Replace = true
+	client.ReleaseName = "image-mapper"
+	client.Namespace = "default"
+
+	rel, err := client.RunWithContext(ctx, chrt, vals)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []string{rel.Manifest}
+	for _, hook := range rel.Hooks {
+		manifests = append(manifests, hook.Manifest)
+	}
+
+	return []byte(strings.Join(manifests, "\n---\n")), nil
+}
+
+// findChart returns the path to the chart in a directory that a chart was
+// pulled to
+func findChart(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "Chart.yaml")); err == nil {
+		return dir, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("reading chart directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), "Chart.yaml")); err == nil {
+			return filepath.Join(dir, entry.Name()), nil
+		}
+	}
+
+	return "", fmt.Errorf("no chart found in %s", dir)
+}
+
+// repoName returns the repository of an image, with the default registry
+// filled in, so that the same repository written in different ways matches
+func repoName(img string) string {
+	ref, err := name.ParseReference(img)
+	if err != nil {
+		return img
+	}
+
+	return ref.Context().Name()
+}
@@ -2,10 +2,16 @@ package helm
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"github.com/google/go-containerregistry/pkg/name"
 	"gopkg.in/yaml.v3"
 )
 
@@ -40,9 +46,13 @@ func mapValues(m mapper.Mapper, input []byte) ([]byte, error) {
 
 	// Walk the document recursively, adding image related fields to the
 	// output node and mapping them to Chainguard images
-	if err := yamlhelpers.WalkNode(inputNode, mapNode(m, []string{}, outputNode)); err != nil {
+	globals := findGlobals(inputNode)
+	if err := yamlhelpers.WalkNode(inputNode, mapNode(m, globals, []string{}, outputNode)); err != nil {
 		return nil, fmt.Errorf("walking nodes: %w", err)
 	}
+	if registry, _ := globals.mappedRegistry(); registry != nil {
+		yamlhelpers.AddNode([]string{"global", "imageRegistry"}, outputNode, registry)
+	}
 
 	// Marshal the modified nodes to a new document
 	doc := &yaml.Node{
@@ -57,10 +67,261 @@ func mapValues(m mapper.Mapper, input []byte) ([]byte, error) {
 	return output, nil
 }
 
+// ValuesImage is an image referenced by a values file
+type ValuesImage struct {
+	// Path is the path to the values that reference the image, i.e
+	// server.image
+	Path string
+
+	// Image is the image constructed from the values
+	Image string
+
+	// Line is the line the image is defined on
+	Line int
+}
+
+// FindImages returns the images referenced by a values file
+func FindImages(input []byte) ([]ValuesImage, error) {
+	var inputDoc yaml.Node
+	if err := yaml.Unmarshal(input, &inputDoc); err != nil {
+		return nil, fmt.Errorf("unmarshalling yaml: %w", err)
+	}
+	if len(inputDoc.Content) == 0 {
+		return nil, nil
+	}
+
+	var (
+		images  []ValuesImage
+		globals = findGlobals(inputDoc.Content[0])
+	)
+	if err := yamlhelpers.WalkNode(inputDoc.Content[0], func(path []string, value *yaml.Node) error {
+		fields := findFields(globals, path, value)
+		if fields == nil {
+			return nil
+		}
+
+		images = append(images, ValuesImage{
+			Path:  strings.Join(path, "."),
+			Image: fields.img,
+			Line:  fields.line,
+		})
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking nodes: %w", err)
+	}
+
+	return images, nil
+}
+
+// RewriteValues maps the images in a values file to Chainguard in place,
+// rather than extracting them. Everything else in the file, including
+// comments and formatting, is preserved.
+func RewriteValues(m mapper.Mapper, input []byte) ([]byte, error) {
+	var inputDoc yaml.Node
+	if err := yaml.Unmarshal(input, &inputDoc); err != nil {
+		return nil, fmt.Errorf("unmarshalling yaml: %w", err)
+	}
+	if len(inputDoc.Content) == 0 {
+		return input, nil
+	}
+
+	var (
+		edits   []yamlhelpers.Edit
+		globals = findGlobals(inputDoc.Content[0])
+	)
+	if err := yamlhelpers.WalkNode(inputDoc.Content[0], editNode(m, globals, &edits)); err != nil {
+		return nil, fmt.Errorf("walking nodes: %w", err)
+	}
+	if registry, original := globals.mappedRegistry(); registry != nil {
+		edits = append(edits, yamlhelpers.Edit{
+			Node:  original,
+			Value: registry.Value,
+		})
+	}
+
+	output, err := yamlhelpers.ApplyEdits(input, edits)
+	if err != nil {
+		return nil, fmt.Errorf("editing values: %w", err)
+	}
+
+	return output, nil
+}
+
 // mapNode returns a function that extracts image related fields from the input
 // node and adds them to the output node, mapping the images to Chainguard where
 // possible.
 //
+// Helm replaces lists, rather than merging them, so lists that contain images,
+// like extra containers, are added to the output in full.
+func mapNode(m mapper.Mapper, globals *globalValues, yamlPath []string, output *yaml.Node) yamlhelpers.WalkNodeFn {
+	// The nodes inside lists that have already been added to the output
+	listed := map[*yaml.Node]bool{}
+
+	return func(path []string, value *yaml.Node) error {
+		if listed[value] {
+			return nil
+		}
+		if value.Kind == yaml.SequenceNode {
+			if node := mapList(m, globals, path, value, listed); node != nil {
+				yamlhelpers.AddNode(append(yamlPath, path...), output, node)
+			}
+			return nil
+		}
+
+		fields := mapFields(m, globals, path, value)
+		if fields == nil {
+			return nil
+		}
+
+		// Create a new node and add all the modified values to it
+		node := &yaml.Node{
+			Kind:    yaml.MappingNode,
+			Content: []*yaml.Node{},
+		}
+		if fields.err != nil {
+			node.HeadComment = fmt.Sprintf("Failed to map: %s: %s", fields.img, fields.err)
+		}
+		yamlhelpers.AddNode([]string{"registry"}, node, fields.registry)
+		yamlhelpers.AddNode([]string{"image"}, node, fields.image)
+		yamlhelpers.AddNode([]string{"name"}, node, fields.name)
+		yamlhelpers.AddNode([]string{"repository"}, node, fields.repository)
+
+		// Only include the tag and digest if we modified them
+		if fields.tag != nil && fields.tag.LineComment != "" {
+			yamlhelpers.AddNode([]string{"tag"}, node, fields.tag)
+		}
+		if fields.digest != nil && fields.digest.LineComment != "" {
+			yamlhelpers.AddNode([]string{fields.digestKey}, node, fields.digest)
+		}
+
+		// Add the new node to the output values at the same path as the
+		// input
+		yamlhelpers.AddNode(append(yamlPath, path...), output, node)
+
+		return nil
+	}
+}
+
+// mapList maps the images in a list, like a list of containers, and returns a
+// copy of the whole list with the mapped values. It returns nil if there are no
+// images in the list. The nodes in the list are recorded in listed.
+func mapList(m mapper.Mapper, globals *globalValues, path []string, list *yaml.Node, listed map[*yaml.Node]bool) *yaml.Node {
+	var (
+		mapped   = map[*yaml.Node]*yaml.Node{}
+		comments = map[*yaml.Node]string{}
+	)
+	for _, item := range list.Content {
+		_ = yamlhelpers.WalkNode(item, func(itemPath []string, value *yaml.Node) error {
+			listed[value] = true
+
+			fields := mapFields(m, globals, slices.Concat(path, itemPath), value)
+			if fields == nil {
+				return nil
+			}
+			if fields.err != nil {
+				comments[value] = fmt.Sprintf("Failed to map: %s: %s", fields.img, fields.err)
+			}
+			for c, original := range fields.originals {
+				mapped[original] = c
+			}
+
+			return nil
+		})
+	}
+	if len(mapped) == 0 && len(comments) == 0 {
+		return nil
+	}
+
+	return copyTree(list, mapped, comments)
+}
+
+// copyTree returns a deep copy of the node, with the nodes in mapped replaced
+// by their mapped values and the comments added to the head of the nodes
+func copyTree(node *yaml.Node, mapped map[*yaml.Node]*yaml.Node, comments map[*yaml.Node]string) *yaml.Node {
+	if c, ok := mapped[node]; ok {
+		return c
+	}
+
+	c := &yaml.Node{
+		Kind:        node.Kind,
+		Style:       node.Style,
+		Tag:         node.Tag,
+		Value:       node.Value,
+		HeadComment: comments[node],
+	}
+	for _, child := range node.Content {
+		c.Content = append(c.Content, copyTree(child, mapped, comments))
+	}
+
+	return c
+}
+
+// editNode returns a function that maps the image related fields in the input
+// node to Chainguard and records the changes as edits to the input
+func editNode(m mapper.Mapper, globals *globalValues, edits *[]yamlhelpers.Edit) yamlhelpers.WalkNodeFn {
+	return func(path []string, value *yaml.Node) error {
+		fields := mapFields(m, globals, path, value)
+		if fields == nil {
+			return nil
+		}
+		// The registry being unavailable isn't a problem with the
+		// values, so it fails the rewrite rather than leaving the
+		// image unpinned
+		if errors.Is(fields.err, mapper.ErrResolveDigest) {
+			return fmt.Errorf("mapping image: %s: %w", fields.img, fields.err)
+		}
+		if fields.err != nil {
+			log.Printf("WARN: failed to map: %s: %s", fields.img, fields.err)
+			return nil
+		}
+
+		for mapped, original := range fields.originals {
+			if mapped.Value == original.Value {
+				continue
+			}
+			*edits = append(*edits, yamlhelpers.Edit{
+				Node:  original,
+				Value: mapped.Value,
+			})
+		}
+
+		return nil
+	}
+}
+
+// imageFields are the image related fields of a map in a values file, after
+// they've been mapped to Chainguard
+type imageFields struct {
+	image      *yaml.Node
+	name       *yaml.Node
+	repository *yaml.Node
+	registry   *yaml.Node
+	tag        *yaml.Node
+
+	// digest is the field that pins the image to a digest, if any, and
+	// digestKey is its key: digest or sha
+	digest    *yaml.Node
+	digestKey string
+
+	// globalRegistry is true if the registry of the image is set by
+	// global.imageRegistry, rather than the registry field
+	globalRegistry bool
+
+	// img is the image that the fields referred to, line is where it's
+	// defined and err is the error encountered mapping it, if any
+	img  string
+	line int
+	err  error
+
+	// originals are the nodes in the input that the fields were copied
+	// from
+	originals map[*yaml.Node]*yaml.Node
+}
+
+// findFields extracts copies of the image related fields from the input node.
+// It returns nil if the node doesn't refer to an image.
+//
 // It handles blocks like:
 //
 //	image:
@@ -73,6 +334,7 @@ func mapValues(m mapper.Mapper, input []byte) ([]byte, error) {
 //	  registry: ghcr.io
 //	  repository: foo/bar
 //	  tag: v0.0.1
+//	  digest: sha256:...
 //
 //	OR
 //
@@ -83,157 +345,282 @@ func mapValues(m mapper.Mapper, input []byte) ([]byte, error) {
 //	OR
 //
 //	image: ghcr.io/foo/bar:v0.0.1
-func mapNode(m mapper.Mapper, yamlPath []string, output *yaml.Node) yamlhelpers.WalkNodeFn {
-	return func(path []string, value *yaml.Node) error {
-		if value.Kind != yaml.MappingNode {
-			return nil
-		}
+//
+//	OR
+//
+//	containers:
+//	  - name: foo
+//	    image: ghcr.io/foo/bar:v0.0.1
+func findFields(globals *globalValues, path []string, value *yaml.Node) *imageFields {
+	if value.Kind != yaml.MappingNode {
+		return nil
+	}
 
-		// Extract all the keys from the map that are typically
-		// associated with an image
-		var (
-			image      *yaml.Node
-			name       *yaml.Node
-			repository *yaml.Node
-			registry   *yaml.Node
-			tag        *yaml.Node
-		)
-		for i := 0; i < len(value.Content); i += 2 {
-			key := value.Content[i].Value
-			value := value.Content[i+1]
-
-			switch key {
-			case "image":
-				image = &yaml.Node{
-					Kind:  value.Kind,
-					Tag:   value.Tag,
-					Value: value.Value,
-				}
-			case "name":
-				name = &yaml.Node{
-					Kind:  value.Kind,
-					Tag:   value.Tag,
-					Value: value.Value,
-				}
-			case "repository":
-				repository = &yaml.Node{
-					Kind:  value.Kind,
-					Tag:   value.Tag,
-					Value: value.Value,
-				}
-			case "registry":
-				registry = &yaml.Node{
-					Kind:  value.Kind,
-					Tag:   value.Tag,
-					Value: value.Value,
-				}
-			case "tag":
-				tag = &yaml.Node{
-					Kind:  value.Kind,
-					Tag:   value.Tag,
-					Value: value.Value,
-				}
-			}
-		}
+	// Extract all the keys from the map that are typically
+	// associated with an image
+	var (
+		image      *yaml.Node
+		name       *yaml.Node
+		repository *yaml.Node
+		registry   *yaml.Node
+		tag        *yaml.Node
+		digest     *yaml.Node
+		digestKey  string
+		originals  = map[*yaml.Node]*yaml.Node{}
+	)
+	for i := 0; i < len(value.Content); i += 2 {
+		key := value.Content[i].Value
+		value := value.Content[i+1]
 
-		// If we don't have one of repository, name or image then we
-		// have no chance of figuring out the image mapping and we'll
-		// skip over it.
-		if !(hasValue(repository) || hasValue(name) || hasValue(image)) {
-			return nil
+		switch key {
+		case "image":
+			image = copyNode(value, originals)
+		case "name":
+			name = copyNode(value, originals)
+		case "repository":
+			repository = copyNode(value, originals)
+		case "registry":
+			registry = copyNode(value, originals)
+		case "tag":
+			tag = copyNode(value, originals)
+		case "digest", "sha":
+			digest = copyNode(value, originals)
+			digestKey = key
 		}
+	}
 
-		// The key 'name' is too generic for us to assume it refers to
-		// an image, so ignore maps with keys called 'name' unless
-		// there are other signals that this is an image reference.
-		//
-		// For instance, if the map key is 'image', or we have a
-		// registry/tag alongside the name.
-		if hasValue(name) && !(path[len(path)-1] == "image" || registry != nil || tag != nil) {
-			return nil
+	// If the map has an image then the name is the name of a container,
+	// rather than an image
+	if hasValue(image) {
+		delete(originals, name)
+		name = nil
+	}
+
+	// If we don't have one of repository, name or image then we
+	// have no chance of figuring out the image mapping and we'll
+	// skip over it.
+	if !(hasValue(repository) || hasValue(name) || hasValue(image)) {
+		return nil
+	}
+
+	// The key 'name' is too generic for us to assume it refers to
+	// an image, so ignore maps with keys called 'name' unless
+	// there are other signals that this is an image reference.
+	//
+	// For instance, if the map key is 'image', or we have a
+	// registry/tag alongside the name.
+	if hasValue(name) && !((len(path) > 0 && path[len(path)-1] == "image") || registry != nil || tag != nil) {
+		return nil
+	}
+
+	// Construct the image reference based on the fields
+	// available
+	img := ""
+	line := value.Line
+	if hasValue(name) {
+		img = name.Value
+		line = originals[name].Line
+	}
+	if hasValue(image) {
+		img = image.Value
+		line = originals[image].Line
+	}
+	if hasValue(repository) {
+		img = repository.Value
+		line = originals[repository].Line
+	}
+
+	// Charts with a registry field, like Bitnami's, use
+	// global.imageRegistry in its place when it's set
+	globalRegistry := registry != nil && hasValue(globals.imageRegistry)
+	switch {
+	case globalRegistry:
+		img = fmt.Sprintf("%s/%s", globals.imageRegistry.Value, img)
+	case hasValue(registry):
+		img = fmt.Sprintf("%s/%s", registry.Value, img)
+	}
+	if hasValue(tag) {
+		img = fmt.Sprintf("%s:%s", img, tag.Value)
+	}
+
+	return &imageFields{
+		image:          image,
+		name:           name,
+		repository:     repository,
+		registry:       registry,
+		tag:            tag,
+		digest:         digest,
+		digestKey:      digestKey,
+		globalRegistry: globalRegistry,
+		img:            img,
+		line:           line,
+		originals:      originals,
+	}
+}
+
+// mapFields extracts copies of the image related fields from the input node and
+// maps them to Chainguard. It returns nil if the node doesn't refer to an
+// image.
+func mapFields(m mapper.Mapper, globals *globalValues, path []string, value *yaml.Node) *imageFields {
+	fields := findFields(globals, path, value)
+	if fields == nil {
+		return nil
+	}
+
+	var (
+		image      = fields.image
+		name       = fields.name
+		repository = fields.repository
+		registry   = fields.registry
+		tag        = fields.tag
+		digest     = fields.digest
+	)
+
+	// Map the constructed image reference to the equivalent
+	// Chainguard image
+	mapping, err := mapper.MapImage(m, fields.img)
+	fields.err = err
+	if err == nil {
+		// Modify the values to follow the mapped image. This
+		// will ignore nodes that are nil.
+		setValue(repository, mapping.Context().String())
+		setValue(image, mapping.Context().String())
+		setValue(name, mapping.Context().String())
+		setValue(registry, mapping.Context().RegistryStr())
+
+		// If there's no tag, then chances are image is a fully
+		// qualified image reference
+		if tag == nil {
+			setValue(image, mapping.String())
 		}
 
-		// Construct the image reference based on the fields
-		// available
-		img := ""
-		if hasValue(name) {
-			img = name.Value
+		// If the registry key exists, then the
+		// repository shouldn't include the registry.
+		if registry != nil {
+			setValue(repository, mapping.Context().RepositoryStr())
+			setValue(image, mapping.Context().RepositoryStr())
+			setValue(name, mapping.Context().RepositoryStr())
 		}
-		if hasValue(image) {
-			img = image.Value
+
+		// The global registry has to follow the mapped image too,
+		// or it would take precedence over the registry field
+		if fields.globalRegistry {
+			globals.registries[mapping.Context().RegistryStr()] = true
 		}
-		if hasValue(repository) {
-			img = repository.Value
+
+		// If there's a digest field, then the digest goes there,
+		// rather than after the tag. The original digest refers to
+		// the original image, so it's cleared if the mapped image
+		// isn't pinned.
+		tagStr, digestStr := splitDigest(mapping)
+		if digest == nil {
+			tagStr = tagValue(mapping)
 		}
-		if hasValue(registry) {
-			img = fmt.Sprintf("%s/%s", registry.Value, img)
+		if hasValue(digest) || digestStr != "" {
+			if fields.digestKey == "sha" {
+				digestStr = strings.TrimPrefix(digestStr, "sha256:")
+			}
+			setValue(digest, digestStr)
 		}
-		if hasValue(tag) {
-			img = fmt.Sprintf("%s:%s", img, tag.Value)
+
+		// If the mapped tag is different to the tag in
+		// the original values, then replace it.
+		//
+		// Otherwise, leave it alone so that the output values
+		// don't include a specific tag have a better shot of
+		// being compatible across chart version upgrades.
+		if hasValue(tag) && tag.Value != tagStr {
+			setValue(tag, tagStr)
 		}
+	}
 
-		// Map the constructed image reference to the equivalent
-		// Chainguard image
-		mapping, err := mapper.MapImage(m, img)
-		if err == nil {
-			// Modify the values to follow the mapped image. This
-			// will ignore nodes that are nil.
-			setValue(repository, mapping.Context().String())
-			setValue(image, mapping.Context().String())
-			setValue(name, mapping.Context().String())
-			setValue(registry, mapping.Context().RegistryStr())
-
-			// If there's no tag, then chances are image is a fully
-			// qualified image reference
-			if tag == nil {
-				setValue(image, mapping.String())
-			}
+	return fields
+}
 
-			// If the registry key exists, then the
-			// repository shouldn't include the registry.
-			if registry != nil {
-				setValue(repository, mapping.Context().RepositoryStr())
-				setValue(image, mapping.Context().RepositoryStr())
-				setValue(name, mapping.Context().RepositoryStr())
-			}
+// tagValue returns the value of the tag field for the mapped image. Images that
+// are pinned to a digest include it after the tag, i.e 1.27@sha256:..., so
+// that templates like {{ .repository }}:{{ .tag }} render a valid reference.
+func tagValue(mapping name.Reference) string {
+	tag, digest := splitDigest(mapping)
+	if tag == "" || digest == "" {
+		return tag + digest
+	}
 
-			// If the mapped tag is different to the tag in
-			// the original values, then replace it.
-			//
-			// Otherwise, leave it alone so that the output values
-			// don't include a specific tag have a better shot of
-			// being compatible across chart version upgrades.
-			if hasValue(tag) && tag.Value != mapping.Identifier() {
-				setValue(tag, mapping.Identifier())
-			}
-		}
+	return fmt.Sprintf("%s@%s", tag, digest)
+}
 
-		// Create a new node and add all the modified values to it
-		node := &yaml.Node{
-			Kind:    yaml.MappingNode,
-			Content: []*yaml.Node{},
-		}
-		if err != nil {
-			node.HeadComment = fmt.Sprintf("Failed to map: %s: %s", img, err)
-		}
-		yamlhelpers.AddNode([]string{"registry"}, node, registry)
-		yamlhelpers.AddNode([]string{"image"}, node, image)
-		yamlhelpers.AddNode([]string{"name"}, node, name)
-		yamlhelpers.AddNode([]string{"repository"}, node, repository)
-
-		// Only include the tag if we modified it
-		if tag != nil && tag.LineComment != "" {
-			yamlhelpers.AddNode([]string{"tag"}, node, tag)
-		}
+// splitDigest returns the tag and the digest of the mapped image. The digest
+// is empty if the image isn't pinned.
+func splitDigest(mapping name.Reference) (string, string) {
+	digest, ok := mapping.(name.Digest)
+	if !ok {
+		return mapping.Identifier(), ""
+	}
 
-		// Add the new node to the output values at the same path as the
-		// input
-		yamlhelpers.AddNode(append(yamlPath, path...), output, node)
+	tag, err := name.NewTag(strings.Split(digest.String(), "@")[0])
+	if err != nil {
+		return "", digest.DigestStr()
+	}
 
-		return nil
+	return tag.TagStr(), digest.DigestStr()
+}
+
+// globalValues are the values under global that apply to every image in a
+// values file, and to the subcharts of a chart
+type globalValues struct {
+	// imageRegistry is global.imageRegistry which, in charts like
+	// Bitnami's, takes precedence over the registry of each image
+	imageRegistry *yaml.Node
+
+	// registries are the registries that the images which use
+	// imageRegistry were mapped to
+	registries map[string]bool
+}
+
+// findGlobals returns the global values in the values
+func findGlobals(values *yaml.Node) *globalValues {
+	return &globalValues{
+		imageRegistry: yamlhelpers.Lookup(values, "global", "imageRegistry"),
+		registries:    map[string]bool{},
 	}
 }
 
+// mappedRegistry returns a copy of global.imageRegistry, set to the registry
+// that the images which use it were mapped to, and the original node. It
+// returns nil if global.imageRegistry doesn't need to change.
+func (g *globalValues) mappedRegistry() (*yaml.Node, *yaml.Node) {
+	if len(g.registries) == 0 {
+		return nil, nil
+	}
+	if len(g.registries) > 1 {
+		log.Printf("WARN: global.imageRegistry not mapped: images were mapped to more than one registry: %s", strings.Join(slices.Sorted(maps.Keys(g.registries)), ", "))
+		return nil, nil
+	}
+
+	originals := map[*yaml.Node]*yaml.Node{}
+	registry := copyNode(g.imageRegistry, originals)
+	for r := range g.registries {
+		setValue(registry, r)
+	}
+	if registry.Value == g.imageRegistry.Value {
+		return nil, nil
+	}
+
+	return registry, g.imageRegistry
+}
+
+// copyNode returns a copy of a node and records the original
+func copyNode(node *yaml.Node, originals map[*yaml.Node]*yaml.Node) *yaml.Node {
+	c := &yaml.Node{
+		Kind:  node.Kind,
+		Tag:   node.Tag,
+		Value: node.Value,
+	}
+	originals[c] = node
+
+	return c
+}
+
 // setValue sets the value of a scalar node
 func setValue(node *yaml.Node, value string) {
 	if node == nil {
@@ -1,10 +1,13 @@
 package helm
 
 import (
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/name"
 )
 
 type mockMapper struct {
@@ -12,10 +15,15 @@ type mockMapper struct {
 }
 
 func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
-	return &mapper.Mapping{
+	mapping := &mapper.Mapping{
 		Image:   img,
-		Results: m.mappings[img],
-	}, nil
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
 }
 
 func TestMapValues(t *testing.T) {
@@ -137,3 +145,223 @@ prometheus-example:
 		t.Errorf("unexpected output:\n%s", diff)
 	}
 }
+
+func TestRewriteValues(t *testing.T) {
+	input := []byte(`# Values for the example chart
+prometheus:
+    image: prom/prometheus:v2.18.1 # The server
+redis-example:
+    exporter:
+        enabled: true
+        image: ghcr.io/oliver006/redis_exporter
+        tag: v1.75.0
+    image:
+        registry: ecr-public.aws.com
+        repository: docker/library/redis
+global:
+  image:
+    repository: "quay.io/argoproj/argocd"
+    tag: ""
+unknown:
+  image:
+    repository: unknown/image
+    tag: 1.0
+`)
+
+	want := []byte(`# Values for the example chart
+prometheus:
+    image: cgr.dev/chainguard/prometheus:v2.56.0 # The server
+redis-example:
+    exporter:
+        enabled: true
+        image: cgr.dev/chainguard/prometheus-redis-exporter
+        tag: v1.76.0
+    image:
+        registry: cgr.dev
+        repository: chainguard/redis
+global:
+  image:
+    repository: "cgr.dev/chainguard/argocd"
+    tag: ""
+unknown:
+  image:
+    repository: unknown/image
+    tag: 1.0
+`)
+
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"ecr-public.aws.com/docker/library/redis": {
+				"cgr.dev/chainguard/redis:latest",
+			},
+			"ghcr.io/oliver006/redis_exporter:v1.75.0": {
+				"cgr.dev/chainguard/prometheus-redis-exporter:v1.76.0",
+			},
+			"quay.io/argoproj/argocd": {
+				"cgr.dev/chainguard/argocd:latest",
+			},
+			"prom/prometheus:v2.18.1": {
+				"cgr.dev/chainguard/prometheus:v2.56.0",
+			},
+		},
+	}
+
+	got, err := RewriteValues(m, input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(string(want), string(got)); diff != "" {
+		t.Errorf("unexpected output:\n%s", diff)
+	}
+}
+
+func TestFindImages(t *testing.T) {
+	input := []byte(`name: example
+server:
+  image:
+    registry: quay.io
+    repository: argoproj/argocd
+    tag: v3.2.1
+exporter:
+  enabled: true
+  image: ghcr.io/oliver006/redis_exporter:v1.75.0
+sidecars:
+  - name: proxy
+    image:
+      name: traefik
+extraContainers:
+  - name: proxy
+    image: nginx:1.27
+`)
+
+	want := []ValuesImage{
+		{Path: "server.image", Image: "quay.io/argoproj/argocd:v3.2.1", Line: 5},
+		{Path: "exporter", Image: "ghcr.io/oliver006/redis_exporter:v1.75.0", Line: 9},
+		{Path: "sidecars.image", Image: "traefik", Line: 13},
+		{Path: "extraContainers", Image: "nginx:1.27", Line: 16},
+	}
+
+	got, err := FindImages(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+}
+
+func TestTagValue(t *testing.T) {
+	testCases := map[string]string{
+		"cgr.dev/chainguard/nginx:1.27":               "1.27",
+		"cgr.dev/chainguard/nginx":                    "latest",
+		"cgr.dev/chainguard/nginx:1.27@" + testDigest: "1.27@" + testDigest,
+		"cgr.dev/chainguard/nginx@" + testDigest:      "latest@" + testDigest,
+	}
+
+	for img, want := range testCases {
+		t.Run(img, func(t *testing.T) {
+			ref, err := name.ParseReference(img)
+			if err != nil {
+				t.Fatalf("unexpected error parsing image: %s", err)
+			}
+
+			if got := tagValue(ref); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+const testDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000001"
+
+func TestMapValuesCharts(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			// Bitnami Redis, with global.imageRegistry set
+			"mirror.example.com/bitnami/redis:7.4.2-debian-12-r0": {
+				"cgr.dev/chainguard/redis:7.4",
+			},
+			"mirror.example.com/bitnami/redis-exporter:1.67.0-debian-12-r0": {
+				"cgr.dev/chainguard/prometheus-redis-exporter:1.67",
+			},
+			"mirror.example.com/bitnami/os-shell:12-debian-12-r35": {
+				"cgr.dev/chainguard/wolfi-base:latest",
+			},
+			"docker.io/fluent/fluent-bit:3.2.4": {
+				"cgr.dev/chainguard/fluent-bit:3.2",
+			},
+
+			// kube-prometheus-stack
+			"quay.io/prometheus/alertmanager:v0.28.0": {
+				"cgr.dev/chainguard/prometheus-alertmanager:0.28",
+			},
+			"quay.io/prometheus/prometheus:v3.1.0": {
+				"cgr.dev/chainguard/prometheus:3.1@" + testDigest,
+			},
+			"quay.io/prometheus-operator/prometheus-operator": {
+				"cgr.dev/chainguard/prometheus-operator:latest",
+			},
+			"quay.io/prometheus-operator/prometheus-config-reloader": {
+				"cgr.dev/chainguard/prometheus-config-reloader:latest",
+			},
+			"registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.5.1": {
+				"cgr.dev/chainguard/kube-webhook-certgen:1.5",
+			},
+			"quay.io/oauth2-proxy/oauth2-proxy:v7.8.1": {
+				"cgr.dev/chainguard/oauth2-proxy:7.8",
+			},
+
+			// ingress-nginx
+			"registry.k8s.io/ingress-nginx/controller:v1.12.0": {
+				"cgr.dev/chainguard/ingress-nginx-controller:1.12",
+			},
+			"registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.5.0": {
+				"cgr.dev/chainguard/kube-webhook-certgen:1.5@" + testDigest,
+			},
+			"nginx:latest": {
+				"cgr.dev/chainguard/nginx:latest",
+			},
+		},
+	}
+
+	testCases := []string{
+		"bitnami-redis",
+		"kube-prometheus-stack",
+		"ingress-nginx",
+	}
+
+	for _, name := range testCases {
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(fmt.Sprintf("testdata/values/%s.values.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading values file: %s", err)
+			}
+
+			mapped, err := os.ReadFile(fmt.Sprintf("testdata/values/%s.mapped.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading mapped file: %s", err)
+			}
+
+			rewritten, err := os.ReadFile(fmt.Sprintf("testdata/values/%s.rewritten.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading rewritten file: %s", err)
+			}
+
+			got, err := mapValues(m, input)
+			if err != nil {
+				t.Fatalf("unexpected error mapping values: %s", err)
+			}
+			if diff := cmp.Diff(string(mapped), string(got)); diff != "" {
+				t.Errorf("unexpected mapped values:\n%s", diff)
+			}
+
+			got, err = RewriteValues(m, input)
+			if err != nil {
+				t.Fatalf("unexpected error rewriting values: %s", err)
+			}
+			if diff := cmp.Diff(string(rewritten), string(got)); diff != "" {
+				t.Errorf("unexpected rewritten values:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"gopkg.in/yaml.v3"
+)
+
+// VerifyStatus is the outcome of verifying an image in a chart
+type VerifyStatus string
+
+const (
+	// VerifyStatusMapped means the image was changed to the repository
+	// that it maps to
+	VerifyStatusMapped VerifyStatus = "mapped"
+
+	// VerifyStatusUnmapped means the image has no mapping, so it wasn't
+	// expected to change
+	VerifyStatusUnmapped VerifyStatus = "unmapped"
+
+	// VerifyStatusUpstream means the image has a mapping but the mapped
+	// values didn't change it
+	VerifyStatusUpstream VerifyStatus = "upstream"
+
+	// VerifyStatusUnexpected means the image was changed to a repository
+	// other than the one that it maps to
+	VerifyStatusUnexpected VerifyStatus = "unexpected"
+
+	// VerifyStatusMissing means the container wasn't in the manifests
+	// rendered with the mapped values
+	VerifyStatusMissing VerifyStatus = "missing"
+)
+
+// VerifiedImage is a container image in the manifests rendered from a chart,
+// compared to the image in the same container when the chart is rendered with
+// the mapped values
+type VerifiedImage struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Container string
+
+	// Original is the image rendered without the mapped values and Image
+	// is the image rendered with them
+	Original string
+	Image    string
+
+	// Expected is the image that the original image maps to, if any
+	Expected string
+
+	Status VerifyStatus
+}
+
+// Regression returns true if the image wasn't mapped as expected
+func (v VerifiedImage) Regression() bool {
+	switch v.Status {
+	case VerifyStatusUpstream, VerifyStatusUnexpected, VerifyStatusMissing:
+		return true
+	default:
+		return false
+	}
+}
+
+// VerifyChart extracts image related values from a Helm chart and maps them to
+// Chainguard, like MapChart. It then renders the chart with and without the
+// mapped values, and the values in the options, to check that the mapped
+// values change the images in the manifests to the images they map to.
+func VerifyChart(ctx context.Context, chart ChartDescriptor, render RenderOptions, opts ...mapper.Option) ([]byte, []VerifiedImage, error) {
+	dir, cleanup, err := fetchChart(ctx, chart)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cleanup()
+
+	// Construct a mapper
+	m, err := NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return verifyChart(ctx, m, dir, render)
+}
+
+// verifyChart maps the images in the values of the chart and compares the
+// images in the manifests rendered with and without the mapped values
+func verifyChart(ctx context.Context, m mapper.Mapper, dir string, render RenderOptions) ([]byte, []VerifiedImage, error) {
+	output, originals, mapped, err := renderMapped(ctx, m, dir, render)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var verified []VerifiedImage
+	for _, img := range originals {
+		v := VerifiedImage{
+			Kind:      img.Kind,
+			Name:      img.Name,
+			Namespace: img.Namespace,
+			Container: img.Container,
+			Original:  img.Image,
+		}
+		if ref, err := mapper.MapImage(m, img.Image); err == nil {
+			v.Expected = ref.String()
+		}
+
+		image, ok := mapped[containerKey(img)]
+		v.Image = image
+
+		switch {
+		case !ok:
+			v.Status = VerifyStatusMissing
+		case v.Expected == "" && image == img.Image:
+			v.Status = VerifyStatusUnmapped
+		case v.Expected != "" && image == img.Image:
+			v.Status = VerifyStatusUpstream
+		case v.Expected != "" && repoName(image) == repoName(v.Expected):
+			v.Status = VerifyStatusMapped
+		default:
+			v.Status = VerifyStatusUnexpected
+		}
+
+		verified = append(verified, v)
+	}
+
+	return output, verified, nil
+}
+
+// renderMapped maps the images in the values of the chart and renders it with
+// and without the mapped values. It returns the mapped values, the images
+// rendered without them and the images rendered with them, by container.
+func renderMapped(ctx context.Context, m mapper.Mapper, dir string, render RenderOptions) ([]byte, []k8s.ContainerImage, map[[4]string]string, error) {
+	output, err := mapChart(m, dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var overrides map[string]any
+	if err := yaml.Unmarshal(output, &overrides); err != nil {
+		return nil, nil, nil, fmt.Errorf("unmarshalling mapped values: %w", err)
+	}
+
+	chartPath, err := findChart(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	originals, err := renderImages(ctx, chartPath, render, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	images, err := renderImages(ctx, chartPath, render, overrides)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("with mapped values: %w", err)
+	}
+
+	// Match up the containers in the two renders
+	mapped := map[[4]string]string{}
+	for _, img := range images {
+		mapped[containerKey(img)] = img.Image
+	}
+
+	return output, originals, mapped, nil
+}
+
+// containerKey identifies a container in the rendered manifests
+func containerKey(img k8s.ContainerImage) [4]string {
+	return [4]string{img.Kind, img.Namespace, img.Name, img.Container}
+}
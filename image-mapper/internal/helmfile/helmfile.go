@@ -0,0 +1,238 @@
+package helmfile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"gopkg.in/yaml.v3"
+)
+
+// mappedComment marks the values that were added to a release by image-mapper,
+// so that they're replaced, rather than added again, when the helmfile is
+// mapped again
+const mappedComment = "Images mapped to Chainguard by image-mapper"
+
+// Map maps the images in the charts of the releases in a helmfile to
+// Chainguard, and returns the helmfile with the values that override them
+// added to each release. Relative paths to charts and values files are
+// resolved from dir.
+func Map(ctx context.Context, input []byte, dir string, opts ...mapper.Option) ([]byte, error) {
+	m, err := helm.NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return Rewrite(ctx, m, input, dir)
+}
+
+// Rewrite maps the releases in a helmfile with the provided mapper, so that
+// many files can be mapped without constructing a new mapper for each one
+func Rewrite(ctx context.Context, m mapper.Mapper, input []byte, dir string) ([]byte, error) {
+	docs, err := yamlhelpers.DecodeDocuments(input)
+	if err != nil {
+		return nil, fmt.Errorf("decoding helmfile: %w", err)
+	}
+
+	// Repositories can be defined in any of the documents
+	repos := map[string]repository{}
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		for name, repo := range findRepositories(doc.Content[0]) {
+			repos[name] = repo
+		}
+	}
+
+	var changed bool
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+		releases := yamlhelpers.Lookup(doc.Content[0], "releases")
+		if releases == nil || releases.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, release := range releases.Content {
+			ok, err := mapRelease(ctx, m, release, repos, dir)
+			if err != nil {
+				return nil, fmt.Errorf("release %s: %w", yamlhelpers.ScalarValue(yamlhelpers.Lookup(release, "name")), err)
+			}
+			changed = changed || ok
+		}
+	}
+
+	// Helmfiles without any releases to map are returned as they are,
+	// rather than re-encoded, so that they aren't changed when a directory
+	// is rewritten
+	if !changed {
+		return input, nil
+	}
+
+	output, err := yamlhelpers.EncodeDocuments(docs)
+	if err != nil {
+		return nil, fmt.Errorf("encoding helmfile: %w", err)
+	}
+
+	return output, nil
+}
+
+// repository is a chart repository in a helmfile
+type repository struct {
+	url string
+	oci bool
+}
+
+// findRepositories returns the repositories in a helmfile, by name
+func findRepositories(node *yaml.Node) map[string]repository {
+	repos := map[string]repository{}
+
+	seq := yamlhelpers.Lookup(node, "repositories")
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return repos
+	}
+	for _, item := range seq.Content {
+		name := yamlhelpers.ScalarValue(yamlhelpers.Lookup(item, "name"))
+		if name == "" {
+			continue
+		}
+		repos[name] = repository{
+			url: yamlhelpers.ScalarValue(yamlhelpers.Lookup(item, "url")),
+			oci: yamlhelpers.ScalarValue(yamlhelpers.Lookup(item, "oci")) == "true",
+		}
+	}
+
+	return repos
+}
+
+// mapRelease maps the images in the chart, and values, of a release and adds
+// the values that override them to the end of the values of the release. It
+// returns true if the release changed.
+func mapRelease(ctx context.Context, m mapper.Mapper, release *yaml.Node, repos map[string]repository, dir string) (bool, error) {
+	chart, err := resolveChart(release, repos, dir)
+	if err != nil {
+		return false, err
+	}
+
+	// Replace the values added by a previous run, rather than adding
+	// them again
+	var removed bool
+	valuesNode := yamlhelpers.Lookup(release, "values")
+	if valuesNode != nil && valuesNode.Kind == yaml.SequenceNode {
+		if n := len(valuesNode.Content); n > 0 && valuesNode.Content[n-1].HeadComment == "# "+mappedComment {
+			valuesNode.Content = valuesNode.Content[:n-1]
+			removed = true
+		}
+	}
+
+	values, err := readValues(valuesNode, dir)
+	if err != nil {
+		return false, err
+	}
+
+	overrides, err := helm.MapRelease(ctx, m, chart, values...)
+	if err != nil {
+		return false, err
+	}
+	if len(overrides.Content) == 0 {
+		return removed, nil
+	}
+	overrides.HeadComment = mappedComment
+
+	if valuesNode == nil || valuesNode.Kind != yaml.SequenceNode {
+		valuesNode = &yaml.Node{Kind: yaml.SequenceNode}
+		yamlhelpers.AddNode([]string{"values"}, release, valuesNode)
+	}
+	valuesNode.Content = append(valuesNode.Content, overrides)
+
+	return true, nil
+}
+
+// resolveChart returns the chart of a release. Charts are referenced by a path,
+// an OCI reference or <repository>/<chart>, where the repository is one of the
+// repositories in the helmfile.
+func resolveChart(release *yaml.Node, repos map[string]repository, dir string) (helm.ChartDescriptor, error) {
+	ref := yamlhelpers.ScalarValue(yamlhelpers.Lookup(release, "chart"))
+	if ref == "" {
+		return helm.ChartDescriptor{}, fmt.Errorf("missing chart")
+	}
+	chart := helm.ChartDescriptor{
+		Name:    ref,
+		Version: yamlhelpers.ScalarValue(yamlhelpers.Lookup(release, "version")),
+	}
+
+	if strings.HasPrefix(ref, "oci://") {
+		return chart, nil
+	}
+
+	// Charts on disk are relative to the helmfile
+	path := ref
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, ref)
+	}
+	if _, err := os.Stat(path); err == nil {
+		chart.Name = path
+		return chart, nil
+	}
+
+	repoName, name, ok := strings.Cut(ref, "/")
+	if !ok {
+		return helm.ChartDescriptor{}, fmt.Errorf("chart %s: not a path or <repository>/<chart>", ref)
+	}
+	repo, ok := repos[repoName]
+	if !ok {
+		return helm.ChartDescriptor{}, fmt.Errorf("chart %s: unknown repository: %s", ref, repoName)
+	}
+	if repo.oci {
+		chart.Name = fmt.Sprintf("oci://%s/%s", strings.TrimSuffix(strings.TrimPrefix(repo.url, "oci://"), "/"), name)
+		return chart, nil
+	}
+	chart.Name = name
+	chart.Repository = repo.url
+
+	return chart, nil
+}
+
+// readValues returns the values of a release, in order. These are either inline
+// or in files relative to the helmfile. Templated values files can't be read,
+// so they're skipped.
+func readValues(node *yaml.Node, dir string) ([][]byte, error) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+
+	var values [][]byte
+	for _, item := range node.Content {
+		switch item.Kind {
+		case yaml.MappingNode:
+			v, err := yaml.Marshal(item)
+			if err != nil {
+				return nil, fmt.Errorf("marshalling values: %w", err)
+			}
+			values = append(values, v)
+		case yaml.ScalarNode:
+			path := item.Value
+			if strings.HasSuffix(path, ".gotmpl") || strings.Contains(path, "{{") {
+				log.Printf("WARN: skipping templated values file: %s", path)
+				continue
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			v, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("reading values file: %w", err)
+			}
+			values = append(values, v)
+		}
+	}
+
+	return values, nil
+}
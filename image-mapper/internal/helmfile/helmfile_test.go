@@ -0,0 +1,179 @@
+package helmfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+type mockMapper struct {
+	mappings map[string][]string
+}
+
+func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
+	mapping := &mapper.Mapping{
+		Image:   img,
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
+}
+
+func TestRewrite(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"nginx:1.27": {
+				"cgr.dev/chainguard/nginx:1.27",
+			},
+			"docker.io/bitnami/redis:7.4.2-debian-12-r0": {
+				"cgr.dev/chainguard/redis:7.4",
+			},
+			"envoyproxy/envoy:v1.32.0": {
+				"cgr.dev/chainguard/envoy:1.32",
+			},
+		},
+	}
+
+	before, err := os.ReadFile("testdata/helmfile.before.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading before file: %s", err)
+	}
+	after, err := os.ReadFile("testdata/helmfile.after.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading after file: %s", err)
+	}
+
+	got, err := Rewrite(t.Context(), m, before, "testdata")
+	if err != nil {
+		t.Fatalf("unexpected error mapping helmfile: %s", err)
+	}
+	if diff := cmp.Diff(string(after), string(got)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+
+	// Mapping the helmfile again should replace the values that were
+	// added, rather than adding them again
+	again, err := Rewrite(t.Context(), m, got, "testdata")
+	if err != nil {
+		t.Fatalf("unexpected error mapping helmfile again: %s", err)
+	}
+	if diff := cmp.Diff(string(after), string(again)); diff != "" {
+		t.Errorf("unexpected result mapping again:\n%s", diff)
+	}
+}
+
+func TestRewriteUnchanged(t *testing.T) {
+	// The chart doesn't have any images, so nothing is added to the
+	// release and the formatting of the input should be preserved
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "charts", "app"), 0o755); err != nil {
+		t.Fatalf("unexpected error creating chart: %s", err)
+	}
+	for name, content := range map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: app\nversion: 0.1.0\n",
+		"values.yaml": "replicas: 1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "charts", "app", name), []byte(content), 0o644); err != nil {
+			t.Fatalf("unexpected error writing chart: %s", err)
+		}
+	}
+
+	input := []byte(`# Releases
+releases:
+  - name: app
+    chart:   ./charts/app
+    values:
+      - replicas: 2
+`)
+
+	got, err := Rewrite(t.Context(), &mockMapper{}, input, dir)
+	if err != nil {
+		t.Fatalf("unexpected error mapping helmfile: %s", err)
+	}
+	if diff := cmp.Diff(string(input), string(got)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestResolveChart(t *testing.T) {
+	repos := map[string]repository{
+		"bitnami": {
+			url: "https://charts.bitnami.com/bitnami",
+		},
+		"ghcr": {
+			url: "ghcr.io/example/charts",
+			oci: true,
+		},
+	}
+
+	testCases := map[string]struct {
+		chart   string
+		want    helm.ChartDescriptor
+		wantErr bool
+	}{
+		"helm repository": {
+			chart: "bitnami/redis",
+			want: helm.ChartDescriptor{
+				Name:       "redis",
+				Repository: "https://charts.bitnami.com/bitnami",
+				Version:    "1.0.0",
+			},
+		},
+		"oci repository": {
+			chart: "ghcr/app",
+			want: helm.ChartDescriptor{
+				Name:    "oci://ghcr.io/example/charts/app",
+				Version: "1.0.0",
+			},
+		},
+		"oci reference": {
+			chart: "oci://ghcr.io/example/charts/app",
+			want: helm.ChartDescriptor{
+				Name:    "oci://ghcr.io/example/charts/app",
+				Version: "1.0.0",
+			},
+		},
+		"path": {
+			chart: "./charts/app",
+			want: helm.ChartDescriptor{
+				Name:    "testdata/charts/app",
+				Version: "1.0.0",
+			},
+		},
+		"unknown repository": {
+			chart:   "unknown/app",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var release yaml.Node
+			if err := yaml.Unmarshal([]byte("chart: "+tc.chart+"\nversion: 1.0.0\n"), &release); err != nil {
+				t.Fatalf("unexpected error unmarshalling release: %s", err)
+			}
+
+			got, err := resolveChart(release.Content[0], repos, "testdata")
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("unexpected chart:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ClusterOptions configures which pods are listed from a cluster
+type ClusterOptions struct {
+	// Namespaces to list pods in. If it's empty, pods are listed in all
+	// namespaces.
+	Namespaces []string
+
+	// LabelSelector selects pods by their labels, i.e app=web
+	LabelSelector string
+}
+
+// listLimit is the number of pods to request in each page
+const listLimit = 500
+
+type clusterIterator struct {
+	ctx    context.Context
+	client kubernetes.Interface
+	opts   ClusterOptions
+
+	listed bool
+	images []string
+	index  int
+	owners map[string][]mapper.Owner
+
+	// controllers caches the top level controller of each owner
+	// reference, so each ReplicaSet or Job is only fetched once
+	controllers map[mapper.Owner]mapper.Owner
+}
+
+// NewClusterIterator iterates over the images run by the pods in a cluster.
+// Each image is returned once, along with the workloads that run it.
+//
+// Pods are attributed to their top level controller. For instance, a pod owned
+// by a ReplicaSet that's owned by a Deployment is attributed to the
+// Deployment.
+func NewClusterIterator(ctx context.Context, client kubernetes.Interface, opts ClusterOptions) mapper.OwnerIterator {
+	return &clusterIterator{
+		ctx:         ctx,
+		client:      client,
+		opts:        opts,
+		owners:      map[string][]mapper.Owner{},
+		controllers: map[mapper.Owner]mapper.Owner{},
+	}
+}
+
+// Next returns the next image. The pods are listed on the first call.
+func (it *clusterIterator) Next() (string, error) {
+	if !it.listed {
+		if err := it.list(); err != nil {
+			return "", err
+		}
+		it.listed = true
+	}
+
+	if it.index >= len(it.images) {
+		return "", mapper.ErrIteratorDone
+	}
+
+	image := it.images[it.index]
+	it.index++
+
+	return image, nil
+}
+
+// Owners returns the workloads that run the image
+func (it *clusterIterator) Owners(image string) []mapper.Owner {
+	return it.owners[image]
+}
+
+// list lists the pods in each namespace and records their images
+func (it *clusterIterator) list() error {
+	namespaces := it.opts.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	for _, ns := range namespaces {
+		opts := metav1.ListOptions{
+			LabelSelector: it.opts.LabelSelector,
+			Limit:         listLimit,
+		}
+		for {
+			pods, err := it.client.CoreV1().Pods(ns).List(it.ctx, opts)
+			if err != nil {
+				return fmt.Errorf("listing pods: %w", err)
+			}
+
+			for _, pod := range pods.Items {
+				it.addPod(&pod)
+			}
+
+			if pods.Continue == "" {
+				break
+			}
+			opts.Continue = pods.Continue
+		}
+	}
+
+	slices.Sort(it.images)
+
+	return nil
+}
+
+// addPod records the images run by the containers in the pod
+func (it *clusterIterator) addPod(pod *corev1.Pod) {
+	owner := it.owner(pod)
+
+	var images []string
+	for _, c := range pod.Spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range pod.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		images = append(images, c.Image)
+	}
+
+	for _, image := range images {
+		if image == "" {
+			continue
+		}
+
+		owners, seen := it.owners[image]
+		if !seen {
+			it.images = append(it.images, image)
+		}
+		if !slices.Contains(owners, owner) {
+			owners = append(owners, owner)
+			slices.SortFunc(owners, compareOwners)
+		}
+		it.owners[image] = owners
+	}
+}
+
+// owner returns the top level controller of the pod, or the pod itself if it
+// isn't controlled by anything
+func (it *clusterIterator) owner(pod *corev1.Pod) mapper.Owner {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return mapper.Owner{
+			Kind:      "Pod",
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		}
+	}
+
+	return it.controller(mapper.Owner{
+		Kind:      ref.Kind,
+		Name:      ref.Name,
+		Namespace: pod.Namespace,
+	})
+}
+
+// controller follows the owner references of ReplicaSets and Jobs to the
+// Deployments and CronJobs that create them
+func (it *clusterIterator) controller(owner mapper.Owner) mapper.Owner {
+	if controller, ok := it.controllers[owner]; ok {
+		return controller
+	}
+
+	var (
+		obj metav1.Object
+		err error
+	)
+	switch owner.Kind {
+	case "ReplicaSet":
+		obj, err = it.client.AppsV1().ReplicaSets(owner.Namespace).Get(it.ctx, owner.Name, metav1.GetOptions{})
+	case "Job":
+		obj, err = it.client.BatchV1().Jobs(owner.Namespace).Get(it.ctx, owner.Name, metav1.GetOptions{})
+	default:
+		return owner
+	}
+
+	controller := owner
+	switch {
+	case err != nil:
+		log.Printf("WARN: getting owner of %s: %s", owner, err)
+	default:
+		if ref := metav1.GetControllerOfNoCopy(obj); ref != nil {
+			controller = mapper.Owner{
+				Kind:      ref.Kind,
+				Name:      ref.Name,
+				Namespace: owner.Namespace,
+			}
+		}
+	}
+	it.controllers[owner] = controller
+
+	return controller
+}
+
+// compareOwners orders owners by kind, namespace and name
+func compareOwners(a, b mapper.Owner) int {
+	return strings.Compare(a.String(), b.String())
+}
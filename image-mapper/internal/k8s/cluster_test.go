@@ -0,0 +1,171 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestClusterIterator(t *testing.T) {
+	objects := []runtime.Object{
+		&appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "web-5d4f8",
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{controllerRef("Deployment", "web")},
+			},
+		},
+		&batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "backup-28901",
+				Namespace:       "ops",
+				OwnerReferences: []metav1.OwnerReference{controllerRef("CronJob", "backup")},
+			},
+		},
+		newPod("default", "web-5d4f8-a", map[string]string{"app": "web"}, "ReplicaSet", "web-5d4f8", "nginx:1.25", "busybox:1.36"),
+		newPod("default", "web-5d4f8-b", map[string]string{"app": "web"}, "ReplicaSet", "web-5d4f8", "nginx:1.25", "busybox:1.36"),
+		newPod("default", "db-0", map[string]string{"app": "db"}, "StatefulSet", "db", "postgres:16"),
+		newPod("ops", "backup-28901-x", map[string]string{"app": "backup"}, "Job", "backup-28901", "postgres:16"),
+		newPod("ops", "debug", nil, "", "", "busybox:1.36"),
+		// The ReplicaSet for this pod doesn't exist, so it's attributed
+		// to the ReplicaSet
+		newPod("ops", "orphan-abc-x", nil, "ReplicaSet", "orphan-abc", "redis:7"),
+	}
+
+	testCases := []struct {
+		name   string
+		opts   ClusterOptions
+		images []string
+		owners map[string][]mapper.Owner
+	}{
+		{
+			name:   "all namespaces",
+			images: []string{"busybox:1.36", "nginx:1.25", "postgres:16", "redis:7"},
+			owners: map[string][]mapper.Owner{
+				"busybox:1.36": {
+					{Kind: "Deployment", Name: "web", Namespace: "default"},
+					{Kind: "Pod", Name: "debug", Namespace: "ops"},
+				},
+				"nginx:1.25": {
+					{Kind: "Deployment", Name: "web", Namespace: "default"},
+				},
+				"postgres:16": {
+					{Kind: "CronJob", Name: "backup", Namespace: "ops"},
+					{Kind: "StatefulSet", Name: "db", Namespace: "default"},
+				},
+				"redis:7": {
+					{Kind: "ReplicaSet", Name: "orphan-abc", Namespace: "ops"},
+				},
+			},
+		},
+		{
+			name:   "namespace",
+			opts:   ClusterOptions{Namespaces: []string{"ops"}},
+			images: []string{"busybox:1.36", "postgres:16", "redis:7"},
+			owners: map[string][]mapper.Owner{
+				"busybox:1.36": {
+					{Kind: "Pod", Name: "debug", Namespace: "ops"},
+				},
+				"postgres:16": {
+					{Kind: "CronJob", Name: "backup", Namespace: "ops"},
+				},
+				"redis:7": {
+					{Kind: "ReplicaSet", Name: "orphan-abc", Namespace: "ops"},
+				},
+			},
+		},
+		{
+			name:   "label selector",
+			opts:   ClusterOptions{LabelSelector: "app in (web, db)"},
+			images: []string{"busybox:1.36", "nginx:1.25", "postgres:16"},
+			owners: map[string][]mapper.Owner{
+				"busybox:1.36": {
+					{Kind: "Deployment", Name: "web", Namespace: "default"},
+				},
+				"nginx:1.25": {
+					{Kind: "Deployment", Name: "web", Namespace: "default"},
+				},
+				"postgres:16": {
+					{Kind: "StatefulSet", Name: "db", Namespace: "default"},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := fake.NewClientset(objects...)
+			it := NewClusterIterator(context.Background(), client, tc.opts)
+
+			var images []string
+			for {
+				image, err := it.Next()
+				if err == mapper.ErrIteratorDone {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				images = append(images, image)
+			}
+
+			if diff := cmp.Diff(tc.images, images); diff != "" {
+				t.Errorf("unexpected images (-want +got):\n%s", diff)
+			}
+
+			owners := map[string][]mapper.Owner{}
+			for _, image := range images {
+				owners[image] = it.Owners(image)
+			}
+			if diff := cmp.Diff(tc.owners, owners); diff != "" {
+				t.Errorf("unexpected owners (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func controllerRef(kind, name string) metav1.OwnerReference {
+	controller := true
+	return metav1.OwnerReference{
+		Kind:       kind,
+		Name:       name,
+		Controller: &controller,
+	}
+}
+
+func newPod(namespace, name string, labels map[string]string, ownerKind, ownerName string, images ...string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    labels,
+		},
+	}
+	if ownerKind != "" {
+		pod.OwnerReferences = []metav1.OwnerReference{controllerRef(ownerKind, ownerName)}
+	}
+	for i, image := range images {
+		container := corev1.Container{
+			Name:  fmt.Sprintf("c%d", i),
+			Image: image,
+		}
+		// Put the first container of pods with several in the init
+		// containers
+		if i == 0 && len(images) > 1 {
+			pod.Spec.InitContainers = append(pod.Spec.InitContainers, container)
+			continue
+		}
+		pod.Spec.Containers = append(pod.Spec.Containers, container)
+	}
+
+	return pod
+}
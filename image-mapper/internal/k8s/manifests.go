@@ -0,0 +1,166 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"gopkg.in/yaml.v3"
+)
+
+// ContainerImage is a container image referenced by a Kubernetes manifest
+type ContainerImage struct {
+	Kind      string
+	Name      string
+	Namespace string
+	Container string
+	Image     string
+	Line      int
+
+	node *yaml.Node
+}
+
+// podSpecPaths are the paths to the pod spec in each kind of workload
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"PodTemplate":           {"template", "spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// containerKeys are the keys in a pod spec that list containers
+var containerKeys = []string{
+	"initContainers",
+	"containers",
+	"ephemeralContainers",
+}
+
+// Map images in Kubernetes manifests to their Chainguard equivalents
+func Map(ctx context.Context, input []byte, opts ...mapper.Option) ([]byte, error) {
+	m, err := NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	return mapManifests(m, input)
+}
+
+// Rewrite maps images in Kubernetes manifests with the provided mapper, so
+// that many files can be mapped without constructing a new mapper for each one
+func Rewrite(m mapper.Mapper, input []byte) ([]byte, error) {
+	return mapManifests(m, input)
+}
+
+// mapManifests rewrites the container images in the manifests. Everything
+// other than the images, including comments and formatting, is preserved.
+func mapManifests(m mapper.Mapper, input []byte) ([]byte, error) {
+	images, err := FindImages(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var edits []yamlhelpers.Edit
+	for _, img := range images {
+		mapped, err := mapper.MapImage(m, img.Image)
+		if err != nil {
+			log.Printf("WARN: error mapping image: %s: %s", img.Image, err)
+			continue
+		}
+
+		edits = append(edits, yamlhelpers.Edit{
+			Node:  img.node,
+			Value: mapped.String(),
+		})
+	}
+
+	output, err := yamlhelpers.ApplyEdits(input, edits)
+	if err != nil {
+		return nil, fmt.Errorf("editing manifests: %w", err)
+	}
+
+	return output, nil
+}
+
+// FindImages returns the container images referenced by workloads in a stream
+// of YAML manifests. Documents that aren't workloads are ignored, as are the
+// items in a List that aren't workloads.
+func FindImages(input []byte) ([]ContainerImage, error) {
+	var images []ContainerImage
+
+	docs, err := yamlhelpers.DecodeDocuments(input)
+	if err != nil {
+		return nil, fmt.Errorf("decoding manifests: %w", err)
+	}
+	for _, doc := range docs {
+		if len(doc.Content) == 0 {
+			continue
+		}
+
+		images = append(images, findImages(doc.Content[0])...)
+	}
+
+	return images, nil
+}
+
+// findImages returns the container images in a manifest
+func findImages(node *yaml.Node) []ContainerImage {
+	kind := yamlhelpers.ScalarValue(yamlhelpers.Lookup(node, "kind"))
+
+	// Lists (i.e List, DeploymentList) contain other manifests
+	if strings.HasSuffix(kind, "List") {
+		items := yamlhelpers.Lookup(node, "items")
+		if items == nil || items.Kind != yaml.SequenceNode {
+			return nil
+		}
+
+		var images []ContainerImage
+		for _, item := range items.Content {
+			images = append(images, findImages(item)...)
+		}
+		return images
+	}
+
+	path, ok := podSpecPaths[kind]
+	if !ok {
+		return nil
+	}
+	podSpec := yamlhelpers.Lookup(node, path...)
+	if podSpec == nil {
+		return nil
+	}
+
+	var images []ContainerImage
+	for _, key := range containerKeys {
+		containers := yamlhelpers.Lookup(podSpec, key)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		for _, container := range containers.Content {
+			image := yamlhelpers.Lookup(container, "image")
+			if image == nil || image.Kind != yaml.ScalarNode || image.Value == "" {
+				continue
+			}
+
+			images = append(images, ContainerImage{
+				Kind:      kind,
+				Name:      yamlhelpers.ScalarValue(yamlhelpers.Lookup(node, "metadata", "name")),
+				Namespace: yamlhelpers.ScalarValue(yamlhelpers.Lookup(node, "metadata", "namespace")),
+				Container: yamlhelpers.ScalarValue(yamlhelpers.Lookup(container, "name")),
+				Image:     image.Value,
+				Line:      image.Line,
+				node:      image,
+			})
+		}
+	}
+
+	return images
+}
@@ -0,0 +1,102 @@
+package k8s
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+type mockMapper struct {
+	mappings map[string][]string
+}
+
+func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
+	mapping := &mapper.Mapping{
+		Image:   img,
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
+}
+
+func TestMapManifests(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"busybox:1.36": {
+				"cgr.dev/chainguard/busybox:1.36",
+			},
+			"nginx:1.25": {
+				"cgr.dev/chainguard/nginx:1.27",
+			},
+			"python:3.13": {
+				"cgr.dev/chainguard/python:3.13",
+			},
+		},
+	}
+
+	testCases := map[string]struct{}{
+		"workloads": {},
+	}
+
+	for name := range testCases {
+		t.Run(name, func(t *testing.T) {
+			before, err := os.ReadFile(fmt.Sprintf("testdata/%s.before.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading before file: %s", err)
+			}
+
+			after, err := os.ReadFile(fmt.Sprintf("testdata/%s.after.yaml", name))
+			if err != nil {
+				t.Fatalf("unexpected error reading after file: %s", err)
+			}
+
+			result, err := mapManifests(m, before)
+			if err != nil {
+				t.Fatalf("unexpected error mapping manifests: %s", err)
+			}
+
+			if diff := cmp.Diff(string(after), string(result)); diff != "" {
+				t.Errorf("unexpected result:\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFindImages(t *testing.T) {
+	input, err := os.ReadFile("testdata/workloads.before.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading file: %s", err)
+	}
+
+	got, err := FindImages(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []ContainerImage{
+		{Kind: "Deployment", Name: "web", Namespace: "default", Container: "init", Image: "busybox:1.36", Line: 12},
+		{Kind: "Deployment", Name: "web", Namespace: "default", Container: "web", Image: "nginx:1.25", Line: 15},
+		{Kind: "Deployment", Name: "web", Namespace: "default", Container: "sidecar", Image: "python:3.13", Line: 19},
+		{Kind: "CronJob", Name: "backup", Container: "backup", Image: "python:3.13", Line: 33},
+		{Kind: "Pod", Name: "debug", Container: "debug", Image: "unknown/image:1.0", Line: 55},
+		{Kind: "Pod", Name: "debug", Container: "debugger", Image: "busybox:1.36", Line: 58},
+		{Kind: "StatefulSet", Name: "db", Container: "db", Image: "nginx:1.25", Line: 68},
+	}
+
+	if diff := cmp.Diff(want, got, cmpopts.IgnoreUnexported(ContainerImage{})); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+}
+
+func TestFindImagesInvalidYAML(t *testing.T) {
+	if _, err := FindImages([]byte("kind: [")); err == nil {
+		t.Error("expected error for invalid yaml")
+	}
+}
@@ -0,0 +1,27 @@
+package k8s
+
+import (
+	"context"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+)
+
+// NewMapper returns a mapper.Mapper configured specifically for mapping images
+// in Kubernetes manifests
+func NewMapper(ctx context.Context, opts ...mapper.Option) (mapper.Mapper, error) {
+	defaultOpts := []mapper.Option{
+		mapper.WithIgnoreFns(
+			// Iamguarded images are only designed to be
+			// used with our Helm charts.
+			mapper.IgnoreIamguarded(),
+			// TODO: make it possible select only
+			// FIPS images
+			mapper.IgnoreTiers([]string{"FIPS"}),
+		),
+		// The images in manifests are typically run as they are,
+		// without a shell or package manager, so exclude -dev tags.
+		mapper.WithTagFilters(mapper.TagFilterExcludeDev),
+	}
+
+	return mapper.NewMapper(ctx, append(defaultOpts, opts...)...)
+}
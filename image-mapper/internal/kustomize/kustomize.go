@@ -0,0 +1,474 @@
+package kustomize
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/yamlhelpers"
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+)
+
+// kustomizationFiles are the file names that kustomize recognises as a
+// kustomization, in order of precedence
+var kustomizationFiles = []string{
+	"kustomization.yaml",
+	"kustomization.yml",
+	"Kustomization",
+}
+
+// Image is an entry in the images list of a kustomization
+type Image struct {
+	Name    string `yaml:"name"`
+	NewName string `yaml:"newName,omitempty"`
+	NewTag  string `yaml:"newTag,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+}
+
+// kustomization contains the fields of a kustomization that reference
+// manifests or change their images
+type kustomization struct {
+	Resources  []string `yaml:"resources"`
+	Bases      []string `yaml:"bases"`
+	Components []string `yaml:"components"`
+	Images     []Image  `yaml:"images"`
+}
+
+// image is a container image in a kustomization
+type image struct {
+	// name is the name that the images list of the kustomization matches
+	// the image by
+	name string
+
+	// ref is the image that kustomize deploys, after the images list is
+	// applied
+	ref string
+}
+
+// Map maps the images in the kustomization in dir to Chainguard and returns its
+// kustomization file with the images list patched to include the mappings
+func Map(ctx context.Context, dir string, opts ...mapper.Option) ([]byte, error) {
+	path, err := findKustomization(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading kustomization: %w", err)
+	}
+
+	images, err := MapImages(ctx, dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return patchKustomization(input, images)
+}
+
+// MapImages maps the images in the kustomization in dir to Chainguard and
+// returns them as entries for the images list of a kustomization
+func MapImages(ctx context.Context, dir string, opts ...mapper.Option) ([]Image, error) {
+	m, err := k8s.NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+
+	images, err := findImages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return mapImages(m, images), nil
+}
+
+// FindImages returns the container images that the kustomization in dir
+// deploys, including those in its bases and components, with the images lists
+// of the kustomizations applied. Remote resources are skipped.
+func FindImages(dir string) ([]string, error) {
+	found, err := findImages(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []string
+	for _, img := range found {
+		if !slices.Contains(images, img.ref) {
+			images = append(images, img.ref)
+		}
+	}
+
+	slices.Sort(images)
+
+	return images, nil
+}
+
+// findImages returns the container images in the kustomization in dir, along
+// with the names that its images list matches them by
+func findImages(dir string) ([]image, error) {
+	found, entries, err := walkKustomization(dir, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	var images []image
+	for _, img := range found {
+		i := image{
+			name: imageName(img.Image),
+			ref:  applyImages(entries, img.Image),
+		}
+		if !slices.Contains(images, i) {
+			images = append(images, i)
+		}
+	}
+
+	slices.SortFunc(images, func(a, b image) int {
+		return strings.Compare(a.ref, b.ref)
+	})
+
+	return images, nil
+}
+
+// walkKustomization returns the container images in the kustomization in dir
+// and its images list. The images lists of the bases and components are applied
+// to the images, like kustomize does, but the images list of the kustomization
+// itself isn't.
+func walkKustomization(dir string, visited map[string]bool) ([]k8s.ContainerImage, []Image, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolving path: %s: %w", dir, err)
+	}
+	if visited[abs] {
+		return nil, nil, nil
+	}
+	visited[abs] = true
+
+	path, err := findKustomization(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading kustomization: %w", err)
+	}
+
+	var k kustomization
+	if err := yaml.Unmarshal(data, &k); err != nil {
+		return nil, nil, fmt.Errorf("decoding kustomization: %s: %w", path, err)
+	}
+
+	var images []k8s.ContainerImage
+	for _, resource := range slices.Concat(k.Resources, k.Bases) {
+		found, entries, err := walkResource(dir, resource, visited)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, img := range found {
+			img.Image = applyImages(entries, img.Image)
+			images = append(images, img)
+		}
+	}
+
+	// Components are applied to the resources of the kustomization that
+	// includes them, so their images lists apply to every image so far
+	var componentEntries []Image
+	for _, component := range k.Components {
+		found, entries, err := walkResource(dir, component, visited)
+		if err != nil {
+			return nil, nil, err
+		}
+		images = append(images, found...)
+		componentEntries = append(componentEntries, entries...)
+	}
+	for i := range images {
+		images[i].Image = applyImages(componentEntries, images[i].Image)
+	}
+
+	return images, k.Images, nil
+}
+
+// walkResource returns the container images in a resource of the kustomization
+// in dir and, if the resource is a directory, the images list of its
+// kustomization
+func walkResource(dir string, resource string, visited map[string]bool) ([]k8s.ContainerImage, []Image, error) {
+	if isRemote(resource) {
+		log.Printf("WARN: skipping remote resource: %s", resource)
+		return nil, nil, nil
+	}
+
+	resourcePath := filepath.Join(dir, resource)
+	info, err := os.Stat(resourcePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading resource: %w", err)
+	}
+
+	if info.IsDir() {
+		return walkKustomization(resourcePath, visited)
+	}
+
+	input, err := os.ReadFile(resourcePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading resource: %w", err)
+	}
+
+	images, err := k8s.FindImages(input)
+	if err != nil {
+		return nil, nil, fmt.Errorf("finding images: %s: %w", resourcePath, err)
+	}
+
+	return images, nil, nil
+}
+
+// findKustomization returns the path to the kustomization file in dir
+func findKustomization(dir string) (string, error) {
+	for _, file := range kustomizationFiles {
+		path := filepath.Join(dir, file)
+		_, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("finding kustomization: %w", err)
+		}
+
+		return path, nil
+	}
+
+	return "", fmt.Errorf("no kustomization found in: %s", dir)
+}
+
+// isRemote returns true if the resource refers to a remote target, like a git
+// repository or URL, rather than a local file or directory
+func isRemote(resource string) bool {
+	return strings.Contains(resource, "://") ||
+		strings.HasPrefix(resource, "github.com/") ||
+		strings.HasPrefix(resource, "git@") ||
+		strings.Contains(resource, "?ref=")
+}
+
+// mapImages maps images to entries for the images list of a kustomization.
+//
+// Kustomize matches images by name, ignoring the tag or digest. If there are
+// multiple tags of the same image that map to different results, then the
+// first one is used.
+func mapImages(m mapper.Mapper, images []image) []Image {
+	var (
+		entries []Image
+		sources = map[string]string{}
+	)
+	for _, img := range images {
+		mapped, err := mapper.MapImage(m, img.ref)
+		if err != nil {
+			log.Printf("WARN: error mapping image: %s: %s", img.ref, err)
+			continue
+		}
+
+		entry := newImage(img.name, mapped)
+
+		i := slices.IndexFunc(entries, func(e Image) bool {
+			return e.Name == entry.Name
+		})
+		if i != -1 {
+			if entries[i] != entry {
+				log.Printf("WARN: %s and %s map to different images, using the mapping for %s", sources[entry.Name], img.ref, sources[entry.Name])
+			}
+			continue
+		}
+
+		entries = append(entries, entry)
+		sources[entry.Name] = img.ref
+	}
+
+	slices.SortFunc(entries, func(a, b Image) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return entries
+}
+
+// applyImages returns the image that kustomize deploys in place of ref, given
+// the entries in the images list of a kustomization
+func applyImages(entries []Image, ref string) string {
+	imgName, tag, digest := splitImage(ref)
+
+	i := slices.IndexFunc(entries, func(e Image) bool {
+		return e.Name == imgName
+	})
+	if i == -1 {
+		return ref
+	}
+	entry := entries[i]
+
+	if entry.NewName != "" {
+		imgName = entry.NewName
+	}
+	if entry.NewTag != "" {
+		tag = entry.NewTag
+		digest = ""
+	}
+	if entry.Digest != "" {
+		tag = ""
+		digest = entry.Digest
+	}
+
+	switch {
+	case digest != "":
+		return imgName + "@" + digest
+	case tag != "":
+		return imgName + ":" + tag
+	default:
+		return imgName
+	}
+}
+
+// newImage returns an images entry that replaces the image called imgName
+// with the mapped image
+func newImage(imgName string, mapped name.Reference) Image {
+	img := Image{
+		Name:    imgName,
+		NewName: mapped.Context().Name(),
+	}
+
+	switch ref := mapped.(type) {
+	case name.Digest:
+		img.Digest = ref.DigestStr()
+	case name.Tag:
+		// Only set the tag if the result had one
+		if ref.String() != ref.Context().String() {
+			img.NewTag = ref.TagStr()
+		}
+	}
+
+	return img
+}
+
+// imageName returns the image without its tag or digest, as kustomize expects
+// in the name field of an images entry
+func imageName(image string) string {
+	imgName, _, _ := splitImage(image)
+
+	return imgName
+}
+
+// splitImage splits an image into its name, tag and digest
+func splitImage(image string) (imgName, tag, digest string) {
+	imgName, digest, _ = strings.Cut(image, "@")
+	if i := strings.LastIndex(imgName, ":"); i > strings.LastIndex(imgName, "/") {
+		imgName, tag = imgName[:i], imgName[i+1:]
+	}
+
+	return imgName, tag, digest
+}
+
+// patchKustomization adds the images to the images list in the kustomization.
+// Existing entries with the same name are updated in place, so that their
+// comments and any other fields are preserved, along with everything else in
+// the kustomization.
+func patchKustomization(input []byte, images []Image) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(input, &doc); err != nil {
+		return nil, fmt.Errorf("decoding kustomization: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+	root := doc.Content[0]
+
+	list := yamlhelpers.Lookup(root, "images")
+	if list == nil || list.Kind != yaml.SequenceNode {
+		list = &yaml.Node{Kind: yaml.SequenceNode}
+	}
+
+	for _, img := range images {
+		var node yaml.Node
+		if err := node.Encode(img); err != nil {
+			return nil, fmt.Errorf("encoding image: %w", err)
+		}
+
+		i := slices.IndexFunc(list.Content, func(n *yaml.Node) bool {
+			nameNode := yamlhelpers.Lookup(n, "name")
+			return nameNode != nil && nameNode.Value == img.Name
+		})
+		if i != -1 {
+			// The mapped image replaces the tag or digest that the
+			// existing entry set
+			existing := list.Content[i]
+			for _, key := range []string{"newTag", "digest"} {
+				if yamlhelpers.Lookup(&node, key) == nil {
+					removeKey(existing, key)
+				}
+			}
+			for j := 0; j < len(node.Content)-1; j += 2 {
+				key, value := node.Content[j], node.Content[j+1]
+
+				// Update values in place, so that their comments
+				// are kept
+				if v := yamlhelpers.Lookup(existing, key.Value); v != nil && v.Kind == yaml.ScalarNode {
+					v.Value, v.Tag, v.Style = value.Value, value.Tag, value.Style
+					continue
+				}
+				yamlhelpers.AddNode([]string{key.Value}, existing, value)
+			}
+			continue
+		}
+
+		list.Content = append(list.Content, &node)
+	}
+
+	yamlhelpers.AddNode([]string{"images"}, root, list)
+
+	return encode(&doc)
+}
+
+// removeKey removes a key, and its value, from a mapping node
+func removeKey(node *yaml.Node, key string) {
+	for i := 0; i < len(node.Content)-1; i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = slices.Delete(node.Content, i, i+2)
+			return
+		}
+	}
+}
+
+// encode encodes the node with the two space indentation that kustomizations
+// conventionally use
+func encode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, fmt.Errorf("encoding yaml: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encoding yaml: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// EncodeImages encodes the entries as an images list that can be pasted into a
+// kustomization
+func EncodeImages(images []Image) ([]byte, error) {
+	var node yaml.Node
+	if err := node.Encode(struct {
+		Images []Image `yaml:"images"`
+	}{images}); err != nil {
+		return nil, fmt.Errorf("encoding images: %w", err)
+	}
+
+	return encode(&node)
+}
@@ -0,0 +1,179 @@
+package kustomize
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockMapper struct {
+	mappings map[string][]string
+}
+
+func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
+	mapping := &mapper.Mapping{
+		Image:   img,
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
+}
+
+var m = &mockMapper{
+	mappings: map[string][]string{
+		"busybox:1.36": {
+			"cgr.dev/chainguard/busybox:1.36",
+		},
+		"busybox:1.37": {
+			"cgr.dev/chainguard/busybox:1.37",
+		},
+		"nginx:1.24": {
+			"cgr.dev/chainguard/nginx:1.24",
+		},
+		"docker.io/library/python:3.12": {
+			"cgr.dev/chainguard/python:3.12",
+		},
+	},
+}
+
+func TestFindImages(t *testing.T) {
+	got, err := FindImages("testdata/app/overlay")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []string{
+		"busybox:1.36",
+		"busybox:1.37",
+		"docker.io/library/python:3.12",
+		"nginx:1.24",
+		"unknown/image:1.0",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+}
+
+func TestFindImagesNoKustomization(t *testing.T) {
+	if _, err := FindImages(t.TempDir()); err == nil {
+		t.Error("expected error for a directory without a kustomization")
+	}
+}
+
+func TestMapImages(t *testing.T) {
+	images, err := findImages("testdata/app/overlay")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []Image{
+		{Name: "busybox", NewName: "cgr.dev/chainguard/busybox", NewTag: "1.36"},
+		{Name: "docker.io/library/python", NewName: "cgr.dev/chainguard/python", NewTag: "3.12"},
+		{Name: "nginx", NewName: "cgr.dev/chainguard/nginx", NewTag: "1.24"},
+	}
+	if diff := cmp.Diff(want, mapImages(m, images)); diff != "" {
+		t.Errorf("unexpected images (-want +got):\n%s", diff)
+	}
+}
+
+func TestPatchKustomization(t *testing.T) {
+	images, err := findImages("testdata/app/overlay")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	input, err := os.ReadFile(filepath.Join("testdata/app/overlay", "kustomization.yaml"))
+	if err != nil {
+		t.Fatalf("unexpected error reading kustomization: %s", err)
+	}
+
+	after, err := os.ReadFile("testdata/app.after.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error reading after file: %s", err)
+	}
+
+	got, err := patchKustomization(input, mapImages(m, images))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(string(after), string(got)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
+
+func TestApplyImages(t *testing.T) {
+	entries := []Image{
+		{Name: "nginx", NewTag: "1.24"},
+		{Name: "internal/tool", NewName: "registry.internal/tool"},
+		{Name: "redis", NewName: "registry.internal/redis", Digest: "sha256:abc"},
+	}
+
+	testCases := map[string]string{
+		"nginx:1.25":             "nginx:1.24",
+		"nginx@sha256:def":       "nginx:1.24",
+		"nginx":                  "nginx:1.24",
+		"internal/tool:v1":       "registry.internal/tool:v1",
+		"internal/tool":          "registry.internal/tool",
+		"redis:7":                "registry.internal/redis@sha256:abc",
+		"python:3.13":            "python:3.13",
+		"localhost:5000/nginx:1": "localhost:5000/nginx:1",
+	}
+
+	for ref, want := range testCases {
+		t.Run(ref, func(t *testing.T) {
+			if got := applyImages(entries, ref); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestImageName(t *testing.T) {
+	testCases := map[string]string{
+		"nginx":                         "nginx",
+		"nginx:1.25":                    "nginx",
+		"localhost:5000/nginx:1.25":     "localhost:5000/nginx",
+		"localhost:5000/nginx":          "localhost:5000/nginx",
+		"nginx@sha256:abc":              "nginx",
+		"ghcr.io/foo/bar:v1@sha256:abc": "ghcr.io/foo/bar",
+	}
+
+	for image, want := range testCases {
+		t.Run(image, func(t *testing.T) {
+			if got := imageName(image); got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestPatchKustomizationMergesEntries(t *testing.T) {
+	input := `images:
+  - name: nginx # The web server
+    newName: registry.internal/nginx
+    digest: sha256:abc
+`
+	want := `images:
+  - name: nginx # The web server
+    newName: cgr.dev/chainguard/nginx
+    newTag: "1.27"
+`
+
+	got, err := patchKustomization([]byte(input), []Image{
+		{Name: "nginx", NewName: "cgr.dev/chainguard/nginx", NewTag: "1.27"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected result:\n%s", diff)
+	}
+}
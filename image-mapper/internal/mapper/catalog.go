@@ -0,0 +1,347 @@
+package mapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CatalogVersion is the version of the catalog snapshot format written by
+// WriteCatalog. Snapshots with a different version are rejected by
+// ReadCatalog.
+const CatalogVersion = 1
+
+// Catalog is a point in time snapshot of the repositories in the Chainguard
+// catalog
+type Catalog struct {
+	Version      int       `json:"version"`
+	GeneratedAt  time.Time `json:"generatedAt"`
+	InactiveTags bool      `json:"inactiveTags"`
+	Repos        []Repo    `json:"repos"`
+}
+
+// ReadCatalog reads a catalog snapshot
+func ReadCatalog(r io.Reader) (*Catalog, error) {
+	var catalog Catalog
+	if err := json.NewDecoder(r).Decode(&catalog); err != nil {
+		return nil, fmt.Errorf("decoding catalog: %w", err)
+	}
+	if catalog.Version != CatalogVersion {
+		return nil, fmt.Errorf("unsupported catalog version: %d (supported: %d)", catalog.Version, CatalogVersion)
+	}
+
+	return &catalog, nil
+}
+
+// WriteCatalog writes a catalog snapshot
+func WriteCatalog(w io.Writer, catalog *Catalog) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(catalog); err != nil {
+		return fmt.Errorf("encoding catalog: %w", err)
+	}
+
+	return nil
+}
+
+// CatalogSource provides the repositories the mapper matches against
+type CatalogSource interface {
+	Load(ctx context.Context, inactiveTags bool) (*Catalog, error)
+}
+
+type liveCatalogSource struct{}
+
+// NewLiveCatalogSource returns a CatalogSource that queries the catalog
+// endpoint
+func NewLiveCatalogSource() CatalogSource {
+	return &liveCatalogSource{}
+}
+
+// Load queries the catalog endpoint for the current list of repositories
+func (s *liveCatalogSource) Load(ctx context.Context, inactiveTags bool) (*Catalog, error) {
+	repos, err := listRepos(ctx, inactiveTags)
+	if err != nil {
+		return nil, fmt.Errorf("listing repos: %w", err)
+	}
+
+	return &Catalog{
+		Version:      CatalogVersion,
+		GeneratedAt:  time.Now().UTC(),
+		InactiveTags: inactiveTags,
+		Repos:        repos,
+	}, nil
+}
+
+type fileCatalogSource struct {
+	path string
+}
+
+// NewFileCatalogSource returns a CatalogSource that reads a snapshot written
+// by WriteCatalog from disk
+func NewFileCatalogSource(path string) CatalogSource {
+	return &fileCatalogSource{
+		path: path,
+	}
+}
+
+// Load reads the snapshot from disk. Snapshots exported without inactive tags
+// can still be used when inactive tags are requested; the mapper will fall
+// back to the active tags. The inactive tags in snapshots exported with them
+// are dropped when they aren't requested, so that images are mapped the same
+// way as they are against the live catalog.
+func (s *fileCatalogSource) Load(_ context.Context, inactiveTags bool) (*Catalog, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("opening catalog: %w", err)
+	}
+	defer f.Close()
+
+	catalog, err := ReadCatalog(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading catalog: %s: %w", s.path, err)
+	}
+	if inactiveTags && !catalog.InactiveTags {
+		log.Printf("WARN: catalog %s doesn't include inactive tags, falling back to active tags", s.path)
+	}
+	if !inactiveTags && catalog.InactiveTags {
+		for i := range catalog.Repos {
+			catalog.Repos[i].Tags = nil
+		}
+		catalog.InactiveTags = false
+	}
+
+	return catalog, nil
+}
+
+type memoryCatalogSource struct {
+	src      CatalogSource
+	mu       sync.Mutex
+	catalogs map[bool]*Catalog
+}
+
+// NewMemoryCatalogSource returns a CatalogSource that loads the catalog from
+// src once and keeps it in memory, so that it can be shared by several mappers
+func NewMemoryCatalogSource(src CatalogSource) CatalogSource {
+	return &memoryCatalogSource{
+		src:      src,
+		catalogs: map[bool]*Catalog{},
+	}
+}
+
+// Load returns the catalog from memory, loading it from src the first time
+func (s *memoryCatalogSource) Load(ctx context.Context, inactiveTags bool) (*Catalog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if catalog, ok := s.catalogs[inactiveTags]; ok {
+		return catalog, nil
+	}
+
+	catalog, err := s.src.Load(ctx, inactiveTags)
+	if err != nil {
+		return nil, err
+	}
+	s.catalogs[inactiveTags] = catalog
+
+	return catalog, nil
+}
+
+type cacheCatalogSource struct {
+	dir string
+	ttl time.Duration
+	src CatalogSource
+	now func() time.Time
+}
+
+// NewCacheCatalogSource returns a CatalogSource that caches the catalog
+// returned by src in dir. The cached catalog is used until it is older than
+// the ttl.
+//
+// If the cache has expired and src can't be loaded, then the stale cache is
+// used rather than failing outright.
+func NewCacheCatalogSource(dir string, ttl time.Duration, src CatalogSource) CatalogSource {
+	return &cacheCatalogSource{
+		dir: dir,
+		ttl: ttl,
+		src: src,
+		now: time.Now,
+	}
+}
+
+// Load returns the cached catalog, refreshing it if it has expired
+func (s *cacheCatalogSource) Load(ctx context.Context, inactiveTags bool) (*Catalog, error) {
+	path := s.path(inactiveTags)
+
+	cached, err := NewFileCatalogSource(path).Load(ctx, inactiveTags)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("WARN: ignoring cached catalog: %s", err)
+	}
+	if cached != nil && s.now().Sub(cached.GeneratedAt) < s.ttl {
+		return cached, nil
+	}
+
+	catalog, err := s.src.Load(ctx, inactiveTags)
+	if err != nil {
+		if cached != nil {
+			log.Printf("WARN: using stale catalog cache from %s: %s", cached.GeneratedAt.Format(time.RFC3339), err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if err := writeCatalogFile(path, catalog); err != nil {
+		log.Printf("WARN: writing catalog cache: %s", err)
+	}
+
+	return catalog, nil
+}
+
+func (s *cacheCatalogSource) path(inactiveTags bool) string {
+	if inactiveTags {
+		return filepath.Join(s.dir, "catalog-inactive-tags.json")
+	}
+
+	return filepath.Join(s.dir, "catalog.json")
+}
+
+// writeCatalogFile writes the catalog to a temporary file and renames it into
+// place so concurrent readers never see a partially written cache
+func writeCatalogFile(path string, catalog *Catalog) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), ".catalog-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := WriteCatalog(f, catalog); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// CatalogDiff describes the differences between two catalog snapshots
+type CatalogDiff struct {
+	Added   []string   `json:"added,omitempty"`
+	Removed []string   `json:"removed,omitempty"`
+	Changed []RepoDiff `json:"changed,omitempty"`
+}
+
+// RepoDiff describes the differences in a repository between two catalog
+// snapshots
+type RepoDiff struct {
+	Name           string   `json:"name"`
+	OldCatalogTier string   `json:"oldCatalogTier,omitempty"`
+	NewCatalogTier string   `json:"newCatalogTier,omitempty"`
+	AddedAliases   []string `json:"addedAliases,omitempty"`
+	RemovedAliases []string `json:"removedAliases,omitempty"`
+	AddedTags      []string `json:"addedTags,omitempty"`
+	RemovedTags    []string `json:"removedTags,omitempty"`
+}
+
+// Empty returns true if there are no differences
+func (d *CatalogDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffCatalogs compares two catalog snapshots
+func DiffCatalogs(before, after *Catalog) *CatalogDiff {
+	oldRepos := map[string]Repo{}
+	for _, repo := range before.Repos {
+		oldRepos[repo.Name] = repo
+	}
+	newRepos := map[string]Repo{}
+	for _, repo := range after.Repos {
+		newRepos[repo.Name] = repo
+	}
+
+	diff := &CatalogDiff{}
+	for name, newRepo := range newRepos {
+		oldRepo, ok := oldRepos[name]
+		if !ok {
+			diff.Added = append(diff.Added, name)
+			continue
+		}
+
+		repoDiff := RepoDiff{Name: name}
+		if oldRepo.CatalogTier != newRepo.CatalogTier {
+			repoDiff.OldCatalogTier = oldRepo.CatalogTier
+			repoDiff.NewCatalogTier = newRepo.CatalogTier
+		}
+		repoDiff.AddedAliases, repoDiff.RemovedAliases = diffStrings(oldRepo.Aliases, newRepo.Aliases)
+		repoDiff.AddedTags, repoDiff.RemovedTags = diffStrings(allTags(oldRepo), allTags(newRepo))
+
+		if repoDiff.OldCatalogTier == "" &&
+			repoDiff.NewCatalogTier == "" &&
+			len(repoDiff.AddedAliases) == 0 &&
+			len(repoDiff.RemovedAliases) == 0 &&
+			len(repoDiff.AddedTags) == 0 &&
+			len(repoDiff.RemovedTags) == 0 {
+			continue
+		}
+		diff.Changed = append(diff.Changed, repoDiff)
+	}
+	for name := range oldRepos {
+		if _, ok := newRepos[name]; ok {
+			continue
+		}
+		diff.Removed = append(diff.Removed, name)
+	}
+
+	slices.Sort(diff.Added)
+	slices.Sort(diff.Removed)
+	slices.SortFunc(diff.Changed, func(a, b RepoDiff) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return diff
+}
+
+// allTags returns every tag known for the repo, whether active or inactive
+func allTags(repo Repo) []string {
+	tags := slices.Clone(repo.ActiveTags)
+	for _, tag := range flattenTags(repo.Tags) {
+		if slices.Contains(tags, tag) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags
+}
+
+// diffStrings returns the strings that were added to and removed from before
+func diffStrings(before, after []string) (added, removed []string) {
+	for _, s := range after {
+		if !slices.Contains(before, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range before {
+		if !slices.Contains(after, s) {
+			removed = append(removed, s)
+		}
+	}
+	slices.Sort(added)
+	slices.Sort(removed)
+
+	return added, removed
+}
@@ -0,0 +1,337 @@
+package mapper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCatalogRoundTrip(t *testing.T) {
+	catalog := &Catalog{
+		Version:      CatalogVersion,
+		GeneratedAt:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		InactiveTags: true,
+		Repos: []Repo{
+			{
+				Name:        "nginx",
+				CatalogTier: "APPLICATION",
+				Aliases:     []string{"nginx"},
+				ActiveTags:  []string{"latest", "1.27"},
+				Tags: []Tag{
+					{Name: "latest"},
+					{Name: "1.27"},
+					{Name: "1.25"},
+				},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCatalog(&buf, catalog); err != nil {
+		t.Fatalf("unexpected error writing catalog: %s", err)
+	}
+
+	got, err := ReadCatalog(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading catalog: %s", err)
+	}
+
+	if diff := cmp.Diff(catalog, got); diff != "" {
+		t.Errorf("catalog mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadCatalogUnsupportedVersion(t *testing.T) {
+	_, err := ReadCatalog(strings.NewReader(`{"version": 999, "repos": []}`))
+	if err == nil {
+		t.Fatal("expected error for unsupported version")
+	}
+}
+
+func TestFileCatalogSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	want := &Catalog{
+		Version:     CatalogVersion,
+		GeneratedAt: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Repos: []Repo{
+			{Name: "redis", CatalogTier: "APPLICATION"},
+		},
+	}
+	if err := writeCatalogFile(path, want); err != nil {
+		t.Fatalf("unexpected error writing catalog: %s", err)
+	}
+
+	got, err := NewFileCatalogSource(path).Load(t.Context(), false)
+	if err != nil {
+		t.Fatalf("unexpected error loading catalog: %s", err)
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("catalog mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// countingCatalogSource counts the number of times the catalog is loaded
+type countingCatalogSource struct {
+	catalog *Catalog
+	err     error
+	loads   int
+}
+
+func (s *countingCatalogSource) Load(_ context.Context, inactiveTags bool) (*Catalog, error) {
+	s.loads++
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return s.catalog, nil
+}
+
+func TestCacheCatalogSource(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	src := &countingCatalogSource{
+		catalog: &Catalog{
+			Version:     CatalogVersion,
+			GeneratedAt: now,
+			Repos: []Repo{
+				{Name: "nginx", CatalogTier: "APPLICATION"},
+			},
+		},
+	}
+	cache := &cacheCatalogSource{
+		dir: dir,
+		ttl: time.Hour,
+		src: src,
+		now: func() time.Time { return now },
+	}
+
+	// The first load should populate the cache
+	if _, err := cache.Load(t.Context(), false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "catalog.json")); err != nil {
+		t.Fatalf("expected cache file to be written: %s", err)
+	}
+
+	// Subsequent loads within the ttl should be served from the cache
+	now = now.Add(30 * time.Minute)
+	if _, err := cache.Load(t.Context(), false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if src.loads != 1 {
+		t.Errorf("expected 1 load from source, got %d", src.loads)
+	}
+
+	// Inactive tags are cached separately
+	if _, err := cache.Load(t.Context(), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if src.loads != 2 {
+		t.Errorf("expected 2 loads from source, got %d", src.loads)
+	}
+
+	// After the ttl has expired, the catalog should be refreshed
+	now = now.Add(time.Hour)
+	if _, err := cache.Load(t.Context(), false); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if src.loads != 3 {
+		t.Errorf("expected 3 loads from source, got %d", src.loads)
+	}
+
+	// If the source fails, the stale cache should be used
+	now = now.Add(2 * time.Hour)
+	src.err = errors.New("offline")
+	got, err := cache.Load(t.Context(), false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff(src.catalog, got); diff != "" {
+		t.Errorf("catalog mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCacheCatalogSourceError(t *testing.T) {
+	cache := NewCacheCatalogSource(t.TempDir(), time.Hour, &countingCatalogSource{
+		err: errors.New("offline"),
+	})
+
+	if _, err := cache.Load(t.Context(), false); err == nil {
+		t.Fatal("expected error with an empty cache and a failing source")
+	}
+}
+
+func TestMemoryCatalogSource(t *testing.T) {
+	src := &countingCatalogSource{
+		catalog: &Catalog{
+			Version: CatalogVersion,
+			Repos: []Repo{
+				{Name: "nginx", CatalogTier: "APPLICATION"},
+			},
+		},
+	}
+	memory := NewMemoryCatalogSource(src)
+
+	for range 3 {
+		if _, err := memory.Load(t.Context(), false); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if src.loads != 1 {
+		t.Errorf("expected 1 load from source, got %d", src.loads)
+	}
+
+	// Inactive tags are loaded separately
+	if _, err := memory.Load(t.Context(), true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if src.loads != 2 {
+		t.Errorf("expected 2 loads from source, got %d", src.loads)
+	}
+}
+
+func TestNewMapperWithCatalogSource(t *testing.T) {
+	src := &countingCatalogSource{
+		catalog: &Catalog{
+			Version: CatalogVersion,
+			Repos: []Repo{
+				{Name: "nginx", CatalogTier: "APPLICATION", ActiveTags: []string{"1.27"}},
+			},
+		},
+	}
+
+	m, err := NewMapper(t.Context(), WithCatalogSource(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := m.Map("nginx:1.27")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := &Mapping{
+		Image: "nginx:1.27",
+		Results: []Result{
+			{
+				Ref:      "cgr.dev/chainguard/nginx:1.27",
+				Repo:     "nginx",
+				Tier:     "APPLICATION",
+				MatchFn:  "matchBasename",
+				TagMatch: TagMatchExact,
+				Score:    135,
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mapping mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFileCatalogSourceInactiveTags(t *testing.T) {
+	repos := func(inactiveTags bool) []Repo {
+		repo := Repo{
+			Name:        "nginx",
+			CatalogTier: "APPLICATION",
+			ActiveTags:  []string{"1.27"},
+		}
+		if inactiveTags {
+			repo.Tags = []Tag{{Name: "1.27"}, {Name: "1.25"}}
+		}
+		return []Repo{repo}
+	}
+
+	// The live catalog only includes the inactive tags when they're
+	// requested
+	live := &countingCatalogSource{
+		catalog: &Catalog{
+			Version: CatalogVersion,
+			Repos:   repos(false),
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "catalog.json")
+	if err := writeCatalogFile(path, &Catalog{
+		Version:      CatalogVersion,
+		InactiveTags: true,
+		Repos:        repos(true),
+	}); err != nil {
+		t.Fatalf("unexpected error writing catalog: %s", err)
+	}
+
+	mapImage := func(src CatalogSource) *Mapping {
+		m, err := NewMapper(t.Context(), WithCatalogSource(src))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		mapping, err := m.Map("nginx:1.25")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return mapping
+	}
+
+	want := mapImage(live)
+	got := mapImage(NewFileCatalogSource(path))
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mapping mismatch between the live catalog and the snapshot (-want +got):\n%s", diff)
+	}
+	if slices.Contains(got.Refs(), "cgr.dev/chainguard/nginx:1.25") {
+		t.Errorf("expected the inactive tag not to be matched, got %v", got.Refs())
+	}
+}
+
+func TestDiffCatalogs(t *testing.T) {
+	before := &Catalog{
+		Repos: []Repo{
+			{Name: "nginx", CatalogTier: "APPLICATION", ActiveTags: []string{"1.25", "1.26"}},
+			{Name: "redis", CatalogTier: "APPLICATION", Aliases: []string{"redis"}},
+			{Name: "memcached", CatalogTier: "APPLICATION"},
+			{Name: "unchanged", CatalogTier: "BASE", ActiveTags: []string{"latest"}},
+		},
+	}
+	after := &Catalog{
+		Repos: []Repo{
+			{Name: "nginx", CatalogTier: "APPLICATION", ActiveTags: []string{"1.26", "1.27"}},
+			{Name: "redis", CatalogTier: "PREMIUM", Aliases: []string{"redis", "bitnami/redis"}},
+			{Name: "valkey", CatalogTier: "APPLICATION"},
+			{Name: "unchanged", CatalogTier: "BASE", ActiveTags: []string{"latest"}},
+		},
+	}
+
+	want := &CatalogDiff{
+		Added:   []string{"valkey"},
+		Removed: []string{"memcached"},
+		Changed: []RepoDiff{
+			{
+				Name:        "nginx",
+				AddedTags:   []string{"1.27"},
+				RemovedTags: []string{"1.25"},
+			},
+			{
+				Name:           "redis",
+				OldCatalogTier: "APPLICATION",
+				NewCatalogTier: "PREMIUM",
+				AddedAliases:   []string{"bitnami/redis"},
+			},
+		},
+	}
+
+	got := DiffCatalogs(before, after)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("diff mismatch (-want +got):\n%s", diff)
+	}
+
+	if DiffCatalogs(before, before).Empty() != true {
+		t.Errorf("expected no differences between identical catalogs")
+	}
+}
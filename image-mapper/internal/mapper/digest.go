@@ -0,0 +1,139 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// digestTimeout bounds how long resolving the digest of a tag can take, so
+// that an unresponsive registry doesn't hang the mapper
+const digestTimeout = 30 * time.Second
+
+// ErrResolveDigest is returned when the digest of a mapped image can't be
+// resolved from the registry
+var ErrResolveDigest = errors.New("resolving digest")
+
+// digestResolver resolves the current digest of tags from the registry.
+// Digests are cached, so each tag is only resolved once.
+type digestResolver struct {
+	keychain authn.Keychain
+
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+// newDigestResolver returns a resolver that authenticates with the keychain
+func newDigestResolver(keychain authn.Keychain) *digestResolver {
+	if keychain == nil {
+		keychain = authn.DefaultKeychain
+	}
+
+	return &digestResolver{
+		keychain: keychain,
+		digests:  map[string]string{},
+	}
+}
+
+// pinMapping pins the digest of each of the results in the mapping, i.e
+// cgr.dev/chainguard/nginx:1.27@sha256:...
+//
+// Results without a tag are pinned to the digest of latest, with a warning,
+// because that may not be the version of the image that was intended.
+func (r *digestResolver) pinMapping(ctx context.Context, mapping *Mapping) error {
+	pinned := map[string]string{}
+	for i, result := range mapping.Results {
+		// Results may already be pinned, i.e by an override
+		if strings.Contains(result.Ref, "@") {
+			continue
+		}
+
+		if !hasTag(result.Ref) {
+			log.Printf("WARN: %s doesn't have a tag, so it's pinned to the digest of latest", result.Ref)
+		}
+
+		digest, err := r.resolve(ctx, result.Ref)
+		if err != nil {
+			return err
+		}
+		p := fmt.Sprintf("%s@%s", result.Ref, digest)
+
+		mapping.Results[i].Ref = p
+		pinned[result.Ref] = p
+	}
+
+	if mapping.Explanation != nil {
+		for i, match := range mapping.Explanation.Matches {
+			if p, ok := pinned[match.Result]; ok {
+				mapping.Explanation.Matches[i].Result = p
+			}
+		}
+	}
+
+	return nil
+}
+
+// resolve returns the digest of the image's tag
+func (r *digestResolver) resolve(ctx context.Context, image string) (string, error) {
+	r.mu.Lock()
+	digest, ok := r.digests[image]
+	r.mu.Unlock()
+	if ok {
+		return digest, nil
+	}
+
+	ref, err := name.NewTag(image)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", image, err)
+	}
+
+	digest, err = r.fetchDigest(ctx, ref)
+	if err != nil {
+		return "", fmt.Errorf("%w of %s: %w", ErrResolveDigest, image, err)
+	}
+
+	r.mu.Lock()
+	r.digests[image] = digest
+	r.mu.Unlock()
+
+	return digest, nil
+}
+
+// fetchDigest returns the digest of the manifest of the tag. Indexes are
+// preferred, so that the digest is the same on every platform.
+func (r *digestResolver) fetchDigest(ctx context.Context, ref name.Tag) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, digestTimeout)
+	defer cancel()
+
+	opts := []remote.Option{
+		remote.WithContext(ctx),
+		remote.WithAuthFromKeychain(r.keychain),
+	}
+
+	desc, err := remote.Head(ref, opts...)
+	if err == nil {
+		return desc.Digest.String(), nil
+	}
+
+	// Not every registry returns the digest of the manifest in response to
+	// a HEAD request, so fall back to fetching the manifest
+	full, err := remote.Get(ref, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	return full.Digest.String(), nil
+}
+
+// hasTag returns true if the image reference has an explicit tag
+func hasTag(image string) bool {
+	return strings.Contains(image[strings.LastIndex(image, "/")+1:], ":")
+}
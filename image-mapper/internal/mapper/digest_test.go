@@ -0,0 +1,236 @@
+package mapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// staticKeychain returns the same credentials for every registry
+type staticKeychain authn.Basic
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	if k.Username == "" && k.Password == "" {
+		return authn.Anonymous, nil
+	}
+
+	return &authn.Basic{Username: k.Username, Password: k.Password}, nil
+}
+
+// pushImage pushes an image to the registry and returns its digest
+func pushImage(t *testing.T, image string, opts ...remote.Option) string {
+	t.Helper()
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatalf("unexpected error parsing reference: %s", err)
+	}
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatalf("unexpected error creating image: %s", err)
+	}
+	if err := remote.Write(ref, img, opts...); err != nil {
+		t.Fatalf("unexpected error pushing image: %s", err)
+	}
+
+	digest, err := img.Digest()
+	if err != nil {
+		t.Fatalf("unexpected error computing digest: %s", err)
+	}
+
+	return digest.String()
+}
+
+func TestMapPinDigests(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	nginxDigest := pushImage(t, host+"/chainguard/nginx:1.27")
+	pythonDigest := pushImage(t, host+"/chainguard/python:latest")
+
+	m := &mapper{
+		repos: []Repo{
+			{Name: "nginx", CatalogTier: "APPLICATION", ActiveTags: []string{"1.27"}},
+			{Name: "python", CatalogTier: "BASE"},
+			{Name: "redis", CatalogTier: "APPLICATION", ActiveTags: []string{"7"}},
+		},
+		repoName: fmt.Sprintf("%s/chainguard", host),
+		digests:  newDigestResolver(staticKeychain{}),
+	}
+
+	testCases := []struct {
+		image   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			image: "nginx:1.27",
+			want:  []string{fmt.Sprintf("%s/chainguard/nginx:1.27@%s", host, nginxDigest)},
+		},
+		{
+			image: "python",
+			want:  []string{fmt.Sprintf("%s/chainguard/python@%s", host, pythonDigest)},
+		},
+		{
+			image: "unknown",
+			want:  []string{},
+		},
+		{
+			// The tag doesn't exist in the registry
+			image:   "redis:7",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.image, func(t *testing.T) {
+			mapping, err := m.Map(tc.image)
+			if tc.wantErr {
+				if !errors.Is(err, ErrResolveDigest) {
+					t.Fatalf("expected %q error, got %v", ErrResolveDigest, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.want, mapping.Refs()); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	// The mapped image should parse as a reference to the digest
+	mapped, err := MapImage(m, "nginx:1.27")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got := mapped.Identifier(); got != nginxDigest {
+		t.Errorf("expected identifier %s, got %s", nginxDigest, got)
+	}
+}
+
+func TestDigestResolverAuth(t *testing.T) {
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+	creds := authn.Basic{Username: "user", Password: "secret"}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			username, password, ok := r.BasicAuth()
+			if !ok || username != creds.Username || password != creds.Password {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"token":"abc"}`)
+		case r.Header.Get("Authorization") != "Bearer abc":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			reg.ServeHTTP(w, r)
+		}
+	}))
+	defer srv.Close()
+	image := strings.TrimPrefix(srv.URL, "http://") + "/chainguard/nginx:1.27"
+
+	digest := pushImage(t, image, remote.WithAuth(&creds))
+
+	t.Run("authenticated", func(t *testing.T) {
+		r := newDigestResolver(staticKeychain(creds))
+		got, err := r.resolve(t.Context(), image)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got != digest {
+			t.Errorf("expected %s, got %s", digest, got)
+		}
+	})
+
+	t.Run("anonymous", func(t *testing.T) {
+		r := newDigestResolver(staticKeychain{})
+		if _, err := r.resolve(t.Context(), image); err == nil {
+			t.Error("expected error but got none")
+		}
+	})
+}
+
+// noDigestWriter removes the digest from the headers of a response
+type noDigestWriter struct {
+	http.ResponseWriter
+}
+
+func (w noDigestWriter) WriteHeader(code int) {
+	w.Header().Del("Docker-Content-Digest")
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestDigestResolverNoDigestHeader(t *testing.T) {
+	reg := registry.New(registry.Logger(log.New(io.Discard, "", 0)))
+
+	// Some registries don't return the digest in response to HEAD requests
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w = noDigestWriter{w}
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	image := strings.TrimPrefix(srv.URL, "http://") + "/chainguard/nginx:1.27"
+
+	digest := pushImage(t, image)
+
+	got, err := newDigestResolver(staticKeychain{}).resolve(t.Context(), image)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if got != digest {
+		t.Errorf("expected %s, got %s", digest, got)
+	}
+}
+
+func TestDigestResolverContext(t *testing.T) {
+	srv := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+	image := strings.TrimPrefix(srv.URL, "http://") + "/chainguard/nginx:1.27"
+
+	pushImage(t, image)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := newDigestResolver(staticKeychain{}).resolve(ctx, image)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %q error, got %v", context.Canceled, err)
+	}
+}
+
+func TestHasTag(t *testing.T) {
+	testCases := map[string]bool{
+		"cgr.dev/chainguard/nginx:1.27":     true,
+		"cgr.dev/chainguard/nginx":          false,
+		"localhost:5000/chainguard/nginx":   false,
+		"localhost:5000/chainguard/nginx:1": true,
+	}
+
+	for image, want := range testCases {
+		if got := hasTag(image); got != want {
+			t.Errorf("%s: expected %t, got %t", image, want, got)
+		}
+	}
+}
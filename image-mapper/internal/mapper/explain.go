@@ -0,0 +1,75 @@
+package mapper
+
+import (
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// Explanation describes how the mapper arrived at the results in a Mapping
+type Explanation struct {
+	Override string             `json:"override,omitempty"`
+	Matches  []MatchExplanation `json:"matches,omitempty"`
+	Dropped  []DropExplanation  `json:"dropped,omitempty"`
+}
+
+// MatchExplanation describes why a result was included in a Mapping
+type MatchExplanation struct {
+	Result     string `json:"result"`
+	Repo       string `json:"repo"`
+	MatchFn    string `json:"matchFn"`
+	MatchTagFn string `json:"matchTagFn,omitempty"`
+	Score      int    `json:"score"`
+}
+
+// DropExplanation describes a candidate that matched the image but was
+// dropped from the results. If Tag is set, then a TagFilter dropped the tag
+// that would otherwise have been chosen. Otherwise, an IgnoreFn dropped the
+// repo entirely.
+type DropExplanation struct {
+	Repo string `json:"repo"`
+	Tag  string `json:"tag,omitempty"`
+	By   string `json:"by"`
+}
+
+// sort orders the explanation so it's stable between runs
+func (e *Explanation) sort() {
+	slices.SortFunc(e.Matches, func(a, b MatchExplanation) int {
+		return strings.Compare(a.Result, b.Result)
+	})
+	slices.SortFunc(e.Dropped, func(a, b DropExplanation) int {
+		if c := strings.Compare(a.Repo, b.Repo); c != 0 {
+			return c
+		}
+		return strings.Compare(a.By, b.By)
+	})
+}
+
+// funcSuffix matches the suffix the runtime appends to the names of
+// closures and anonymous functions
+var funcSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// funcName returns a short, human readable name for a function. Closures are
+// named after the function that returns them. For instance, the IgnoreFn
+// returned by IgnoreTiers is named "IgnoreTiers".
+func funcName(fn any) string {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return ""
+	}
+
+	name := f.Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = funcSuffix.ReplaceAllString(name, "")
+	if i := strings.Index(name, "."); i != -1 {
+		name = name[i+1:]
+	}
+
+	return name
+}
@@ -0,0 +1,179 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMapperMapExplain(t *testing.T) {
+	m := &mapper{
+		repos: []Repo{
+			{
+				Name:        "nginx",
+				CatalogTier: "APPLICATION",
+				ActiveTags:  []string{"1.25", "1.25-dev", "1.27"},
+			},
+			{
+				Name:        "nginx-fips",
+				CatalogTier: "FIPS",
+				ActiveTags:  []string{"1.25"},
+			},
+			{
+				Name:        "nginx-iamguarded",
+				CatalogTier: "APPLICATION",
+				ActiveTags:  []string{"1.25"},
+			},
+			{
+				Name:        "nginx-custom",
+				CatalogTier: "APPLICATION",
+				Aliases:     []string{"nginx"},
+			},
+			{
+				Name:        "redis",
+				CatalogTier: "APPLICATION",
+			},
+		},
+		repoName:   "cgr.dev/chainguard",
+		ignoreFns:  []IgnoreFn{IgnoreTiers([]string{"FIPS"})},
+		tagFilters: []TagFilter{TagFilterPreferDev},
+		explain:    true,
+	}
+
+	got, err := m.Map("nginx:1.25")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := &Mapping{
+		Image: "nginx:1.25",
+		Results: []Result{
+			{
+				Ref:      "cgr.dev/chainguard/nginx:1.25-dev",
+				Repo:     "nginx",
+				Tier:     "APPLICATION",
+				MatchFn:  "matchBasename",
+				TagMatch: TagMatchApproximate,
+				Score:    125,
+			},
+			{
+				Ref:     "cgr.dev/chainguard/nginx-custom",
+				Repo:    "nginx-custom",
+				Tier:    "APPLICATION",
+				Aliases: []string{"nginx"},
+				MatchFn: "matchAliases",
+				Score:   95,
+			},
+			{
+				Ref:      "cgr.dev/chainguard/nginx-iamguarded:1.25",
+				Repo:     "nginx-iamguarded",
+				Tier:     "APPLICATION",
+				MatchFn:  "matchIamguarded",
+				TagMatch: TagMatchExact,
+				Score:    75,
+			},
+		},
+		Explanation: &Explanation{
+			Matches: []MatchExplanation{
+				{
+					Result:  "cgr.dev/chainguard/nginx-custom",
+					Repo:    "nginx-custom",
+					MatchFn: "matchAliases",
+					Score:   95,
+				},
+				{
+					Result:     "cgr.dev/chainguard/nginx-iamguarded:1.25",
+					Repo:       "nginx-iamguarded",
+					MatchFn:    "matchIamguarded",
+					MatchTagFn: "matchEqualTag",
+					Score:      75,
+				},
+				{
+					Result:     "cgr.dev/chainguard/nginx:1.25-dev",
+					Repo:       "nginx",
+					MatchFn:    "matchBasename",
+					MatchTagFn: "matchClosestSemanticVersionTag",
+					Score:      125,
+				},
+			},
+			Dropped: []DropExplanation{
+				{
+					Repo: "nginx",
+					Tag:  "1.25",
+					By:   "TagFilterPreferDev",
+				},
+				{
+					Repo: "nginx-fips",
+					By:   "IgnoreTiers",
+				},
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mapping mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMapperMapWithoutExplain(t *testing.T) {
+	m := &mapper{
+		repos: []Repo{
+			{
+				Name:        "nginx",
+				CatalogTier: "APPLICATION",
+			},
+		},
+		repoName: "cgr.dev/chainguard",
+	}
+
+	got, err := m.Map("nginx")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.Explanation != nil {
+		t.Errorf("expected no explanation, got: %+v", got.Explanation)
+	}
+}
+
+func TestFuncName(t *testing.T) {
+	testCases := []struct {
+		name string
+		fn   any
+		want string
+	}{
+		{
+			name: "match fn",
+			fn:   MatchFn(matchBasename),
+			want: "matchBasename",
+		},
+		{
+			name: "match tag fn",
+			fn:   MatchTagFn(matchEqualTag),
+			want: "matchEqualTag",
+		},
+		{
+			name: "tag filter",
+			fn:   TagFilter(TagFilterExcludeDev),
+			want: "TagFilterExcludeDev",
+		},
+		{
+			name: "closure",
+			fn:   IgnoreTiers([]string{"FIPS"}),
+			want: "IgnoreTiers",
+		},
+		{
+			name: "nil",
+			fn:   MatchTagFn(nil),
+			want: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := funcName(tc.fn); got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
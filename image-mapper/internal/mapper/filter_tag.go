@@ -1,6 +1,9 @@
 package mapper
 
-import "strings"
+import (
+	"slices"
+	"strings"
+)
 
 // TagFilter is a function that filters tags
 type TagFilter func(tags []string) []string
@@ -50,10 +53,7 @@ func TagFilterPreferDev(tags []string) []string {
 }
 
 func filterTags(repo Repo, filters ...TagFilter) []string {
-	tags := repo.ActiveTags
-	if len(repo.Tags) > 0 {
-		tags = flattenTags(repo.Tags)
-	}
+	tags := repoTags(repo)
 	if len(filters) == 0 {
 		return tags
 	}
@@ -64,3 +64,36 @@ func filterTags(repo Repo, filters ...TagFilter) []string {
 
 	return tags
 }
+
+// repoTags returns the tags to match against in the repository. This will be
+// the active tags, unless the repo was loaded with inactive tags.
+func repoTags(repo Repo) []string {
+	if len(repo.Tags) > 0 {
+		return flattenTags(repo.Tags)
+	}
+
+	return repo.ActiveTags
+}
+
+// explainTagFilters returns the filters that dropped the tag that would
+// otherwise have been matched to the input tag
+func explainTagFilters(repo Repo, tag string, variants TagVariants, filters ...TagFilter) []DropExplanation {
+	var dropped []DropExplanation
+
+	tags := repoTags(repo)
+	for _, filter := range filters {
+		candidate, _ := findMatchTag(tags, tag, variants)
+		tags = filter(tags)
+		if candidate == "" || slices.Contains(tags, candidate) {
+			continue
+		}
+
+		dropped = append(dropped, DropExplanation{
+			Repo: repo.Name,
+			Tag:  candidate,
+			By:   funcName(filter),
+		})
+	}
+
+	return dropped
+}
@@ -25,3 +25,9 @@ func IgnoreIamguarded() IgnoreFn {
 		return strings.HasSuffix(repo.Name, "iamguarded") || strings.HasSuffix(repo.Name, "iamguarded-fips")
 	}
 }
+
+// ignoreNonFIPS ignores repos that aren't FIPS. It's applied to FIPS variants
+// of upstream images, so that they aren't mapped to images without FIPS.
+func ignoreNonFIPS(repo Repo) bool {
+	return !strings.HasSuffix(repo.Name, "-fips")
+}
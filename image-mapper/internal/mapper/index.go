@@ -0,0 +1,98 @@
+package mapper
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// repoIndex finds the repos that might match a reference without checking
+// every repo in the catalog. It mirrors the MatchFns: each lookup table
+// contains the keys that one or more of them compare against.
+//
+// The index only narrows down the candidates. The MatchFns still decide
+// whether a candidate matches, so a MatchFn that compares against something
+// new must be accompanied by a lookup table here.
+type repoIndex struct {
+	// byName indexes repos by their name, for matchBasename,
+	// matchDashname and matchIamguarded
+	byName map[string][]int
+
+	// byAlias indexes repos by the full repository of their aliases,
+	// i.e ghcr.io/foo/bar, for matchAliases
+	byAlias map[string][]int
+
+	// byAliasRepo indexes repos by the repository name of their aliases,
+	// i.e foo/bar, and the same name joined by dashes, i.e foo-bar, for
+	// matchAliases
+	byAliasRepo map[string][]int
+}
+
+// newRepoIndex builds an index of the repos
+func newRepoIndex(repos []Repo) *repoIndex {
+	idx := &repoIndex{
+		byName:      map[string][]int{},
+		byAlias:     map[string][]int{},
+		byAliasRepo: map[string][]int{},
+	}
+	for i, repo := range repos {
+		idx.byName[repo.Name] = append(idx.byName[repo.Name], i)
+
+		for _, alias := range repo.Aliases {
+			aref, err := name.ParseReference(alias)
+			if err != nil {
+				continue
+			}
+			arepoStr := aref.Context().RepositoryStr()
+
+			idx.byAlias[aref.Context().String()] = append(idx.byAlias[aref.Context().String()], i)
+			idx.byAliasRepo[arepoStr] = append(idx.byAliasRepo[arepoStr], i)
+			if dashed := strings.ReplaceAll(arepoStr, "/", "-"); dashed != arepoStr {
+				idx.byAliasRepo[dashed] = append(idx.byAliasRepo[dashed], i)
+			}
+		}
+	}
+
+	return idx
+}
+
+// candidates returns the indices of the repos that might match the reference,
+// in the order they appear in the catalog
+func (idx *repoIndex) candidates(ref name.Reference) []int {
+	basename := path.Base(ref.Context().String())
+	dashname := strings.ReplaceAll(ref.Context().RepositoryStr(), "/", "-")
+
+	var names []string
+	for _, n := range []string{basename, dashname} {
+		names = append(names,
+			n,
+			fmt.Sprintf("%s-fips", n),
+			fmt.Sprintf("%s-iamguarded", n),
+			fmt.Sprintf("%s-iamguarded-fips", n),
+		)
+	}
+
+	var candidates []int
+	for _, n := range names {
+		candidates = append(candidates, idx.byName[n]...)
+	}
+	candidates = append(candidates, idx.byAlias[ref.Context().String()]...)
+	candidates = append(candidates, idx.byAliasRepo[ref.Context().RepositoryStr()]...)
+
+	slices.Sort(candidates)
+
+	return slices.Compact(candidates)
+}
+
+// repo returns the index of the repo with the given name, or -1 if there isn't
+// one
+func (idx *repoIndex) repo(repoName string) int {
+	if i := idx.byName[repoName]; len(i) > 0 {
+		return i[0]
+	}
+
+	return -1
+}
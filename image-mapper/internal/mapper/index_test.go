@@ -0,0 +1,74 @@
+package mapper
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+func TestRepoIndexCandidates(t *testing.T) {
+	repos := []Repo{
+		{Name: "nginx"},
+		{Name: "nginx-fips"},
+		{Name: "redis-iamguarded"},
+		{Name: "redis-iamguarded-fips"},
+		{Name: "stakater-reloader"},
+		{Name: "kube-state-metrics", Aliases: []string{"registry.k8s.io/kube-state-metrics/kube-state-metrics"}},
+		{Name: "prometheus", Aliases: []string{"quay.io/prometheus/prometheus:latest"}},
+		{Name: "argocd", Aliases: []string{"quay.io/argoproj/argocd"}},
+		{Name: "python"},
+		{Name: "bad-alias", Aliases: []string{"::invalid"}},
+	}
+	idx := newRepoIndex(repos)
+
+	images := []string{
+		"nginx",
+		"docker.io/library/nginx:1.25",
+		"ghcr.io/foo/bar/nginx",
+		"bitnami/redis",
+		"ghcr.io/stakater/reloader:v1.4.1",
+		"registry.k8s.io/kube-state-metrics/kube-state-metrics:v2.10.0",
+		"mirror.internal/kube-state-metrics/kube-state-metrics",
+		"mirror.internal/kube-state-metrics-kube-state-metrics",
+		"prom/prometheus",
+		"quay.io/prometheus/prometheus",
+		"mirror.internal/argoproj-argocd",
+		"unknown/image",
+	}
+
+	for _, img := range images {
+		t.Run(img, func(t *testing.T) {
+			ref, err := name.NewTag(img)
+			if err != nil {
+				t.Fatalf("unexpected error parsing image: %s", err)
+			}
+
+			// Every repo that a MatchFn matches must be a candidate
+			var want []int
+			for i, repo := range repos {
+				if findMatchFn(ref, repo) != nil {
+					want = append(want, i)
+				}
+			}
+
+			got := idx.candidates(ref)
+			for _, i := range want {
+				if !slices.Contains(got, i) {
+					t.Errorf("expected %s to be a candidate, got %v", repos[i].Name, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRepoIndexRepo(t *testing.T) {
+	idx := newRepoIndex([]Repo{{Name: "nginx"}, {Name: "python"}})
+
+	if got := idx.repo("python"); got != 1 {
+		t.Errorf("expected 1, got %d", got)
+	}
+	if got := idx.repo("redis"); got != -1 {
+		t.Errorf("expected -1, got %d", got)
+	}
+}
@@ -3,6 +3,7 @@ package mapper
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 )
 
@@ -14,6 +15,30 @@ type Iterator interface {
 	Next() (string, error)
 }
 
+// Owner is a workload that runs an image
+type Owner struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// String returns the owner as <kind>/<namespace>/<name>, i.e
+// Deployment/default/web, or <kind>/<name> for owners that aren't namespaced
+func (o Owner) String() string {
+	if o.Namespace == "" {
+		return fmt.Sprintf("%s/%s", o.Kind, o.Name)
+	}
+
+	return fmt.Sprintf("%s/%s/%s", o.Kind, o.Namespace, o.Name)
+}
+
+// OwnerIterator is an iterator that also knows which workloads run each image.
+// MapAll attaches the owners to the mappings.
+type OwnerIterator interface {
+	Iterator
+	Owners(image string) []Owner
+}
+
 type readerIterator struct {
 	scanner *bufio.Scanner
 }
@@ -3,16 +3,28 @@ package mapper
 import (
 	"context"
 	"fmt"
+	"maps"
+	"runtime"
 	"slices"
 	"strings"
+	"sync"
 
 	"github.com/google/go-containerregistry/pkg/name"
 )
 
 // Mapping describes an image and the Chainguard images it maps to
 type Mapping struct {
-	Image   string   `json:"image"`
-	Results []string `json:"results,omitempty"`
+	Image string `json:"image"`
+
+	// Results are the Chainguard images that the image maps to, with the
+	// best match first
+	Results []Result `json:"results,omitempty"`
+
+	Explanation *Explanation `json:"explanation,omitempty"`
+
+	// Owners are the workloads that run the image, when the images come
+	// from an iterator that knows about them, like a cluster
+	Owners []Owner `json:"owners,omitempty"`
 }
 
 // Mapper maps image references to images in our catalog
@@ -22,9 +34,21 @@ type Mapper interface {
 
 type mapper struct {
 	repos      []Repo
+	index      *repoIndex
+	indexOnce  sync.Once
 	ignoreFns  []IgnoreFn
 	tagFilters []TagFilter
+	variants   TagVariants
 	repoName   string
+	explain    bool
+	policy     ScorePolicy
+	overrides  *Overrides
+	digests    *digestResolver
+
+	// ctx is the context the mapper was constructed with. The Mapper
+	// interface doesn't take a context, so this is used for requests to
+	// the registry, like resolving digests.
+	ctx context.Context
 }
 
 // NewMapper creates a new mapper
@@ -41,16 +65,51 @@ func NewMapper(ctx context.Context, opts ...Option) (*mapper, error) {
 		return nil, fmt.Errorf("parsing repository: %w", err)
 	}
 
-	repos, err := listRepos(ctx, o.inactiveTags)
+	overrides := o.overrides
+	if o.overridesFile != "" {
+		overrides, err = ReadOverridesFile(o.overridesFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading overrides: %w", err)
+		}
+	}
+
+	src := o.catalogSource
+	if src == nil {
+		src = NewLiveCatalogSource()
+	}
+	catalog, err := src.Load(ctx, o.inactiveTags)
 	if err != nil {
-		return nil, fmt.Errorf("listing repos: %w", err)
+		return nil, fmt.Errorf("loading catalog: %w", err)
+	}
+
+	// The catalog may be shared with other mappers, so modify a copy
+	repos := fixAliases(slices.Clone(catalog.Repos))
+	if overrides != nil {
+		repos = overrides.addAliases(repos)
+	}
+
+	// Variants in the overrides take precedence over those configured
+	// with an option, which take precedence over the defaults
+	variants := maps.Clone(DefaultTagVariants)
+	maps.Copy(variants, o.variants)
+	if overrides != nil {
+		maps.Copy(variants, overrides.Variants)
 	}
 
 	m := &mapper{
 		repos:      repos,
+		index:      newRepoIndex(repos),
 		ignoreFns:  o.ignoreFns,
 		tagFilters: o.tagFilters,
+		variants:   variants,
 		repoName:   repoName,
+		explain:    o.explain,
+		policy:     o.scorePolicy,
+		overrides:  overrides,
+		ctx:        ctx,
+	}
+	if o.pinDigests {
+		m.digests = newDigestResolver(o.keychain)
 	}
 
 	return m, nil
@@ -58,8 +117,24 @@ func NewMapper(ctx context.Context, opts ...Option) (*mapper, error) {
 
 // MapAll returns mappings for all the images returned by the iterator
 func (m *mapper) MapAll(it Iterator) ([]*Mapping, error) {
-	mapped := make(map[string]struct{})
-	mappings := []*Mapping{}
+	return MapAll(m, it, 0)
+}
+
+// MapAll returns mappings for all the images returned by the iterator, using
+// the provided mapper. Each image is only mapped once.
+//
+// The images are mapped concurrently by the given number of workers, or one
+// per CPU if it's less than one. The mappings are returned in the same order
+// as the images.
+func MapAll(m Mapper, it Iterator, workers int) ([]*Mapping, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	// Collect the images up front, so we know the order to return the
+	// mappings in
+	var images []string
+	seen := map[string]struct{}{}
 	for {
 		image, err := it.Next()
 		if err == ErrIteratorDone {
@@ -69,17 +144,43 @@ func (m *mapper) MapAll(it Iterator) ([]*Mapping, error) {
 			return nil, fmt.Errorf("iterating over images: %w", err)
 		}
 
-		if _, ok := mapped[image]; ok {
+		if _, ok := seen[image]; ok {
 			continue
 		}
+		seen[image] = struct{}{}
+		images = append(images, image)
+	}
+
+	mappings := make([]*Mapping, len(images))
+	errs := make([]error, len(images))
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(workers, len(images)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				mappings[i], errs[i] = m.Map(images[i])
+			}
+		}()
+	}
+	for i := range images {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
 
-		mapping, err := m.Map(image)
+	for i, err := range errs {
 		if err != nil {
-			return nil, fmt.Errorf("mapping image %s: %w", image, err)
+			return nil, fmt.Errorf("mapping image %s: %w", images[i], err)
 		}
+	}
 
-		mappings = append(mappings, mapping)
-		mapped[image] = struct{}{}
+	if oit, ok := it.(OwnerIterator); ok {
+		for _, mapping := range mappings {
+			mapping.Owners = oit.Owners(mapping.Image)
+		}
 	}
 
 	return mappings, nil
@@ -87,15 +188,58 @@ func (m *mapper) MapAll(it Iterator) ([]*Mapping, error) {
 
 // Map an upstream image to the corresponding images in chainguard-private
 func (m *mapper) Map(image string) (*Mapping, error) {
+	mapping, err := m.match(image)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.digests != nil {
+		if err := m.digests.pinMapping(m.context(), mapping); err != nil {
+			return nil, fmt.Errorf("pinning digests: %w", err)
+		}
+	}
+
+	return mapping, nil
+}
+
+// context returns the context the mapper was constructed with, or the
+// background context for mappers that weren't constructed with NewMapper
+func (m *mapper) context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
+	}
+
+	return m.ctx
+}
+
+// match returns the repos in the catalog that match the image, ranked with the
+// best match first
+func (m *mapper) match(image string) (*Mapping, error) {
 	ref, err := name.NewTag(strings.Split(image, "@")[0])
 	if err != nil {
 		return nil, fmt.Errorf("parsing %s: %w", image, err)
 	}
 
+	// User supplied overrides take precedence over everything else
+	if m.overrides != nil {
+		if mapping := m.mapOverride(image, ref); mapping != nil {
+			return mapping, nil
+		}
+	}
+
+	// Record how we arrived at the results, if we've been asked to
+	var explanation *Explanation
+	if m.explain {
+		explanation = &Explanation{}
+	}
+
 	// Identify repositories in the Chainguard catalog that match the
 	// provided image
 	matches := map[string]Repo{}
-	for _, cgrrepo := range m.repos {
+	matchedBy := map[string]MatchFn{}
+	fips := isFIPSVariant(ref.TagStr())
+	for _, i := range m.repoIndex().candidates(ref) {
+		cgrrepo := m.repos[i]
 		// There are some images that may appear in the results but are
 		// not accessible in the catalog. We can exclude them by
 		// ignoring repos without a catalog tier.
@@ -103,18 +247,35 @@ func (m *mapper) Map(image string) (*Mapping, error) {
 			continue
 		}
 
-		if m.ignoreRepo(cgrrepo) {
+		ignoreFn := m.ignoreRepo(cgrrepo)
+		if ignoreFn == nil && fips && ignoreNonFIPS(cgrrepo) {
+			ignoreFn = ignoreNonFIPS
+		}
+		if ignoreFn != nil && explanation == nil {
 			continue
 		}
 
-		if !Match(ref, cgrrepo) {
+		matchFn := findMatchFn(ref, cgrrepo)
+		if matchFn == nil {
 			continue
 		}
+
+		// When we're explaining the results, we want to know which
+		// matching repos were dropped by an IgnoreFn
+		if ignoreFn != nil {
+			explanation.Dropped = append(explanation.Dropped, DropExplanation{
+				Repo: cgrrepo.Name,
+				By:   funcName(ignoreFn),
+			})
+			continue
+		}
+
 		matches[cgrrepo.Name] = cgrrepo
+		matchedBy[cgrrepo.Name] = matchFn
 	}
 
 	// Format the matches into the results we'll include in the mappings
-	results := []string{}
+	results := []Result{}
 	for _, cgrrepo := range matches {
 		// Append the repository name to the rest of the reference
 		result := fmt.Sprintf("%s/%s", m.repoName, cgrrepo.Name)
@@ -123,33 +284,76 @@ func (m *mapper) Map(image string) (*Mapping, error) {
 		tags := filterTags(cgrrepo, m.tagFilters...)
 
 		// Try and match the provided tag to one of the tags
-		tag := MatchTag(tags, ref.TagStr())
+		tag, matchTagFn := findMatchTag(tags, ref.TagStr(), m.variants)
 		if tag != "" {
 			result = fmt.Sprintf("%s:%s", result, tag)
 		}
-		results = append(results, result)
+
+		// Score the result so we can rank it against the others
+		score := m.policy.score(cgrrepo, matchedBy[cgrrepo.Name], matchTagFn)
+		results = append(results, Result{
+			Ref:      result,
+			Repo:     cgrrepo.Name,
+			Tier:     cgrrepo.CatalogTier,
+			Aliases:  cgrrepo.Aliases,
+			MatchFn:  funcName(matchedBy[cgrrepo.Name]),
+			TagMatch: tagMatch(matchTagFn),
+			Score:    score,
+		})
+
+		if explanation != nil {
+			explanation.Matches = append(explanation.Matches, MatchExplanation{
+				Result:     result,
+				Repo:       cgrrepo.Name,
+				MatchFn:    funcName(matchedBy[cgrrepo.Name]),
+				MatchTagFn: funcName(matchTagFn),
+				Score:      score,
+			})
+			explanation.Dropped = append(explanation.Dropped, explainTagFilters(cgrrepo, ref.TagStr(), m.variants, m.tagFilters...)...)
+		}
+	}
+
+	// Rank the results so the best match comes first
+	rankResults(results)
+
+	if explanation != nil {
+		explanation.sort()
 	}
-	slices.Sort(results)
 
 	return &Mapping{
-		Image:   image,
-		Results: results,
+		Image:       image,
+		Results:     results,
+		Explanation: explanation,
 	}, nil
 }
 
-func (m *mapper) ignoreRepo(repo Repo) bool {
+// repoIndex returns the index of the repos. It's built by NewMapper, but
+// mappers that are constructed directly build it the first time it's needed.
+func (m *mapper) repoIndex() *repoIndex {
+	m.indexOnce.Do(func() {
+		if m.index == nil {
+			m.index = newRepoIndex(m.repos)
+		}
+	})
+
+	return m.index
+}
+
+// ignoreRepo returns the IgnoreFn that ignores the repo, or nil if the repo
+// isn't ignored
+func (m *mapper) ignoreRepo(repo Repo) IgnoreFn {
 	for _, ignore := range m.ignoreFns {
 		if !ignore(repo) {
 			continue
 		}
-		return true
+		return ignore
 	}
 
-	return false
+	return nil
 }
 
 // MapImage maps the provided image to its Chainguard equivalent. It returns the
-// first result it finds.
+// first result, which is the highest ranked.
 func MapImage(m Mapper, img string) (name.Reference, error) {
 	mapping, err := m.Map(img)
 	if err != nil {
@@ -158,9 +362,8 @@ func MapImage(m Mapper, img string) (name.Reference, error) {
 	if len(mapping.Results) == 0 {
 		return nil, fmt.Errorf("no results found")
 	}
-	result := mapping.Results[0]
-
-	mapped, err := name.NewTag(result)
+	// Results that are pinned to a digest are parsed as a name.Digest
+	mapped, err := name.ParseReference(mapping.Results[0].Ref)
 	if err != nil {
 		return nil, fmt.Errorf("parsing mapped image: %w", err)
 	}
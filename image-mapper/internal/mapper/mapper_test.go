@@ -2,7 +2,9 @@ package mapper
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
@@ -28,8 +30,17 @@ func TestMapperMap(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "nginx",
-				Results: []string{"cgr.dev/chainguard/nginx"},
+				Image: "nginx",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/nginx",
+						Repo:    "nginx",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+				},
 			},
 		},
 		{
@@ -44,7 +55,7 @@ func TestMapperMap(t *testing.T) {
 			},
 			expected: &Mapping{
 				Image:   "nonexistent",
-				Results: []string{},
+				Results: []Result{},
 			},
 		},
 		{
@@ -63,8 +74,25 @@ func TestMapperMap(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "nginx",
-				Results: []string{"cgr.dev/chainguard/nginx", "cgr.dev/chainguard/nginx-custom"},
+				Image: "nginx",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/nginx",
+						Repo:    "nginx",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/nginx-custom",
+						Repo:    "nginx-custom",
+						Tier:    "APPLICATION",
+						Aliases: []string{"nginx"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 		{
@@ -83,8 +111,17 @@ func TestMapperMap(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "nginx",
-				Results: []string{"cgr.dev/chainguard/nginx"},
+				Image: "nginx",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/nginx",
+						Repo:    "nginx",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+				},
 			},
 		},
 	}
@@ -102,12 +139,7 @@ func TestMapperMap(t *testing.T) {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
-			// Sort results for consistent comparison
-			opts := cmpopts.SortSlices(func(a, b string) bool {
-				return strings.Compare(a, b) < 0
-			})
-
-			if diff := cmp.Diff(tc.expected, result, opts); diff != "" {
+			if diff := cmp.Diff(tc.expected, result); diff != "" {
 				t.Errorf("mapping mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -154,25 +186,38 @@ func TestMapperMapAll(t *testing.T) {
 
 	expected := []*Mapping{
 		{
-			Image:   "nginx",
-			Results: []string{"cgr.dev/chainguard/nginx"},
+			Image: "nginx",
+			Results: []Result{
+				{
+					Ref:     "cgr.dev/chainguard/nginx",
+					Repo:    "nginx",
+					Tier:    "APPLICATION",
+					Aliases: []string{},
+					MatchFn: "matchBasename",
+					Score:   115,
+				},
+			},
 		},
 		{
-			Image:   "redis",
-			Results: []string{"cgr.dev/chainguard/redis"},
+			Image: "redis",
+			Results: []Result{
+				{
+					Ref:     "cgr.dev/chainguard/redis",
+					Repo:    "redis",
+					Tier:    "APPLICATION",
+					Aliases: []string{},
+					MatchFn: "matchBasename",
+					Score:   115,
+				},
+			},
 		},
 		{
 			Image:   "postgres",
-			Results: []string{},
+			Results: []Result{},
 		},
 	}
 
-	// Sort results for consistent comparison
-	opts := cmpopts.SortSlices(func(a, b string) bool {
-		return strings.Compare(a, b) < 0
-	})
-
-	if diff := cmp.Diff(expected, results, opts); diff != "" {
+	if diff := cmp.Diff(expected, results); diff != "" {
 		t.Errorf("mapping results mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -203,12 +248,21 @@ func TestMapperMapAllDuplicates(t *testing.T) {
 	// Should only have unique results
 	expected := []*Mapping{
 		{
-			Image:   "nginx",
-			Results: []string{"cgr.dev/chainguard/nginx"},
+			Image: "nginx",
+			Results: []Result{
+				{
+					Ref:     "cgr.dev/chainguard/nginx",
+					Repo:    "nginx",
+					Tier:    "APPLICATION",
+					Aliases: []string{},
+					MatchFn: "matchBasename",
+					Score:   115,
+				},
+			},
 		},
 		{
 			Image:   "redis",
-			Results: []string{},
+			Results: []Result{},
 		},
 	}
 
@@ -216,12 +270,7 @@ func TestMapperMapAllDuplicates(t *testing.T) {
 		t.Errorf("expected %d results, got %d", len(expected), len(results))
 	}
 
-	// Sort results for consistent comparison
-	opts := cmpopts.SortSlices(func(a, b string) bool {
-		return strings.Compare(a, b) < 0
-	})
-
-	if diff := cmp.Diff(expected, results, opts); diff != "" {
+	if diff := cmp.Diff(expected, results); diff != "" {
 		t.Errorf("mapping results mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -297,8 +346,25 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "nginx",
-				Results: []string{"cgr.dev/chainguard/nginx", "cgr.dev/chainguard/prod-nginx"},
+				Image: "nginx",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/nginx",
+						Repo:    "nginx",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/prod-nginx",
+						Repo:    "prod-nginx",
+						Tier:    "APPLICATION",
+						Aliases: []string{"nginx"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 		{
@@ -327,8 +393,25 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "redis",
-				Results: []string{"cgr.dev/chainguard/redis", "cgr.dev/chainguard/redis-prod"},
+				Image: "redis",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/redis",
+						Repo:    "redis",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/redis-prod",
+						Repo:    "redis-prod",
+						Tier:    "APPLICATION",
+						Aliases: []string{"redis"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 		{
@@ -365,8 +448,25 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "postgres",
-				Results: []string{"cgr.dev/chainguard/postgres", "cgr.dev/chainguard/postgres-prod"},
+				Image: "postgres",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/postgres",
+						Repo:    "postgres",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/postgres-prod",
+						Repo:    "postgres-prod",
+						Tier:    "APPLICATION",
+						Aliases: []string{"postgres"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 		{
@@ -395,8 +495,25 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "mysql",
-				Results: []string{"cgr.dev/chainguard/mysql", "cgr.dev/chainguard/mysql-new"},
+				Image: "mysql",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/mysql",
+						Repo:    "mysql",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/mysql-new",
+						Repo:    "mysql-new",
+						Tier:    "APPLICATION",
+						Aliases: []string{"mysql"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 		{
@@ -421,7 +538,7 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 			},
 			expected: &Mapping{
 				Image:   "alpine",
-				Results: []string{},
+				Results: []Result{},
 			},
 		},
 		{
@@ -456,8 +573,25 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "node",
-				Results: []string{"cgr.dev/chainguard/node", "cgr.dev/chainguard/node-staging"},
+				Image: "node",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/node",
+						Repo:    "node",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/node-staging",
+						Repo:    "node-staging",
+						Tier:    "APPLICATION",
+						Aliases: []string{"node"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 		{
@@ -486,8 +620,25 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				},
 			},
 			expected: &Mapping{
-				Image:   "python",
-				Results: []string{"cgr.dev/chainguard/python", "cgr.dev/chainguard/python-slim"},
+				Image: "python",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/python",
+						Repo:    "python",
+						Tier:    "APPLICATION",
+						Aliases: []string{},
+						MatchFn: "matchBasename",
+						Score:   115,
+					},
+					{
+						Ref:     "cgr.dev/chainguard/python-slim",
+						Repo:    "python-slim",
+						Tier:    "APPLICATION",
+						Aliases: []string{"python"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
 			},
 		},
 	}
@@ -505,11 +656,7 @@ func TestMapperMapWithCustomIgnoreFn(t *testing.T) {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
-			opts := cmpopts.SortSlices(func(a, b string) bool {
-				return strings.Compare(a, b) < 0
-			})
-
-			if diff := cmp.Diff(tc.expected, result, opts); diff != "" {
+			if diff := cmp.Diff(tc.expected, result); diff != "" {
 				t.Errorf("mapping mismatch (-want +got):\n%s", diff)
 			}
 		})
@@ -559,7 +706,7 @@ func TestMapperMapWithCustomIgnoreFnUsingAliases(t *testing.T) {
 
 	expected := &Mapping{
 		Image:   "redis",
-		Results: []string{},
+		Results: []Result{},
 	}
 
 	if diff := cmp.Diff(expected, result); diff != "" {
@@ -573,8 +720,17 @@ func TestMapperMapWithCustomIgnoreFnUsingAliases(t *testing.T) {
 	}
 
 	expected = &Mapping{
-		Image:   "nginx",
-		Results: []string{"cgr.dev/chainguard/web-server"},
+		Image: "nginx",
+		Results: []Result{
+			{
+				Ref:     "cgr.dev/chainguard/web-server",
+				Repo:    "web-server",
+				Tier:    "APPLICATION",
+				Aliases: []string{"nginx", "httpd"},
+				MatchFn: "matchAliases",
+				Score:   95,
+			},
+		},
 	}
 
 	if diff := cmp.Diff(expected, result); diff != "" {
@@ -614,15 +770,36 @@ func TestMapperMapWithNoIgnoreFns(t *testing.T) {
 
 	// Should get all matching repos when no ignore functions are set
 	expected := &Mapping{
-		Image:   "nginx",
-		Results: []string{"cgr.dev/chainguard/nginx", "cgr.dev/chainguard/nginx-dev", "cgr.dev/chainguard/nginx-test"},
+		Image: "nginx",
+		Results: []Result{
+			{
+				Ref:     "cgr.dev/chainguard/nginx",
+				Repo:    "nginx",
+				Tier:    "APPLICATION",
+				Aliases: []string{},
+				MatchFn: "matchBasename",
+				Score:   115,
+			},
+			{
+				Ref:     "cgr.dev/chainguard/nginx-dev",
+				Repo:    "nginx-dev",
+				Tier:    "APPLICATION",
+				Aliases: []string{"nginx"},
+				MatchFn: "matchAliases",
+				Score:   95,
+			},
+			{
+				Ref:     "cgr.dev/chainguard/nginx-test",
+				Repo:    "nginx-test",
+				Tier:    "APPLICATION",
+				Aliases: []string{"nginx"},
+				MatchFn: "matchAliases",
+				Score:   95,
+			},
+		},
 	}
 
-	opts := cmpopts.SortSlices(func(a, b string) bool {
-		return strings.Compare(a, b) < 0
-	})
-
-	if diff := cmp.Diff(expected, result, opts); diff != "" {
+	if diff := cmp.Diff(expected, result); diff != "" {
 		t.Errorf("mapping mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1072,9 +1249,11 @@ func TestMapperIntegration(t *testing.T) {
 				t.Errorf("unexpected error mapping %s: %s", img, err)
 			}
 
-			want := &Mapping{
-				Image:   img,
-				Results: wantResults,
+			// The tiers, tags and scores of results depend on the live
+			// catalog, so only compare the references
+			gotResults := []string{}
+			for _, result := range got.Results {
+				gotResults = append(gotResults, result.Ref)
 			}
 
 			// Compare image references without tags since tags are dynamic
@@ -1088,10 +1267,113 @@ func TestMapperIntegration(t *testing.T) {
 				}),
 			}
 
-			if diff := cmp.Diff(want, got, opts); diff != "" {
+			if diff := cmp.Diff(wantResults, gotResults, opts); diff != "" {
 				t.Errorf("unexpected mapping for %s:\n%s", img, diff)
 			}
 		})
 	}
 
 }
+
+// ownerIterator is a helper type for testing iterators that know the owners
+// of images
+type ownerIterator struct {
+	Iterator
+	owners map[string][]Owner
+}
+
+func (it *ownerIterator) Owners(image string) []Owner {
+	return it.owners[image]
+}
+
+func TestMapperMapAllOwners(t *testing.T) {
+	m := &mapper{
+		repos: []Repo{
+			{
+				Name:        "nginx",
+				CatalogTier: "APPLICATION",
+			},
+		},
+		repoName: "cgr.dev/chainguard",
+	}
+
+	iterator := &ownerIterator{
+		Iterator: NewArgsIterator([]string{"nginx", "redis"}),
+		owners: map[string][]Owner{
+			"nginx": {
+				{Kind: "Deployment", Name: "web", Namespace: "default"},
+				{Kind: "Pod", Name: "debug", Namespace: "tools"},
+			},
+		},
+	}
+
+	results, err := m.MapAll(iterator)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []*Mapping{
+		{
+			Image: "nginx",
+			Results: []Result{
+				{
+					Ref:     "cgr.dev/chainguard/nginx",
+					Repo:    "nginx",
+					Tier:    "APPLICATION",
+					MatchFn: "matchBasename",
+					Score:   115,
+				},
+			},
+			Owners: []Owner{
+				{Kind: "Deployment", Name: "web", Namespace: "default"},
+				{Kind: "Pod", Name: "debug", Namespace: "tools"},
+			},
+		},
+		{
+			Image:   "redis",
+			Results: []Result{},
+		},
+	}
+
+	if diff := cmp.Diff(expected, results); diff != "" {
+		t.Errorf("mapping results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMapAllPreservesOrder(t *testing.T) {
+	var repos []Repo
+	var images []string
+	for i := range 200 {
+		repo := fmt.Sprintf("image-%d", i)
+		repos = append(repos, Repo{Name: repo, CatalogTier: "APPLICATION"})
+		images = append(images, fmt.Sprintf("registry.example.com/%s", repo))
+	}
+
+	m := &mapper{
+		repos:    repos,
+		repoName: "cgr.dev/chainguard",
+	}
+
+	for _, workers := range []int{0, 1, 8, 500} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			// Include duplicates, which should only be mapped once
+			mappings, err := MapAll(m, NewArgsIterator(slices.Concat(images, images)), workers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(mappings) != len(images) {
+				t.Fatalf("expected %d mappings, got %d", len(images), len(mappings))
+			}
+			for i, mapping := range mappings {
+				if mapping.Image != images[i] {
+					t.Fatalf("expected mapping %d to be for %s, got %s", i, images[i], mapping.Image)
+				}
+				want := []string{fmt.Sprintf("cgr.dev/chainguard/image-%d", i)}
+				if diff := cmp.Diff(want, mapping.Refs()); diff != "" {
+					t.Errorf("unexpected results for %s (-want +got):\n%s", mapping.Image, diff)
+				}
+			}
+		})
+	}
+}
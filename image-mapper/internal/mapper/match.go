@@ -11,15 +11,21 @@ import (
 // Match returns true if the container image described by the reference
 // matches the provided Chainguard repostory
 func Match(ref name.Reference, repo Repo) bool {
+	return findMatchFn(ref, repo) != nil
+}
+
+// findMatchFn returns the first MatchFn that matches the reference to the
+// repository, or nil if there isn't one
+func findMatchFn(ref name.Reference, repo Repo) MatchFn {
 	for _, fn := range matchFns {
 		if !fn(ref, repo) {
 			continue
 		}
 
-		return true
+		return fn
 	}
 
-	return false
+	return nil
 }
 
 // MatchFn checks whether a given reference corresponds to a Chainguard repo
@@ -8,24 +8,37 @@ import (
 // MatchTag returns the best matching tag for the input tag. It'll return
 // an empty string if it can't find an appropriate match.
 func MatchTag(tags []string, tag string) string {
-	for _, fn := range matchTagFns {
+	match, _ := findMatchTag(tags, tag, DefaultTagVariants)
+
+	return match
+}
+
+// findMatchTag returns the best matching tag for the input tag, along with the
+// MatchTagFn that matched it. Variants of upstream tags are matched with the
+// provided variants.
+func findMatchTag(tags []string, tag string, variants TagVariants) (string, MatchTagFn) {
+	for _, fn := range matchTagFns(variants) {
 		match := fn(tags, tag)
 		if match == "" {
 			continue
 		}
 
-		return match
+		return match, fn
 	}
 
-	return ""
+	return "", nil
 }
 
 // MatchTagFn matches a tag to one of the provided tags
 type MatchTagFn func(tags []string, tag string) string
 
-var matchTagFns = []MatchTagFn{
-	matchEqualTag,
-	matchClosestSemanticVersionTag,
+// matchTagFns returns the MatchTagFns in the order they're tried
+func matchTagFns(variants TagVariants) []MatchTagFn {
+	return []MatchTagFn{
+		matchEqualTag,
+		matchVariantTag(variants),
+		matchClosestSemanticVersionTag,
+	}
 }
 
 // matchEqualTag identifies an exact match between the input tag and one of the
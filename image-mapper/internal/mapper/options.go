@@ -1,13 +1,23 @@
 package mapper
 
+import "github.com/google/go-containerregistry/pkg/authn"
+
 // Option configures a Mapper
 type Option func(*options)
 
 type options struct {
-	ignoreFns    []IgnoreFn
-	repo         string
-	inactiveTags bool
-	tagFilters   []TagFilter
+	ignoreFns     []IgnoreFn
+	repo          string
+	inactiveTags  bool
+	tagFilters    []TagFilter
+	variants      TagVariants
+	catalogSource CatalogSource
+	explain       bool
+	scorePolicy   ScorePolicy
+	overrides     *Overrides
+	overridesFile string
+	pinDigests    bool
+	keychain      authn.Keychain
 }
 
 // WithIgnoreFns is a functional option that configures the IgnoreFns used by
@@ -34,6 +44,14 @@ func WithTagFilters(tagFilters ...TagFilter) Option {
 	}
 }
 
+// WithTagVariants is a functional option that configures additional suffixes
+// for variant-aware tag matching. They're merged over DefaultTagVariants.
+func WithTagVariants(variants TagVariants) Option {
+	return func(o *options) {
+		o.variants = variants
+	}
+}
+
 // WithInactiveTags is a functional option that configures the mapper to include
 // inactive tags in its matching
 func WithInactiveTags(inactiveTags bool) Option {
@@ -41,3 +59,62 @@ func WithInactiveTags(inactiveTags bool) Option {
 		o.inactiveTags = inactiveTags
 	}
 }
+
+// WithCatalogSource is a functional option that configures where the mapper
+// loads the catalog from. By default, the catalog is queried from the live
+// endpoint.
+func WithCatalogSource(src CatalogSource) Option {
+	return func(o *options) {
+		o.catalogSource = src
+	}
+}
+
+// WithExplain is a functional option that configures the mapper to record how
+// it arrived at the results of each mapping
+func WithExplain(explain bool) Option {
+	return func(o *options) {
+		o.explain = explain
+	}
+}
+
+// WithScorePolicy is a functional option that configures how the mapper ranks
+// results
+func WithScorePolicy(policy ScorePolicy) Option {
+	return func(o *options) {
+		o.scorePolicy = policy
+	}
+}
+
+// WithOverrides is a functional option that configures user supplied mappings
+// that are applied ahead of the built-in matching logic
+func WithOverrides(overrides *Overrides) Option {
+	return func(o *options) {
+		o.overrides = overrides
+	}
+}
+
+// WithOverridesFile is a functional option that reads overrides from a YAML or
+// JSON file. See Overrides for the format.
+func WithOverridesFile(path string) Option {
+	return func(o *options) {
+		o.overridesFile = path
+	}
+}
+
+// WithPinDigests is a functional option that configures the mapper to resolve
+// the digest of each result and pin it, i.e
+// cgr.dev/chainguard/nginx:1.27@sha256:...
+func WithPinDigests(pinDigests bool) Option {
+	return func(o *options) {
+		o.pinDigests = pinDigests
+	}
+}
+
+// WithKeychain is a functional option that configures the keychain used to
+// authenticate with the registry when resolving digests. By default, the
+// credentials in the Docker config are used, like authn.DefaultKeychain.
+func WithKeychain(keychain authn.Keychain) Option {
+	return func(o *options) {
+		o.keychain = keychain
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 )
 
@@ -16,26 +17,94 @@ func NewOutput(format string) (Output, error) {
 	switch strings.ToLower(format) {
 	case "csv":
 		return outputCSV, nil
+	case "tsv":
+		return outputTSV, nil
 	case "json":
 		return outputJSON, nil
 	case "text":
 		return outputText, nil
+	case "markdown", "md":
+		return outputMarkdown, nil
+	case "html":
+		return outputHTML, nil
+	case "customer-yaml":
+		return outputCustomerYAML, nil
 	default:
-		return nil, fmt.Errorf("unsupported output format: %s (supported: csv, json, text)", format)
+		return nil, fmt.Errorf("unsupported output format: %s (supported: csv, customer-yaml, html, json, markdown, text, tsv)", format)
 	}
 }
 
+// csvHeader are the columns of the CSV and TSV outputs. There's a row for each
+// result of a mapping, or a single row without a result if the image wasn't
+// mapped.
+var csvHeader = []string{"image", "status", "result", "repo", "tag", "tag_match", "digest", "tier", "match", "score", "used_by"}
+
 func outputCSV(w io.Writer, mappings []*Mapping) error {
+	return outputDelimited(w, mappings, ',')
+}
+
+func outputTSV(w io.Writer, mappings []*Mapping) error {
+	return outputDelimited(w, mappings, '\t')
+}
+
+// outputDelimited writes a row for each result, with the fields separated by
+// the delimiter
+func outputDelimited(w io.Writer, mappings []*Mapping, delimiter rune) error {
 	writer := csv.NewWriter(w)
-	defer writer.Flush()
+	writer.Comma = delimiter
 
+	if err := writer.Write(csvHeader); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
 	for _, m := range mappings {
-		if err := writer.Write([]string{m.Image, fmt.Sprintf("%s", m.Results)}); err != nil {
-			return fmt.Errorf("writing CSV record: %w", err)
+		var usedBy []string
+		for _, owner := range m.Owners {
+			usedBy = append(usedBy, owner.String())
+		}
+
+		if len(m.Results) == 0 {
+			if err := writer.Write([]string{m.Image, string(m.Status()), "", "", "", "", "", "", "", "", strings.Join(usedBy, ";")}); err != nil {
+				return fmt.Errorf("writing record: %w", err)
+			}
+			continue
+		}
+
+		for _, result := range m.Results {
+			tag, digest := splitRef(result.Ref)
+
+			if err := writer.Write([]string{
+				m.Image,
+				string(m.Status()),
+				result.Ref,
+				result.Repo,
+				tag,
+				string(result.TagMatch),
+				digest,
+				result.Tier,
+				result.MatchFn,
+				strconv.Itoa(result.Score),
+				strings.Join(usedBy, ";"),
+			}); err != nil {
+				return fmt.Errorf("writing record: %w", err)
+			}
 		}
 	}
 
-	return nil
+	writer.Flush()
+	return writer.Error()
+}
+
+// splitRef returns the tag and digest of a reference, i.e 1.27 and sha256:...
+// for cgr.dev/chainguard/nginx:1.27@sha256:...
+func splitRef(ref string) (string, string) {
+	ref, digest, _ := strings.Cut(ref, "@")
+
+	var tag string
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		tag = ref[i+1:]
+	}
+
+	return tag, digest
 }
 
 func outputJSON(w io.Writer, mappings []*Mapping) error {
@@ -45,11 +114,39 @@ func outputJSON(w io.Writer, mappings []*Mapping) error {
 func outputText(w io.Writer, mappings []*Mapping) error {
 	for _, m := range mappings {
 		for _, result := range m.Results {
-			fmt.Fprintf(w, "%s -> %s\n", m.Image, result)
+			fmt.Fprintf(w, "%s -> %s\n", m.Image, result.Ref)
 		}
 		if len(m.Results) == 0 {
 			fmt.Fprintf(w, "%s ->\n", m.Image)
 		}
+		for _, owner := range m.Owners {
+			fmt.Fprintf(w, "    used by %s\n", owner)
+		}
+		if m.Explanation != nil {
+			writeExplanation(w, m.Explanation)
+		}
 	}
 	return nil
 }
+
+// writeExplanation writes a human readable explanation beneath the results of
+// a mapping
+func writeExplanation(w io.Writer, e *Explanation) {
+	if e.Override != "" {
+		fmt.Fprintf(w, "    %s\n", e.Override)
+	}
+	for _, match := range e.Matches {
+		fmt.Fprintf(w, "    matched %s with %s", match.Repo, match.MatchFn)
+		if match.MatchTagFn != "" {
+			fmt.Fprintf(w, ", tag with %s", match.MatchTagFn)
+		}
+		fmt.Fprintf(w, " (score: %d)\n", match.Score)
+	}
+	for _, drop := range e.Dropped {
+		if drop.Tag != "" {
+			fmt.Fprintf(w, "    dropped %s:%s with %s\n", drop.Repo, drop.Tag, drop.By)
+			continue
+		}
+		fmt.Fprintf(w, "    dropped %s with %s\n", drop.Repo, drop.By)
+	}
+}
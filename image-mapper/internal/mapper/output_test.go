@@ -0,0 +1,91 @@
+package mapper
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutputDelimited(t *testing.T) {
+	mappings := []*Mapping{
+		{
+			Image: "nginx:1.25",
+			Results: []Result{
+				{
+					Ref:      "cgr.dev/chainguard/nginx:1.25@sha256:abc",
+					Repo:     "nginx",
+					Tier:     "APPLICATION",
+					MatchFn:  "matchBasename",
+					TagMatch: TagMatchExact,
+					Score:    135,
+				},
+			},
+			Owners: []Owner{
+				{Kind: "Deployment", Namespace: "default", Name: "web"},
+				{Kind: "Pod", Namespace: "ops", Name: "debug"},
+			},
+		},
+		{
+			Image: "example.com/foo:1.2.3",
+			Results: []Result{
+				{
+					Ref:      "cgr.dev/chainguard/foo:1.2.4",
+					Repo:     "foo",
+					Tier:     "APPLICATION",
+					MatchFn:  "matchBasename",
+					TagMatch: TagMatchApproximate,
+					Score:    125,
+				},
+				{
+					Ref:     "registry.internal:5000/cgr/bar-foo",
+					Repo:    "bar-foo",
+					Tier:    "PREMIUM",
+					MatchFn: "matchAliases",
+					Score:   95,
+				},
+			},
+		},
+		{
+			Image: "registry.internal/legacy/app:1.0",
+		},
+	}
+
+	testCases := map[string]string{
+		"csv": `image,status,result,repo,tag,tag_match,digest,tier,match,score,used_by
+nginx:1.25,mapped,cgr.dev/chainguard/nginx:1.25@sha256:abc,nginx,1.25,exact,sha256:abc,APPLICATION,matchBasename,135,Deployment/default/web;Pod/ops/debug
+example.com/foo:1.2.3,multiple,cgr.dev/chainguard/foo:1.2.4,foo,1.2.4,approximate,,APPLICATION,matchBasename,125,
+example.com/foo:1.2.3,multiple,registry.internal:5000/cgr/bar-foo,bar-foo,,,,PREMIUM,matchAliases,95,
+registry.internal/legacy/app:1.0,unmapped,,,,,,,,,
+`,
+		"tsv": "image\tstatus\tresult\trepo\ttag\ttag_match\tdigest\ttier\tmatch\tscore\tused_by\n" +
+			"nginx:1.25\tmapped\tcgr.dev/chainguard/nginx:1.25@sha256:abc\tnginx\t1.25\texact\tsha256:abc\tAPPLICATION\tmatchBasename\t135\tDeployment/default/web;Pod/ops/debug\n" +
+			"example.com/foo:1.2.3\tmultiple\tcgr.dev/chainguard/foo:1.2.4\tfoo\t1.2.4\tapproximate\t\tAPPLICATION\tmatchBasename\t125\t\n" +
+			"example.com/foo:1.2.3\tmultiple\tregistry.internal:5000/cgr/bar-foo\tbar-foo\t\t\t\tPREMIUM\tmatchAliases\t95\t\n" +
+			"registry.internal/legacy/app:1.0\tunmapped\t\t\t\t\t\t\t\t\t\n",
+	}
+
+	for format, want := range testCases {
+		t.Run(format, func(t *testing.T) {
+			output, err := NewOutput(format)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var buf bytes.Buffer
+			if err := output(&buf, mappings); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(want, buf.String()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewOutputUnsupported(t *testing.T) {
+	if _, err := NewOutput("xml"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
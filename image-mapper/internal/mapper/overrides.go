@@ -0,0 +1,338 @@
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+)
+
+// Overrides are user supplied mappings that are applied ahead of the built-in
+// matching logic
+//
+// For instance:
+//
+//	pins:
+//	  - name: registry.internal/mirror/nginx
+//	    repo: nginx
+//	  - glob: registry.internal/forks/*-operator
+//	    repo: prometheus-operator
+//	    tag: v0.80.0
+//	  - regex: ^registry\.internal/apps/(.*)$
+//	    repo: $1
+//	excludes:
+//	  - glob: registry.internal/legacy/*
+//	aliases:
+//	  redis:
+//	    - registry.internal/cache/redis-custom
+//	variants:
+//	  distroless: ""
+//	  sdk: dev
+type Overrides struct {
+	// Pins map images to specific Chainguard repos and, optionally, tags
+	Pins []Pin `yaml:"pins" json:"pins"`
+
+	// Excludes are images that shouldn't be mapped at all
+	Excludes []ImageMatcher `yaml:"excludes" json:"excludes"`
+
+	// Aliases are additional aliases for Chainguard repos, keyed by the
+	// name of the repo
+	Aliases map[string][]string `yaml:"aliases" json:"aliases"`
+
+	// Variants are additional suffixes for variant-aware tag matching.
+	// They take precedence over the default variants.
+	Variants TagVariants `yaml:"variants" json:"variants"`
+}
+
+// ImageMatcher matches an image repository by exact name, glob or regular
+// expression. Only one of the fields should be set.
+//
+// The image is matched without its tag or digest, both as provided and in its
+// fully qualified form (i.e index.docker.io/library/nginx).
+type ImageMatcher struct {
+	Name  string `yaml:"name,omitempty" json:"name,omitempty"`
+	Glob  string `yaml:"glob,omitempty" json:"glob,omitempty"`
+	Regex string `yaml:"regex,omitempty" json:"regex,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// Pin maps images matched by the ImageMatcher to a Chainguard repo. If Tag is
+// empty, then the tag is matched against the repo's tags in the catalog as
+// usual.
+//
+// When matching by regex, Repo may refer to capture groups (i.e $1).
+type Pin struct {
+	ImageMatcher `yaml:",inline"`
+
+	Repo string `yaml:"repo" json:"repo"`
+	Tag  string `yaml:"tag,omitempty" json:"tag,omitempty"`
+}
+
+// ReadOverrides reads overrides in YAML or JSON format
+func ReadOverrides(r io.Reader) (*Overrides, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading overrides: %w", err)
+	}
+
+	var overrides Overrides
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&overrides); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("decoding overrides: %w", err)
+	}
+
+	if err := overrides.compile(); err != nil {
+		return nil, err
+	}
+
+	return &overrides, nil
+}
+
+// ReadOverridesFile reads overrides from a file on disk
+func ReadOverridesFile(path string) (*Overrides, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening overrides: %w", err)
+	}
+	defer f.Close()
+
+	overrides, err := ReadOverrides(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return overrides, nil
+}
+
+// compile validates the overrides and compiles the regular expressions
+func (o *Overrides) compile() error {
+	for i := range o.Pins {
+		if o.Pins[i].Repo == "" {
+			return fmt.Errorf("pins[%d]: repo is required", i)
+		}
+		if err := o.Pins[i].ImageMatcher.compile(); err != nil {
+			return fmt.Errorf("pins[%d]: %w", i, err)
+		}
+	}
+	for i := range o.Excludes {
+		if err := o.Excludes[i].compile(); err != nil {
+			return fmt.Errorf("excludes[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// compile validates the matcher and compiles the regular expression, if there
+// is one
+func (im *ImageMatcher) compile() error {
+	set := 0
+	for _, v := range []string{im.Name, im.Glob, im.Regex} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("exactly one of name, glob or regex must be set")
+	}
+
+	if im.Glob != "" {
+		if _, err := path.Match(im.Glob, ""); err != nil {
+			return fmt.Errorf("invalid glob: %s: %w", im.Glob, err)
+		}
+	}
+
+	if im.Regex != "" {
+		re, err := regexp.Compile(im.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex: %s: %w", im.Regex, err)
+		}
+		im.re = re
+	}
+
+	return nil
+}
+
+// String describes the matcher
+func (im ImageMatcher) String() string {
+	switch {
+	case im.Name != "":
+		return fmt.Sprintf("name %q", im.Name)
+	case im.Glob != "":
+		return fmt.Sprintf("glob %q", im.Glob)
+	default:
+		return fmt.Sprintf("regex %q", im.Regex)
+	}
+}
+
+// match returns the candidate that the matcher matched, or an empty string if
+// it didn't match any of them
+func (im ImageMatcher) match(ref name.Reference, candidates []string) string {
+	if im.Name != "" {
+		nref, err := name.ParseReference(im.Name)
+		if err != nil || nref.Context().String() != ref.Context().String() {
+			return ""
+		}
+		return ref.Context().String()
+	}
+
+	for _, c := range candidates {
+		switch {
+		case im.Glob != "":
+			if ok, _ := path.Match(im.Glob, c); ok {
+				return c
+			}
+		case im.re != nil:
+			if im.re.MatchString(c) {
+				return c
+			}
+		}
+	}
+
+	return ""
+}
+
+// repoCandidates returns the strings that matchers are evaluated against: the
+// repository as it was provided and its fully qualified name
+func repoCandidates(image string, ref name.Reference) []string {
+	provided := strings.Split(image, "@")[0]
+	if i := strings.LastIndex(provided, ":"); i > strings.LastIndex(provided, "/") {
+		provided = provided[:i]
+	}
+
+	return []string{provided, ref.Context().String()}
+}
+
+// exclude returns the matcher that excludes the image, if any
+func (o *Overrides) exclude(image string, ref name.Reference) *ImageMatcher {
+	candidates := repoCandidates(image, ref)
+	for i, ex := range o.Excludes {
+		if ex.match(ref, candidates) == "" {
+			continue
+		}
+		return &o.Excludes[i]
+	}
+
+	return nil
+}
+
+// pin returns the pin that applies to the image and the Chainguard repo it
+// maps to, if any
+func (o *Overrides) pin(image string, ref name.Reference) (*Pin, string) {
+	candidates := repoCandidates(image, ref)
+	for i, pin := range o.Pins {
+		matched := pin.match(ref, candidates)
+		if matched == "" {
+			continue
+		}
+
+		repo := pin.Repo
+		if pin.re != nil {
+			submatches := pin.re.FindStringSubmatchIndex(matched)
+			repo = string(pin.re.ExpandString(nil, pin.Repo, matched, submatches))
+		}
+
+		return &o.Pins[i], repo
+	}
+
+	return nil, ""
+}
+
+// addAliases adds the aliases in the overrides to the repos
+func (o *Overrides) addAliases(repos []Repo) []Repo {
+	for i, repo := range repos {
+		aliases, ok := o.Aliases[repo.Name]
+		if !ok {
+			continue
+		}
+		repos[i].Aliases = slices.Concat(repos[i].Aliases, aliases)
+	}
+
+	return repos
+}
+
+// pinScore is the score given to pinned results. It outranks any score given
+// by the built-in matching logic.
+const pinScore = 1000
+
+// mapOverride returns the mapping for an image that is excluded or pinned by
+// the overrides. It returns nil if no override applies to the image.
+func (m *mapper) mapOverride(image string, ref name.Tag) *Mapping {
+	if ex := m.overrides.exclude(image, ref); ex != nil {
+		mapping := &Mapping{
+			Image:   image,
+			Results: []Result{},
+		}
+		if m.explain {
+			mapping.Explanation = &Explanation{
+				Override: fmt.Sprintf("excluded by %s", ex),
+			}
+		}
+
+		return mapping
+	}
+
+	pin, repoName := m.overrides.pin(image, ref)
+	if pin == nil {
+		return nil
+	}
+
+	res := Result{
+		Repo:    repoName,
+		MatchFn: "pin",
+		Score:   pinScore,
+	}
+
+	// If the tag isn't pinned, then match it against the tags in the
+	// catalog like we would for any other result. The repo may not be in
+	// the catalog, i.e if it was pinned before it was released.
+	tag := pin.Tag
+	var matchTagFn MatchTagFn
+	if i := m.repoIndex().repo(repoName); i != -1 {
+		res.Tier = m.repos[i].CatalogTier
+		res.Aliases = m.repos[i].Aliases
+		if tag == "" {
+			tag, matchTagFn = findMatchTag(filterTags(m.repos[i], m.tagFilters...), ref.TagStr(), m.variants)
+		}
+	}
+
+	result := fmt.Sprintf("%s/%s", m.repoName, repoName)
+	if tag != "" {
+		result = fmt.Sprintf("%s:%s", result, tag)
+	}
+	res.Ref = result
+	res.TagMatch = tagMatch(matchTagFn)
+	if pin.Tag != "" {
+		res.TagMatch = TagMatchExact
+	}
+
+	mapping := &Mapping{
+		Image:   image,
+		Results: []Result{res},
+	}
+	if m.explain {
+		mapping.Explanation = &Explanation{
+			Override: fmt.Sprintf("pinned by %s", pin.ImageMatcher),
+			Matches: []MatchExplanation{
+				{
+					Result:     result,
+					Repo:       repoName,
+					MatchFn:    "pin",
+					MatchTagFn: funcName(matchTagFn),
+					Score:      pinScore,
+				},
+			},
+		}
+	}
+
+	return mapping
+}
@@ -0,0 +1,308 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReadOverrides(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expectError bool
+	}{
+		{
+			name: "yaml",
+			input: `
+pins:
+  - name: registry.internal/mirror/nginx
+    repo: nginx
+  - glob: registry.internal/forks/*
+    repo: redis
+    tag: "7"
+  - regex: ^registry\.internal/apps/(.*)$
+    repo: $1
+excludes:
+  - glob: registry.internal/legacy/*
+aliases:
+  redis:
+    - registry.internal/cache/redis-custom
+variants:
+  sdk: dev
+`,
+		},
+		{
+			name:  "json",
+			input: `{"pins": [{"name": "registry.internal/mirror/nginx", "repo": "nginx"}], "excludes": [{"regex": "^legacy/"}]}`,
+		},
+		{
+			name:  "empty",
+			input: ``,
+		},
+		{
+			name: "pin without repo",
+			input: `
+pins:
+  - name: nginx
+`,
+			expectError: true,
+		},
+		{
+			name: "multiple matchers",
+			input: `
+excludes:
+  - name: nginx
+    glob: nginx*
+`,
+			expectError: true,
+		},
+		{
+			name: "no matchers",
+			input: `
+excludes:
+  - {}
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid regex",
+			input: `
+excludes:
+  - regex: "["
+`,
+			expectError: true,
+		},
+		{
+			name: "invalid glob",
+			input: `
+excludes:
+  - glob: "["
+`,
+			expectError: true,
+		},
+		{
+			name: "unknown field",
+			input: `
+pin:
+  - name: nginx
+    repo: nginx
+`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ReadOverrides(strings.NewReader(tc.input))
+			if tc.expectError && err == nil {
+				t.Fatal("expected error but got none")
+			}
+			if !tc.expectError && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		})
+	}
+}
+
+func TestMapperMapOverrides(t *testing.T) {
+	overrides, err := ReadOverrides(strings.NewReader(`
+pins:
+  - name: registry.internal/mirror/nginx
+    repo: nginx
+  - glob: registry.internal/forks/*-operator
+    repo: prometheus-operator
+    tag: v0.80.0
+  - regex: ^registry\.internal/apps/(.*)$
+    repo: app-$1
+excludes:
+  - glob: registry.internal/legacy/*
+  - name: redis
+aliases:
+  valkey:
+    - registry.internal/cache/valkey-custom
+`))
+	if err != nil {
+		t.Fatalf("unexpected error reading overrides: %s", err)
+	}
+
+	repos := []Repo{
+		{
+			Name:        "nginx",
+			CatalogTier: "APPLICATION",
+			ActiveTags:  []string{"1.27", "1.27-dev"},
+		},
+		{
+			Name:        "redis",
+			CatalogTier: "APPLICATION",
+		},
+		{
+			Name:        "valkey",
+			CatalogTier: "APPLICATION",
+		},
+	}
+
+	repos = overrides.addAliases(repos)
+
+	testCases := []struct {
+		name  string
+		image string
+		want  *Mapping
+	}{
+		{
+			name:  "pin by name matches tag from catalog",
+			image: "registry.internal/mirror/nginx:1.25",
+			want: &Mapping{
+				Image: "registry.internal/mirror/nginx:1.25",
+				Results: []Result{
+					{
+						Ref:      "cgr.dev/chainguard/nginx:1.27",
+						Repo:     "nginx",
+						Tier:     "APPLICATION",
+						MatchFn:  "pin",
+						TagMatch: TagMatchApproximate,
+						Score:    pinScore,
+					},
+				},
+			},
+		},
+		{
+			name:  "pin by glob with tag",
+			image: "registry.internal/forks/prometheus-operator:v0.60.0",
+			want: &Mapping{
+				Image: "registry.internal/forks/prometheus-operator:v0.60.0",
+				Results: []Result{
+					{
+						Ref:      "cgr.dev/chainguard/prometheus-operator:v0.80.0",
+						Repo:     "prometheus-operator",
+						MatchFn:  "pin",
+						TagMatch: TagMatchExact,
+						Score:    pinScore,
+					},
+				},
+			},
+		},
+		{
+			name:  "pin by regex with capture group",
+			image: "registry.internal/apps/billing:1.0.0",
+			want: &Mapping{
+				Image: "registry.internal/apps/billing:1.0.0",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/app-billing",
+						Repo:    "app-billing",
+						MatchFn: "pin",
+						Score:   pinScore,
+					},
+				},
+			},
+		},
+		{
+			name:  "exclude by glob",
+			image: "registry.internal/legacy/nginx:1.0",
+			want: &Mapping{
+				Image:   "registry.internal/legacy/nginx:1.0",
+				Results: []Result{},
+			},
+		},
+		{
+			name:  "exclude by name matches fully qualified name",
+			image: "docker.io/library/redis:7",
+			want: &Mapping{
+				Image:   "docker.io/library/redis:7",
+				Results: []Result{},
+			},
+		},
+		{
+			name:  "additional alias",
+			image: "registry.internal/cache/valkey-custom",
+			want: &Mapping{
+				Image: "registry.internal/cache/valkey-custom",
+				Results: []Result{
+					{
+						Ref:     "cgr.dev/chainguard/valkey",
+						Repo:    "valkey",
+						Tier:    "APPLICATION",
+						Aliases: []string{"registry.internal/cache/valkey-custom"},
+						MatchFn: "matchAliases",
+						Score:   95,
+					},
+				},
+			},
+		},
+		{
+			name:  "no override",
+			image: "nginx:1.27",
+			want: &Mapping{
+				Image: "nginx:1.27",
+				Results: []Result{
+					{
+						Ref:      "cgr.dev/chainguard/nginx:1.27",
+						Repo:     "nginx",
+						Tier:     "APPLICATION",
+						MatchFn:  "matchBasename",
+						TagMatch: TagMatchExact,
+						Score:    135,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &mapper{
+				repos:      repos,
+				repoName:   "cgr.dev/chainguard",
+				tagFilters: []TagFilter{TagFilterExcludeDev},
+				overrides:  overrides,
+			}
+
+			got, err := m.Map(tc.image)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mapping mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewMapperWithOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.yaml")
+	if err := os.WriteFile(path, []byte(`
+pins:
+  - name: registry.internal/mirror/nginx
+    repo: nginx
+`), 0o644); err != nil {
+		t.Fatalf("unexpected error writing overrides: %s", err)
+	}
+
+	src := &countingCatalogSource{
+		catalog: &Catalog{
+			Version: CatalogVersion,
+			Repos: []Repo{
+				{Name: "nginx", CatalogTier: "APPLICATION", ActiveTags: []string{"1.27"}},
+			},
+		},
+	}
+
+	m, err := NewMapper(t.Context(), WithCatalogSource(src), WithOverridesFile(path))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	got, err := MapImage(m, "registry.internal/mirror/nginx:1.27")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.String() != "cgr.dev/chainguard/nginx:1.27" {
+		t.Errorf("expected cgr.dev/chainguard/nginx:1.27, got %s", got)
+	}
+}
@@ -0,0 +1,251 @@
+package mapper
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Status describes how an image was mapped
+type Status string
+
+const (
+	// StatusMapped is an image that was mapped to a single result
+	StatusMapped Status = "mapped"
+
+	// StatusMultiple is an image that was mapped to several candidates,
+	// which need to be reviewed
+	StatusMultiple Status = "multiple"
+
+	// StatusUnmapped is an image that wasn't mapped at all
+	StatusUnmapped Status = "unmapped"
+)
+
+// Status returns how the image was mapped
+func (m *Mapping) Status() Status {
+	switch len(m.Results) {
+	case 0:
+		return StatusUnmapped
+	case 1:
+		return StatusMapped
+	default:
+		return StatusMultiple
+	}
+}
+
+// reportGroup is a section of a report with the mappings of one status
+type reportGroup struct {
+	Title    string
+	Status   Status
+	Mappings []*Mapping
+}
+
+// groupMappings groups the mappings by status, in the order they're reported
+func groupMappings(mappings []*Mapping) []reportGroup {
+	groups := []reportGroup{
+		{Title: "Mapped", Status: StatusMapped},
+		{Title: "Multiple Candidates", Status: StatusMultiple},
+		{Title: "Unmapped", Status: StatusUnmapped},
+	}
+	for _, m := range mappings {
+		for i := range groups {
+			if groups[i].Status == m.Status() {
+				groups[i].Mappings = append(groups[i].Mappings, m)
+			}
+		}
+	}
+
+	return groups
+}
+
+// hasOwners returns true if any of the mappings have owners, in which case
+// the reports include a column for them
+func hasOwners(mappings []*Mapping) bool {
+	for _, m := range mappings {
+		if len(m.Owners) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func outputMarkdown(w io.Writer, mappings []*Mapping) error {
+	groups := groupMappings(mappings)
+	owners := hasOwners(mappings)
+
+	fmt.Fprintln(w, "# Image Migration Report")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| Status | Images |")
+	fmt.Fprintln(w, "| --- | --- |")
+	for _, g := range groups {
+		fmt.Fprintf(w, "| %s | %d |\n", g.Title, len(g.Mappings))
+	}
+
+	for _, g := range groups {
+		if len(g.Mappings) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "## %s\n", g.Title)
+		fmt.Fprintln(w)
+
+		header := "| Image | Chainguard Image | Tier |"
+		if owners {
+			header += " Used By |"
+		}
+		fmt.Fprintln(w, header)
+		fmt.Fprintln(w, strings.Repeat("| --- ", strings.Count(header, "|")-1)+"|")
+
+		for _, m := range g.Mappings {
+			var results, tiers, usedBy []string
+			for _, result := range m.Results {
+				results = append(results, MarkdownCode(result.Ref))
+				tiers = append(tiers, MarkdownEscape(result.Tier))
+			}
+			for _, owner := range m.Owners {
+				usedBy = append(usedBy, MarkdownEscape(owner.String()))
+			}
+
+			row := fmt.Sprintf("| %s | %s | %s |",
+				MarkdownCode(m.Image),
+				strings.Join(results, "<br>"),
+				strings.Join(tiers, "<br>"),
+			)
+			if owners {
+				row += fmt.Sprintf(" %s |", strings.Join(usedBy, "<br>"))
+			}
+			fmt.Fprintln(w, row)
+		}
+	}
+
+	return nil
+}
+
+// MarkdownCode formats s as inline code in a Markdown table cell
+func MarkdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	return "`" + MarkdownEscape(s) + "`"
+}
+
+// MarkdownEscape escapes the characters that would break a Markdown table cell
+func MarkdownEscape(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// htmlReport is a self-contained report, with the styles inline, so that it
+// can be shared as a single file
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Image Migration Report</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #d0d7de; padding: 6px 12px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+.mapped { color: #1a7f37; }
+.multiple { color: #9a6700; }
+.unmapped { color: #cf222e; }
+</style>
+</head>
+<body>
+<h1>Image Migration Report</h1>
+<table>
+<tr><th>Status</th><th>Images</th></tr>
+{{- range .Groups }}
+<tr><td class="{{ .Status }}">{{ .Title }}</td><td>{{ len .Mappings }}</td></tr>
+{{- end }}
+</table>
+{{- range .Groups }}
+{{- if .Mappings }}
+<h2 class="{{ .Status }}">{{ .Title }}</h2>
+<table>
+<tr><th>Image</th><th>Chainguard Image</th><th>Tier</th>{{ if $.Owners }}<th>Used By</th>{{ end }}</tr>
+{{- range .Mappings }}
+<tr>
+<td><code>{{ .Image }}</code></td>
+<td>{{ range $i, $r := .Results }}{{ if $i }}<br>{{ end }}<code>{{ $r.Ref }}</code>{{ end }}</td>
+<td>{{ range $i, $r := .Results }}{{ if $i }}<br>{{ end }}{{ $r.Tier }}{{ end }}</td>
+{{- if $.Owners }}
+<td>{{ range $i, $o := .Owners }}{{ if $i }}<br>{{ end }}{{ $o }}{{ end }}</td>
+{{- end }}
+</tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
+
+func outputHTML(w io.Writer, mappings []*Mapping) error {
+	if err := htmlReport.Execute(w, struct {
+		Groups []reportGroup
+		Owners bool
+	}{
+		Groups: groupMappings(mappings),
+		Owners: hasOwners(mappings),
+	}); err != nil {
+		return fmt.Errorf("writing HTML report: %w", err)
+	}
+
+	return nil
+}
+
+// customerImage is an image in the customer-yaml output
+type customerImage struct {
+	Image   string           `yaml:"image"`
+	Status  Status           `yaml:"status"`
+	Results []customerResult `yaml:"results,omitempty"`
+	UsedBy  []string         `yaml:"usedBy,omitempty"`
+}
+
+// customerResult is a Chainguard image in the customer-yaml output
+type customerResult struct {
+	Image string `yaml:"image"`
+	Tier  string `yaml:"tier,omitempty"`
+}
+
+// outputCustomerYAML writes the mappings as a YAML document that can be
+// shared with application teams, and edited to record the chosen images
+func outputCustomerYAML(w io.Writer, mappings []*Mapping) error {
+	doc := struct {
+		Images []customerImage `yaml:"images"`
+	}{
+		Images: []customerImage{},
+	}
+	for _, m := range mappings {
+		img := customerImage{
+			Image:  m.Image,
+			Status: m.Status(),
+		}
+		for _, result := range m.Results {
+			img.Results = append(img.Results, customerResult{
+				Image: result.Ref,
+				Tier:  result.Tier,
+			})
+		}
+		for _, owner := range m.Owners {
+			img.UsedBy = append(img.UsedBy, owner.String())
+		}
+		doc.Images = append(doc.Images, img)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("writing YAML: %w", err)
+	}
+
+	return enc.Close()
+}
@@ -0,0 +1,73 @@
+package mapper
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMappingStatus(t *testing.T) {
+	testCases := map[Status]*Mapping{
+		StatusUnmapped: {Image: "foo"},
+		StatusMapped:   {Image: "nginx", Results: []Result{{Ref: "cgr.dev/chainguard/nginx"}}},
+		StatusMultiple: {Image: "nginx", Results: []Result{{Ref: "cgr.dev/chainguard/nginx"}, {Ref: "cgr.dev/chainguard/nginx-fips"}}},
+	}
+
+	for want, m := range testCases {
+		if got := m.Status(); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestOutputReports(t *testing.T) {
+	mappings := []*Mapping{
+		{
+			Image:   "nginx:1.25",
+			Results: []Result{{Ref: "cgr.dev/chainguard/nginx:1.25", Tier: "APPLICATION"}},
+			Owners:  []Owner{{Kind: "Deployment", Namespace: "default", Name: "web"}},
+		},
+		{
+			Image: "example.com/foo:1.2.3",
+			Results: []Result{
+				{Ref: "cgr.dev/chainguard/foo:1.2.3", Tier: "APPLICATION"},
+				{Ref: "cgr.dev/chainguard/bar-foo:1.2.3", Tier: "PREMIUM"},
+			},
+		},
+		{
+			Image: "registry.internal/legacy/app:1.0",
+		},
+	}
+
+	testCases := map[string]string{
+		"markdown":      "report.md",
+		"html":          "report.html",
+		"customer-yaml": "report.yaml",
+	}
+
+	for format, file := range testCases {
+		t.Run(format, func(t *testing.T) {
+			want, err := os.ReadFile(fmt.Sprintf("testdata/%s", file))
+			if err != nil {
+				t.Fatalf("unexpected error reading %s: %s", file, err)
+			}
+
+			output, err := NewOutput(format)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var buf bytes.Buffer
+			if err := output(&buf, mappings); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(string(want), buf.String()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
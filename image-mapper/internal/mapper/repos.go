@@ -117,7 +117,7 @@ func listRepos(ctx context.Context, inactiveTags bool) ([]Repo, error) {
 		return nil, fmt.Errorf("unmarshaling body: %w", err)
 	}
 
-	return fixAliases(data.Data.Repos), nil
+	return data.Data.Repos, nil
 }
 
 // fixAliases corrects some notoriously incorrect aliases in the repository
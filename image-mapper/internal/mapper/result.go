@@ -0,0 +1,69 @@
+package mapper
+
+// Result is a Chainguard image that an image maps to
+type Result struct {
+	// Ref is the reference to the Chainguard image, i.e
+	// cgr.dev/chainguard/nginx:1.27
+	Ref string `json:"ref"`
+
+	// Repo is the name of the Chainguard repo, i.e nginx
+	Repo string `json:"repo"`
+
+	// Tier is the catalog tier of the repo, i.e APPLICATION
+	Tier string `json:"tier,omitempty"`
+
+	// Aliases are the upstream images that the repo is an alternative to
+	Aliases []string `json:"aliases,omitempty"`
+
+	// MatchFn is the name of the MatchFn that matched the repo, i.e
+	// matchBasename, or pin for results pinned by an override
+	MatchFn string `json:"matchFn,omitempty"`
+
+	// TagMatch describes how the tag was matched. It's empty if the result
+	// doesn't have a tag.
+	TagMatch TagMatch `json:"tagMatch,omitempty"`
+
+	// Score is the score the result was ranked by
+	Score int `json:"score"`
+}
+
+// String returns the reference to the Chainguard image
+func (r Result) String() string {
+	return r.Ref
+}
+
+// TagMatch describes how the tag of a result was matched to the tag of the
+// image
+type TagMatch string
+
+const (
+	// TagMatchExact is a tag that is the same as the tag of the image, or
+	// that was pinned by an override
+	TagMatchExact TagMatch = "exact"
+
+	// TagMatchApproximate is a tag that is the closest match to the tag of
+	// the image, i.e 3.11 for 3.11-slim or 3.9 for 3.7
+	TagMatchApproximate TagMatch = "approximate"
+)
+
+// tagMatch returns how a tag matched by the MatchTagFn was matched
+func tagMatch(matchTagFn MatchTagFn) TagMatch {
+	switch funcName(matchTagFn) {
+	case "":
+		return ""
+	case funcName(matchEqualTag):
+		return TagMatchExact
+	default:
+		return TagMatchApproximate
+	}
+}
+
+// Refs returns the references of the results
+func (m *Mapping) Refs() []string {
+	refs := []string{}
+	for _, r := range m.Results {
+		refs = append(refs, r.Ref)
+	}
+
+	return refs
+}
@@ -0,0 +1,82 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestMapperMapTagMatch(t *testing.T) {
+	m := &mapper{
+		repos: []Repo{
+			{
+				Name:        "python",
+				CatalogTier: "APPLICATION",
+				Aliases:     []string{"docker.io/library/python"},
+				ActiveTags:  []string{"3.11", "3.11-dev", "3.12", "3.12-dev"},
+			},
+		},
+		repoName:   "cgr.dev/chainguard",
+		tagFilters: []TagFilter{TagFilterExcludeDev},
+	}
+
+	testCases := []struct {
+		name  string
+		image string
+		want  Result
+	}{
+		{
+			name:  "exact",
+			image: "python:3.12",
+			want: Result{
+				Ref:      "cgr.dev/chainguard/python:3.12",
+				TagMatch: TagMatchExact,
+			},
+		},
+		{
+			name:  "variant",
+			image: "python:3.11-slim",
+			want: Result{
+				Ref:      "cgr.dev/chainguard/python:3.11",
+				TagMatch: TagMatchApproximate,
+			},
+		},
+		{
+			name:  "closest version",
+			image: "python:3.10",
+			want: Result{
+				Ref:      "cgr.dev/chainguard/python:3.11",
+				TagMatch: TagMatchApproximate,
+			},
+		},
+		{
+			name:  "no tag",
+			image: "python",
+			want: Result{
+				Ref: "cgr.dev/chainguard/python",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := m.Map(tc.image)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(got.Results) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(got.Results))
+			}
+
+			// The repo metadata is the same, regardless of the tag
+			tc.want.Repo = "python"
+			tc.want.Tier = "APPLICATION"
+			tc.want.Aliases = []string{"docker.io/library/python"}
+			tc.want.MatchFn = "matchBasename"
+			if diff := cmp.Diff(tc.want, got.Results[0], cmpopts.IgnoreFields(Result{}, "Score")); diff != "" {
+				t.Errorf("result mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
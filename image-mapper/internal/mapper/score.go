@@ -0,0 +1,81 @@
+package mapper
+
+import (
+	"slices"
+	"strings"
+)
+
+// ScorePolicy configures how the results of a mapping are ranked. The result
+// with the highest score is returned first.
+type ScorePolicy struct {
+	// PreferFIPS ranks FIPS repos above their non-FIPS equivalents.
+	// Otherwise, non-FIPS repos are preferred.
+	PreferFIPS bool
+
+	// PreferTiers ranks repos in these tiers above repos in other tiers.
+	// Tiers earlier in the list are ranked higher.
+	PreferTiers []string
+}
+
+// matchFnScores scores results by the MatchFn that matched them. A repo that
+// shares its basename with the upstream image is the most likely to be
+// the right match, followed by repos that explicitly list the image as an
+// alias.
+var matchFnScores = map[string]int{
+	"matchBasename":   100,
+	"matchAliases":    80,
+	"matchDashname":   60,
+	"matchIamguarded": 40,
+}
+
+// matchTagFnScores scores results by the MatchTagFn that matched the tag
+var matchTagFnScores = map[string]int{
+	"matchEqualTag":                  20,
+	"matchVariantTag":                15,
+	"matchClosestSemanticVersionTag": 10,
+}
+
+const (
+	// fipsScore is added to repos that match the FIPS preference and
+	// subtracted from those that don't
+	fipsScore = 15
+
+	// tierScore is multiplied by the position of the repo's tier in the
+	// preferred tiers, counting from the end
+	tierScore = 5
+)
+
+// score scores a result. Higher is better.
+func (p ScorePolicy) score(repo Repo, matchFn MatchFn, matchTagFn MatchTagFn) int {
+	score := matchFnScores[funcName(matchFn)] + matchTagFnScores[funcName(matchTagFn)]
+
+	if isFIPS(repo) == p.PreferFIPS {
+		score += fipsScore
+	} else {
+		score -= fipsScore
+	}
+
+	if i := slices.IndexFunc(p.PreferTiers, func(tier string) bool {
+		return strings.EqualFold(tier, repo.CatalogTier)
+	}); i != -1 {
+		score += tierScore * (len(p.PreferTiers) - i)
+	}
+
+	return score
+}
+
+// isFIPS returns true if the repo is a FIPS image
+func isFIPS(repo Repo) bool {
+	return strings.EqualFold(repo.CatalogTier, "FIPS") || strings.HasSuffix(repo.Name, "-fips")
+}
+
+// rankResults sorts the results by score, highest first. Results with equal
+// scores are sorted lexically.
+func rankResults(results []Result) {
+	slices.SortFunc(results, func(a, b Result) int {
+		if a.Score != b.Score {
+			return b.Score - a.Score
+		}
+		return strings.Compare(a.Ref, b.Ref)
+	})
+}
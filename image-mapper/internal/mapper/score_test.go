@@ -0,0 +1,135 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMapperMapRanking(t *testing.T) {
+	repos := []Repo{
+		{
+			Name:        "foo",
+			CatalogTier: "APPLICATION",
+			ActiveTags:  []string{"1.2.3", "1.2.4"},
+		},
+		{
+			Name:        "foo-fips",
+			CatalogTier: "FIPS",
+			ActiveTags:  []string{"1.2.3"},
+		},
+		{
+			Name:        "foo-iamguarded",
+			CatalogTier: "APPLICATION",
+			ActiveTags:  []string{"1.2.3"},
+		},
+		{
+			Name:        "bar-foo",
+			CatalogTier: "PREMIUM",
+			Aliases:     []string{"example.com/foo"},
+			ActiveTags:  []string{"1.2.3"},
+		},
+	}
+
+	// The tiers of the results, and the MatchFns that matched them, are the
+	// same regardless of the policy
+	result := func(repo, tier, matchFn string, score int, aliases ...string) Result {
+		return Result{
+			Ref:      "cgr.dev/chainguard/" + repo + ":1.2.3",
+			Repo:     repo,
+			Tier:     tier,
+			Aliases:  aliases,
+			MatchFn:  matchFn,
+			TagMatch: TagMatchExact,
+			Score:    score,
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		policy ScorePolicy
+		want   *Mapping
+	}{
+		{
+			name: "default policy",
+			want: &Mapping{
+				Image: "example.com/foo:1.2.3",
+				Results: []Result{
+					result("foo", "APPLICATION", "matchBasename", 135),
+					result("bar-foo", "PREMIUM", "matchAliases", 115, "example.com/foo"),
+					result("foo-fips", "FIPS", "matchBasename", 105),
+					result("foo-iamguarded", "APPLICATION", "matchIamguarded", 75),
+				},
+			},
+		},
+		{
+			name: "prefer fips",
+			policy: ScorePolicy{
+				PreferFIPS: true,
+			},
+			want: &Mapping{
+				Image: "example.com/foo:1.2.3",
+				Results: []Result{
+					result("foo-fips", "FIPS", "matchBasename", 135),
+					result("foo", "APPLICATION", "matchBasename", 105),
+					result("bar-foo", "PREMIUM", "matchAliases", 85, "example.com/foo"),
+					result("foo-iamguarded", "APPLICATION", "matchIamguarded", 45),
+				},
+			},
+		},
+		{
+			name: "prefer tiers",
+			policy: ScorePolicy{
+				PreferTiers: []string{"premium", "application"},
+			},
+			want: &Mapping{
+				Image: "example.com/foo:1.2.3",
+				Results: []Result{
+					result("foo", "APPLICATION", "matchBasename", 140),
+					result("bar-foo", "PREMIUM", "matchAliases", 125, "example.com/foo"),
+					result("foo-fips", "FIPS", "matchBasename", 105),
+					result("foo-iamguarded", "APPLICATION", "matchIamguarded", 80),
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &mapper{
+				repos:    repos,
+				repoName: "cgr.dev/chainguard",
+				policy:   tc.policy,
+			}
+
+			got, err := m.Map("example.com/foo:1.2.3")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mapping mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMapImagePrefersBasename(t *testing.T) {
+	m := &mapper{
+		repos: []Repo{
+			{Name: "foo-fips", CatalogTier: "FIPS"},
+			{Name: "foo-iamguarded", CatalogTier: "APPLICATION"},
+			{Name: "foo", CatalogTier: "APPLICATION"},
+		},
+		repoName: "cgr.dev/chainguard",
+	}
+
+	got, err := MapImage(m, "foo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got.String() != "cgr.dev/chainguard/foo" {
+		t.Errorf("expected cgr.dev/chainguard/foo, got %s", got)
+	}
+}
@@ -0,0 +1,152 @@
+package mapper
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// TagVariants maps the suffixes of upstream tags, i.e the slim in 3.11-slim,
+// to the suffix of the equivalent Chainguard tags. An empty suffix maps to the
+// standard tags, i.e 3.11.
+//
+// Suffixes are matched without any trailing version, so alpine also matches
+// alpine3.20. Tags with several suffixes, like 3.11-slim-bookworm, must have an
+// entry for each of them.
+type TagVariants map[string]string
+
+// DefaultTagVariants are the suffixes understood by default.
+//
+// Distro and libc variants map to the standard tags, because Chainguard images
+// are built on Wolfi regardless. Variants for building software map to the
+// -dev tags, which include a shell and package manager.
+var DefaultTagVariants = TagVariants{
+	// Distros
+	"alpine":   "",
+	"bookworm": "",
+	"bullseye": "",
+	"buster":   "",
+	"trixie":   "",
+	"debian":   "",
+	"focal":    "",
+	"jammy":    "",
+	"noble":    "",
+	"ubuntu":   "",
+	"ubi":      "",
+	"slim":     "",
+
+	// C libraries
+	"glibc": "",
+	"musl":  "",
+
+	// Java
+	"jdk": "dev",
+	"jre": "",
+
+	// FIPS images are separate repos, so their tags don't have a suffix.
+	// Images with the suffix are only mapped to the FIPS repos.
+	"fips": "",
+
+	// Builder images
+	"dev":     "dev",
+	"build":   "dev",
+	"builder": "dev",
+}
+
+// variantVersion matches a version at the end of a suffix, i.e the 3.20 in
+// alpine3.20
+var variantVersion = regexp.MustCompile(`[\d.]+$`)
+
+// splitVariant splits a tag into its version and suffix, i.e 3.11-slim into
+// 3.11 and slim
+func splitVariant(tag string) (string, string) {
+	version, suffix, _ := strings.Cut(tag, "-")
+
+	return version, suffix
+}
+
+// isFIPSVariant returns true if the suffix of an upstream tag is for a FIPS
+// variant, i.e 1.25-fips or 1.25-fips-alpine
+func isFIPSVariant(tag string) bool {
+	_, suffix := splitVariant(tag)
+	for _, part := range strings.Split(suffix, "-") {
+		if variantVersion.ReplaceAllString(strings.ToLower(part), "") == "fips" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// suffixes returns the suffixes of the Chainguard tags that are equivalent to
+// the upstream suffix, in order of preference. It returns false if any part of
+// the suffix isn't a known variant.
+func (v TagVariants) suffixes(suffix string) ([]string, bool) {
+	var parts []string
+	for _, part := range strings.Split(suffix, "-") {
+		cgSuffix, ok := v[variantVersion.ReplaceAllString(strings.ToLower(part), "")]
+		if !ok {
+			return nil, false
+		}
+		if cgSuffix == "" || slices.Contains(parts, cgSuffix) {
+			continue
+		}
+		parts = append(parts, cgSuffix)
+	}
+
+	// Fall back to the standard tags if there isn't an equivalent variant,
+	// i.e when the repo doesn't have -dev tags
+	if len(parts) == 0 {
+		return []string{""}, true
+	}
+
+	return []string{strings.Join(parts, "-"), ""}, true
+}
+
+// matchVariantTag returns a MatchTagFn that matches variants of upstream tags,
+// like 3.11-slim or 17-jdk, to the tags of the equivalent Chainguard variant.
+// The version is matched like any other tag.
+//
+// For instance:
+//
+//	3.11-slim -> 3.11
+//	1.25-alpine3.20 -> 1.25
+//	17-jdk -> 17-dev
+func matchVariantTag(variants TagVariants) MatchTagFn {
+	if variants == nil {
+		variants = DefaultTagVariants
+	}
+
+	return func(tags []string, tag string) string {
+		version, suffix := splitVariant(tag)
+		if suffix == "" {
+			return ""
+		}
+		cgSuffixes, ok := variants.suffixes(suffix)
+		if !ok {
+			return ""
+		}
+
+		for _, cgSuffix := range cgSuffixes {
+			var candidates []string
+			for _, t := range tags {
+				if _, s := splitVariant(t); s == cgSuffix {
+					candidates = append(candidates, t)
+				}
+			}
+
+			target := version
+			if cgSuffix != "" {
+				target = version + "-" + cgSuffix
+			}
+			if match := matchEqualTag(candidates, target); match != "" {
+				return match
+			}
+			if match := matchClosestSemanticVersionTag(candidates, target); match != "" {
+				return match
+			}
+		}
+
+		return ""
+	}
+}
@@ -0,0 +1,196 @@
+package mapper
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchVariantTag(t *testing.T) {
+	tags := []string{
+		"latest",
+		"latest-dev",
+		"3.11",
+		"3.11-dev",
+		"3.12",
+		"3.12-dev",
+		"3.13",
+		"17",
+		"17-dev",
+	}
+
+	testCases := []struct {
+		name     string
+		variants TagVariants
+		tag      string
+		expected string
+	}{
+		{
+			name:     "slim",
+			tag:      "3.11-slim",
+			expected: "3.11",
+		},
+		{
+			name:     "alpine with version",
+			tag:      "3.11-alpine3.20",
+			expected: "3.11",
+		},
+		{
+			name:     "multiple suffixes",
+			tag:      "3.11-slim-bookworm",
+			expected: "3.11",
+		},
+		{
+			name:     "nearest version",
+			tag:      "3.10-slim",
+			expected: "3.11",
+		},
+		{
+			name:     "jdk",
+			tag:      "17-jdk",
+			expected: "17-dev",
+		},
+		{
+			name:     "jdk and distro",
+			tag:      "17-jdk-jammy",
+			expected: "17-dev",
+		},
+		{
+			name:     "jre",
+			tag:      "17-jre",
+			expected: "17",
+		},
+		{
+			name:     "dev",
+			tag:      "latest-dev",
+			expected: "latest-dev",
+		},
+		{
+			name:     "dev falls back to standard tags",
+			tag:      "3.13-dev",
+			expected: "3.13",
+		},
+		{
+			name:     "dev nearest version",
+			tag:      "3.10-builder",
+			expected: "3.11-dev",
+		},
+		{
+			name:     "glibc",
+			tag:      "3.12-glibc",
+			expected: "3.12",
+		},
+		{
+			name:     "unknown suffix",
+			tag:      "3.11-foo",
+			expected: "",
+		},
+		{
+			name:     "no suffix",
+			tag:      "3.11",
+			expected: "",
+		},
+		{
+			name:     "no match",
+			tag:      "18-slim",
+			expected: "",
+		},
+		{
+			name:     "custom variant",
+			variants: TagVariants{"sdk": "dev"},
+			tag:      "3.12-sdk",
+			expected: "3.12-dev",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			variants := DefaultTagVariants
+			if tc.variants != nil {
+				variants = tc.variants
+			}
+
+			got := matchVariantTag(variants)(tags, tc.tag)
+			if got != tc.expected {
+				t.Errorf("matchVariantTag(%q) = %q, expected %q", tc.tag, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMapperMapVariants(t *testing.T) {
+	src := &countingCatalogSource{
+		catalog: &Catalog{
+			Version: CatalogVersion,
+			Repos: []Repo{
+				{
+					Name:        "python",
+					CatalogTier: "APPLICATION",
+					// The -dev tags are listed first, so matching the
+					// version alone would pick them
+					ActiveTags: []string{"3.11-dev", "3.11", "3.12-dev", "3.12"},
+				},
+			},
+		},
+	}
+
+	m, err := NewMapper(t.Context(),
+		WithCatalogSource(src),
+		WithTagVariants(TagVariants{"sdk": "dev"}),
+		WithOverrides(&Overrides{Variants: TagVariants{"slim": "dev"}}),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for image, expected := range map[string]string{
+		"python:3.11-alpine": "cgr.dev/chainguard/python:3.11",
+		"python:3.11-sdk":    "cgr.dev/chainguard/python:3.11-dev",
+		"python:3.12-slim":   "cgr.dev/chainguard/python:3.12-dev",
+	} {
+		got, err := MapImage(m, image)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if got.String() != expected {
+			t.Errorf("%s: expected %s, got %s", image, expected, got)
+		}
+	}
+}
+
+func TestMapperMapFIPSVariants(t *testing.T) {
+	src := &countingCatalogSource{
+		catalog: &Catalog{
+			Version: CatalogVersion,
+			Repos: []Repo{
+				{Name: "nginx", CatalogTier: "APPLICATION", ActiveTags: []string{"1.25", "1.27"}},
+				{Name: "nginx-fips", CatalogTier: "FIPS", ActiveTags: []string{"1.25", "1.27"}},
+				{Name: "redis", CatalogTier: "APPLICATION", ActiveTags: []string{"7"}},
+			},
+		},
+	}
+
+	m, err := NewMapper(t.Context(), WithCatalogSource(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for image, expected := range map[string][]string{
+		"nginx:1.25-fips":        {"cgr.dev/chainguard/nginx-fips:1.25"},
+		"nginx:1.25-fips-alpine": {"cgr.dev/chainguard/nginx-fips:1.25"},
+		// There isn't a FIPS repo, so there aren't any results
+		"redis:7-fips": {},
+	} {
+		mapping, err := m.Map(image)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		got := []string{}
+		for _, result := range mapping.Results {
+			got = append(got, result.Ref)
+		}
+		if diff := cmp.Diff(expected, got); diff != "" {
+			t.Errorf("%s: unexpected results (-want +got):\n%s", image, diff)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package rewrite
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Options configure what happens to the rewritten files
+type Options struct {
+	// Write the changes back to the files
+	Write bool
+
+	// Diff prints a unified diff of the changes
+	Diff bool
+
+	// Check fails if any of the files would be changed
+	Check bool
+}
+
+// Fn rewrites the content of the file at path
+type Fn func(path string, input []byte) ([]byte, error)
+
+// Files rewrites each of the paths with fn. Directories are searched
+// recursively for files that match. Depending on the options, the changes are
+// written back to the files, printed as a diff to w and/or checked.
+//
+// Files found in a directory that can't be rewritten are skipped with a
+// warning, so that the rest of the directory is still processed, but they're
+// counted and reported as an error at the end.
+func Files(w io.Writer, opts Options, paths []string, match func(path string) bool, fn Fn) error {
+	var (
+		changed []string
+		failed  int
+	)
+	for _, path := range paths {
+		files, err := findFiles(path, match)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			ok, err := rewriteFile(w, opts, file, fn)
+			if err != nil {
+				// Files that were found by searching a directory
+				// might not be what we expect, so we skip over them
+				if file != path {
+					log.Printf("WARN: skipping file: %s: %s", file, err)
+					failed++
+					continue
+				}
+				return err
+			}
+			if ok {
+				changed = append(changed, file)
+			}
+		}
+	}
+
+	var errs []error
+	if opts.Check && len(changed) > 0 {
+		if !opts.Diff {
+			for _, file := range changed {
+				fmt.Fprintf(w, "%s\n", file)
+			}
+		}
+		errs = append(errs, fmt.Errorf("%d file(s) would be changed", len(changed)))
+	}
+	if failed > 0 {
+		errs = append(errs, fmt.Errorf("%d file(s) couldn't be rewritten", failed))
+	}
+
+	return errors.Join(errs...)
+}
+
+// rewriteFile rewrites the file and returns true if it changed
+func rewriteFile(w io.Writer, opts Options, path string, fn Fn) (bool, error) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("reading file: %s: %w", path, err)
+	}
+
+	output, err := fn(path, input)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if string(input) == string(output) {
+		return false, nil
+	}
+
+	if opts.Diff {
+		diff, err := unifiedDiff(path, input, output)
+		if err != nil {
+			return false, fmt.Errorf("diffing file: %s: %w", path, err)
+		}
+		if _, err := io.WriteString(w, diff); err != nil {
+			return false, fmt.Errorf("writing diff: %w", err)
+		}
+	}
+
+	if opts.Write {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, fmt.Errorf("reading file: %s: %w", path, err)
+		}
+		if err := os.WriteFile(path, output, info.Mode().Perm()); err != nil {
+			return false, fmt.Errorf("writing file: %s: %w", path, err)
+		}
+	}
+
+	return true, nil
+}
+
+// findFiles returns the path if it's a file, or the files under it that match
+// if it's a directory. Hidden directories, like .git, are skipped.
+func findFiles(path string, match func(path string) bool) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading path: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	if err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if match(p) {
+			files = append(files, p)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking directory: %s: %w", path, err)
+	}
+
+	return files, nil
+}
+
+// unifiedDiff returns a unified diff between the input and output of a file
+func unifiedDiff(path string, input, output []byte) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(input)),
+		B:        difflib.SplitLines(string(output)),
+		FromFile: filepath.ToSlash(filepath.Join("a", path)),
+		ToFile:   filepath.ToSlash(filepath.Join("b", path)),
+		Context:  3,
+	})
+}
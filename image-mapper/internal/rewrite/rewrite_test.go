@@ -0,0 +1,96 @@
+package rewrite
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFiles(t *testing.T) {
+	testCases := map[string]struct {
+		opts        Options
+		wantErr     string
+		wantContent string
+	}{
+		"check": {
+			opts:        Options{Check: true},
+			wantErr:     "1 file(s) would be changed\n1 file(s) couldn't be rewritten",
+			wantContent: "image: nginx\n",
+		},
+		"write": {
+			opts:        Options{Write: true},
+			wantErr:     "1 file(s) couldn't be rewritten",
+			wantContent: "image: cgr.dev/chainguard/nginx\n",
+		},
+		"diff": {
+			opts:        Options{Diff: true},
+			wantErr:     "1 file(s) couldn't be rewritten",
+			wantContent: "image: nginx\n",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			valid := filepath.Join(dir, "valid.yaml")
+			if err := os.WriteFile(valid, []byte("image: nginx\n"), 0o644); err != nil {
+				t.Fatalf("unexpected error writing file: %s", err)
+			}
+			if err := os.MkdirAll(filepath.Join(dir, "nested"), 0o755); err != nil {
+				t.Fatalf("unexpected error creating directory: %s", err)
+			}
+			invalid := filepath.Join(dir, "nested", "invalid.yaml")
+			if err := os.WriteFile(invalid, []byte("image: [\n"), 0o644); err != nil {
+				t.Fatalf("unexpected error writing file: %s", err)
+			}
+
+			fn := func(path string, input []byte) ([]byte, error) {
+				if path == invalid {
+					return nil, fmt.Errorf("parsing yaml")
+				}
+				return bytes.ReplaceAll(input, []byte("nginx"), []byte("cgr.dev/chainguard/nginx")), nil
+			}
+			match := func(path string) bool {
+				return strings.HasSuffix(path, ".yaml")
+			}
+
+			var out bytes.Buffer
+			err := Files(&out, tc.opts, []string{dir}, match, fn)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if err.Error() != tc.wantErr {
+				t.Errorf("unexpected error: got %q, want %q", err, tc.wantErr)
+			}
+
+			got, err := os.ReadFile(valid)
+			if err != nil {
+				t.Fatalf("unexpected error reading file: %s", err)
+			}
+			if string(got) != tc.wantContent {
+				t.Errorf("unexpected content: got %q, want %q", got, tc.wantContent)
+			}
+		})
+	}
+}
+
+func TestFilesExplicitPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "invalid.yaml")
+	if err := os.WriteFile(path, []byte("image: [\n"), 0o644); err != nil {
+		t.Fatalf("unexpected error writing file: %s", err)
+	}
+
+	fn := func(_ string, _ []byte) ([]byte, error) {
+		return nil, fmt.Errorf("parsing yaml")
+	}
+	match := func(_ string) bool { return true }
+
+	var out bytes.Buffer
+	err := Files(&out, Options{Check: true}, []string{path}, match, fn)
+	if err == nil || !strings.Contains(err.Error(), "parsing yaml") {
+		t.Errorf("expected the error for the file, got: %v", err)
+	}
+}
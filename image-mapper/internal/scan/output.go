@@ -0,0 +1,77 @@
+package scan
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+)
+
+// Output writes a report of references in a particular format
+type Output func(w io.Writer, refs []Reference) error
+
+// NewOutput returns an output in the requested format
+func NewOutput(format string) (Output, error) {
+	switch strings.ToLower(format) {
+	case "csv":
+		return outputCSV, nil
+	case "json":
+		return outputJSON, nil
+	case "markdown", "md":
+		return outputMarkdown, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s (supported: csv, json, markdown)", format)
+	}
+}
+
+func outputCSV(w io.Writer, refs []Reference) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write([]string{"file", "line", "type", "image", "mapping", "error"}); err != nil {
+		return fmt.Errorf("writing CSV header: %w", err)
+	}
+	for _, ref := range refs {
+		if err := writer.Write([]string{ref.File, strconv.Itoa(ref.Line), string(ref.Type), ref.Image, ref.Mapping, ref.Error}); err != nil {
+			return fmt.Errorf("writing CSV record: %w", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func outputJSON(w io.Writer, refs []Reference) error {
+	// Always write an array, even if nothing was found
+	if refs == nil {
+		refs = []Reference{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(refs)
+}
+
+func outputMarkdown(w io.Writer, refs []Reference) error {
+	fmt.Fprintln(w, "| File | Line | Type | Image | Chainguard Image |")
+	fmt.Fprintln(w, "| --- | --- | --- | --- | --- |")
+	for _, ref := range refs {
+		mapping := mapper.MarkdownCode(ref.Mapping)
+		if ref.Error != "" {
+			mapping = "_" + mapper.MarkdownEscape(ref.Error) + "_"
+		}
+		fmt.Fprintf(w, "| %s | %d | %s | %s | %s |\n",
+			mapper.MarkdownEscape(ref.File),
+			ref.Line,
+			ref.Type,
+			mapper.MarkdownCode(ref.Image),
+			mapping,
+		)
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutput(t *testing.T) {
+	refs := []Reference{
+		{File: "Dockerfile", Line: 1, Type: TypeDockerfile, Image: "nginx:1.25", Mapping: "cgr.dev/chainguard/nginx:1.25"},
+		{File: "values.yaml", Line: 3, Type: TypeHelmValues, Image: "unknown/image:1.0", Error: "no results found"},
+	}
+
+	testCases := map[string]string{
+		"csv": `file,line,type,image,mapping,error
+Dockerfile,1,dockerfile,nginx:1.25,cgr.dev/chainguard/nginx:1.25,
+values.yaml,3,helm-values,unknown/image:1.0,,no results found
+`,
+		"json": `[
+  {
+    "file": "Dockerfile",
+    "line": 1,
+    "type": "dockerfile",
+    "image": "nginx:1.25",
+    "mapping": "cgr.dev/chainguard/nginx:1.25"
+  },
+  {
+    "file": "values.yaml",
+    "line": 3,
+    "type": "helm-values",
+    "image": "unknown/image:1.0",
+    "error": "no results found"
+  }
+]
+`,
+		"markdown": "| File | Line | Type | Image | Chainguard Image |\n" +
+			"| --- | --- | --- | --- | --- |\n" +
+			"| Dockerfile | 1 | dockerfile | `nginx:1.25` | `cgr.dev/chainguard/nginx:1.25` |\n" +
+			"| values.yaml | 3 | helm-values | `unknown/image:1.0` | _no results found_ |\n",
+	}
+
+	for format, want := range testCases {
+		t.Run(format, func(t *testing.T) {
+			output, err := NewOutput(format)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var buf bytes.Buffer
+			if err := output(&buf, refs); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if diff := cmp.Diff(want, buf.String()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
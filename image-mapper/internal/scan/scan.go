@@ -0,0 +1,289 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/compose"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/dockerfile"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/filetype"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/k8s"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+)
+
+// Type is the type of file that an image is referenced by
+type Type string
+
+const (
+	TypeDockerfile Type = "dockerfile"
+	TypeHelmValues Type = "helm-values"
+	TypeHelmChart  Type = "helm-chart"
+	TypeCompose    Type = "compose"
+	TypeK8s        Type = "k8s"
+)
+
+// Reference is an image referenced by a file in the scanned tree, and its
+// Chainguard mapping
+type Reference struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Type  Type   `json:"type"`
+	Image string `json:"image"`
+
+	// Mapping is the Chainguard image that the image maps to
+	Mapping string `json:"mapping,omitempty"`
+
+	// Error explains why the image wasn't mapped
+	Error string `json:"error,omitempty"`
+}
+
+// Scan walks the files under dir, finds the images referenced by Dockerfiles,
+// Helm values files, Helm charts, Compose files and Kubernetes manifests and
+// maps them to Chainguard.
+//
+// Each type of file is mapped with the same mapper as its map subcommand.
+// Hidden directories, like .git, and the templates in Helm charts are skipped.
+func Scan(ctx context.Context, dir string, opts ...mapper.Option) ([]Reference, error) {
+	s := &scanner{
+		ctx:     ctx,
+		opts:    opts,
+		mappers: map[Type]mapper.Mapper{},
+	}
+
+	return s.scan(dir)
+}
+
+// scan returns the references to images in the files under dir
+func (s *scanner) scan(dir string) ([]Reference, error) {
+	var refs []Reference
+	charts := map[string]bool{}
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+
+			// Templates can't be parsed without rendering them
+			if d.Name() == "templates" && charts[filepath.Dir(path)] {
+				return filepath.SkipDir
+			}
+
+			if _, err := os.Stat(filepath.Join(path, "Chart.yaml")); err == nil {
+				charts[path] = true
+			}
+
+			return nil
+		}
+
+		typ, ok := detectType(path, inChart(dir, path, charts))
+		if !ok {
+			return nil
+		}
+
+		fileRefs, err := findReferences(path, typ)
+		if err != nil {
+			log.Printf("WARN: skipping file: %s: %s", path, err)
+			return nil
+		}
+		if err := s.mapReferences(typ, fileRefs); err != nil {
+			return err
+		}
+		refs = append(refs, fileRefs...)
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking directory: %s: %w", dir, err)
+	}
+
+	return refs, nil
+}
+
+// detectType returns the type of the file at path, or false if it isn't a type
+// of file that references images
+func detectType(path string, inChart bool) (Type, bool) {
+	switch {
+	case filetype.IsDockerfile(path):
+		return TypeDockerfile, true
+	case !filetype.IsYAML(path):
+		return "", false
+	case filetype.IsValuesFile(path):
+		if inChart {
+			return TypeHelmChart, true
+		}
+		return TypeHelmValues, true
+	case inChart:
+		// Aside from the values, the files in a chart are metadata,
+		// like Chart.yaml, or manifests that don't reference images,
+		// like CRDs
+		return "", false
+	case filetype.IsComposeFile(path):
+		return TypeCompose, true
+	default:
+		return TypeK8s, true
+	}
+}
+
+// inChart returns true if the file at path is inside one of the charts
+func inChart(root, path string, charts map[string]bool) bool {
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if charts[dir] {
+			return true
+		}
+		if dir == root || dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+// scanner maps the images in each file with a mapper for its type
+type scanner struct {
+	ctx     context.Context
+	opts    []mapper.Option
+	mappers map[Type]mapper.Mapper
+}
+
+// findReferences returns the references to images in the file at path, in
+// the order they appear
+func findReferences(path string, typ Type) ([]Reference, error) {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+
+	var refs []Reference
+	add := func(line int, image string) {
+		refs = append(refs, Reference{
+			File:  path,
+			Line:  line,
+			Type:  typ,
+			Image: image,
+		})
+	}
+
+	switch typ {
+	case TypeDockerfile:
+		images, err := dockerfile.FindImages(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range images {
+			add(img.Line, img.Image)
+		}
+
+	case TypeHelmValues, TypeHelmChart:
+		images, err := helm.FindImages(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range images {
+			add(img.Line, img.Image)
+		}
+
+	case TypeCompose:
+		env, err := compose.LoadEnv(filepath.Dir(path), "")
+		if err != nil {
+			return nil, err
+		}
+		images, unmapped, err := compose.FindImages(input, env)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range images {
+			add(img.Line, img.Image)
+		}
+		// Report the services that have an image which couldn't be
+		// mapped, like those that are built from source
+		for _, svc := range unmapped {
+			if svc.Image == "" {
+				continue
+			}
+			refs = append(refs, Reference{
+				File:  path,
+				Line:  svc.Line,
+				Type:  typ,
+				Image: svc.Image,
+				Error: svc.Reason,
+			})
+		}
+
+	case TypeK8s:
+		images, err := k8s.FindImages(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, img := range images {
+			add(img.Line, img.Image)
+		}
+	}
+
+	slices.SortStableFunc(refs, func(a, b Reference) int {
+		return a.Line - b.Line
+	})
+
+	return refs, nil
+}
+
+// mapReferences maps the images in the references with the mapper for the type
+// of file they're in
+func (s *scanner) mapReferences(typ Type, refs []Reference) error {
+	for i, ref := range refs {
+		if ref.Error != "" {
+			continue
+		}
+
+		m, err := s.mapper(typ)
+		if err != nil {
+			return err
+		}
+
+		mapped, err := mapper.MapImage(m, ref.Image)
+		if err != nil {
+			refs[i].Error = err.Error()
+			continue
+		}
+		refs[i].Mapping = mapped.String()
+	}
+
+	return nil
+}
+
+// mapper returns the mapper for the type of file, constructing it the first
+// time it's needed
+func (s *scanner) mapper(typ Type) (mapper.Mapper, error) {
+	if m, ok := s.mappers[typ]; ok {
+		return m, nil
+	}
+
+	var newMapper func(context.Context, ...mapper.Option) (mapper.Mapper, error)
+	switch typ {
+	case TypeDockerfile:
+		newMapper = dockerfile.NewMapper
+	case TypeHelmValues, TypeHelmChart:
+		newMapper = helm.NewMapper
+	case TypeCompose:
+		newMapper = compose.NewMapper
+	case TypeK8s:
+		newMapper = k8s.NewMapper
+	default:
+		return nil, fmt.Errorf("unsupported type: %s", typ)
+	}
+
+	m, err := newMapper(s.ctx, s.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+	s.mappers[typ] = m
+
+	return m, nil
+}
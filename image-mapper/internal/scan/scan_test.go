@@ -0,0 +1,104 @@
+package scan
+
+import (
+	"testing"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockMapper struct {
+	mappings map[string][]string
+}
+
+func (m *mockMapper) Map(img string) (*mapper.Mapping, error) {
+	mapping := &mapper.Mapping{
+		Image:   img,
+		Results: []mapper.Result{},
+	}
+	for _, ref := range m.mappings[img] {
+		mapping.Results = append(mapping.Results, mapper.Result{Ref: ref})
+	}
+
+	return mapping, nil
+}
+
+func TestScan(t *testing.T) {
+	m := &mockMapper{
+		mappings: map[string][]string{
+			"golang:1.23": {
+				"cgr.dev/chainguard/go:1.23",
+			},
+			"nginx:1.25": {
+				"cgr.dev/chainguard/nginx:1.25",
+			},
+			"docker.io/library/nginx:1.25": {
+				"cgr.dev/chainguard/nginx:1.25",
+			},
+			"redis:7": {
+				"cgr.dev/chainguard/redis:7",
+			},
+		},
+	}
+
+	s := &scanner{
+		mappers: map[Type]mapper.Mapper{
+			TypeDockerfile: m,
+			TypeHelmValues: m,
+			TypeHelmChart:  m,
+			TypeCompose:    m,
+			TypeK8s:        m,
+		},
+	}
+
+	refs, err := s.scan("testdata/repo")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := []Reference{
+		{File: "testdata/repo/Dockerfile", Line: 2, Type: TypeDockerfile, Image: "golang:1.23", Mapping: "cgr.dev/chainguard/go:1.23"},
+		{File: "testdata/repo/Dockerfile", Line: 5, Type: TypeDockerfile, Image: "unknown/base:1.0", Error: "no results found"},
+		{File: "testdata/repo/charts/app/values.yaml", Line: 4, Type: TypeHelmChart, Image: "docker.io/library/nginx:1.25", Mapping: "cgr.dev/chainguard/nginx:1.25"},
+		{File: "testdata/repo/deploy/deployment.yaml", Line: 10, Type: TypeK8s, Image: "nginx:1.25", Mapping: "cgr.dev/chainguard/nginx:1.25"},
+		{File: "testdata/repo/deploy/values-prod.yaml", Line: 2, Type: TypeHelmValues, Image: "redis:7", Mapping: "cgr.dev/chainguard/redis:7"},
+		{File: "testdata/repo/services/docker-compose.yaml", Line: 3, Type: TypeCompose, Image: "nginx:1.25", Mapping: "cgr.dev/chainguard/nginx:1.25"},
+		{File: "testdata/repo/services/docker-compose.yaml", Line: 4, Type: TypeCompose, Image: "example/app:latest", Error: "built from source"},
+		{File: "testdata/repo/services/docker-compose.yaml", Line: 8, Type: TypeCompose, Image: "redis:7", Mapping: "cgr.dev/chainguard/redis:7"},
+	}
+	if diff := cmp.Diff(want, refs); diff != "" {
+		t.Errorf("unexpected references (-want +got):\n%s", diff)
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	testCases := []struct {
+		path    string
+		inChart bool
+		want    Type
+	}{
+		{path: "Dockerfile", want: TypeDockerfile},
+		{path: "build/app.Dockerfile", want: TypeDockerfile},
+		{path: "Containerfile.dev", want: TypeDockerfile},
+		{path: "values.yaml", want: TypeHelmValues},
+		{path: "values-prod.yml", want: TypeHelmValues},
+		{path: "chart/values.yaml", inChart: true, want: TypeHelmChart},
+		{path: "chart/Chart.yaml", inChart: true},
+		{path: "docker-compose.yml", want: TypeCompose},
+		{path: "compose.override.yaml", want: TypeCompose},
+		{path: "deploy/deployment.yaml", want: TypeK8s},
+		{path: "README.md"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			got, ok := detectType(tc.path, tc.inChart)
+			if ok != (tc.want != "") {
+				t.Fatalf("expected ok to be %t, got %t", tc.want != "", ok)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
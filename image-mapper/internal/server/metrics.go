@@ -0,0 +1,90 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics are the metrics exposed by the server, in the Prometheus text
+// format
+type metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	images           *prometheus.CounterVec
+	catalogRefreshes *prometheus.CounterVec
+}
+
+// newMetrics returns the metrics for the server, including gauges that
+// describe its current catalog
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "image_mapper_http_requests_total",
+			Help: "The number of HTTP requests handled.",
+		}, []string{"endpoint", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "image_mapper_http_request_duration_seconds",
+			Help:    "The time spent handling HTTP requests.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		images: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "image_mapper_images_mapped_total",
+			Help: "The number of images mapped by the map endpoints.",
+		}, []string{"status"}),
+		catalogRefreshes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "image_mapper_catalog_refreshes_total",
+			Help: "The number of times the catalog was loaded.",
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.images,
+		m.catalogRefreshes,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "image_mapper_catalog_repos",
+			Help: "The number of repos in the catalog.",
+		}, func() float64 {
+			return float64(s.state.Load().repos)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "image_mapper_catalog_age_seconds",
+			Help: "The time since the catalog was loaded.",
+		}, func() float64 {
+			return s.now().Sub(s.state.Load().loadedAt).Seconds()
+		}),
+	)
+
+	return m
+}
+
+// observeRequest records a request handled by an endpoint
+func (m *metrics) observeRequest(endpoint string, status int, d time.Duration) {
+	m.requests.WithLabelValues(endpoint, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(endpoint).Observe(d.Seconds())
+}
+
+// observeMappings records the status of mapped images
+func (m *metrics) observeMappings(mappings ...*mapper.Mapping) {
+	for _, mapping := range mappings {
+		m.images.WithLabelValues(string(mapping.Status())).Inc()
+	}
+}
+
+// observeRefresh records the result of loading the catalog
+func (m *metrics) observeRefresh(result string) {
+	m.catalogRefreshes.WithLabelValues(result).Inc()
+}
+
+// handler returns the handler that writes the metrics
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
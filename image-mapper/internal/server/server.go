@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/dockerfile"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/helm"
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+)
+
+// maxBodySize is the largest request body that is accepted
+const maxBodySize = 10 << 20
+
+// Server exposes the mapper as an HTTP API. The catalog is loaded once and
+// shared by every request until it's refreshed.
+type Server struct {
+	src     mapper.CatalogSource
+	opts    []mapper.Option
+	state   atomic.Pointer[state]
+	metrics *metrics
+	now     func() time.Time
+}
+
+// state is the catalog that requests are currently mapped against
+type state struct {
+	// mapper maps the images in map requests
+	mapper mapper.Mapper
+
+	// dockerfileMapper maps the images in Dockerfile requests
+	dockerfileMapper mapper.Mapper
+
+	// helmMapper maps the images in Helm values requests
+	helmMapper mapper.Mapper
+
+	// repos is the number of repos in the catalog
+	repos int
+
+	// generatedAt is when the catalog was generated
+	generatedAt time.Time
+
+	// loadedAt is when the catalog was loaded by the server
+	loadedAt time.Time
+}
+
+// New returns a server that maps images against the catalog loaded from src,
+// with the provided options. The catalog is loaded before it returns.
+func New(ctx context.Context, src mapper.CatalogSource, opts ...mapper.Option) (*Server, error) {
+	s := &Server{
+		src:  src,
+		opts: opts,
+		now:  time.Now,
+	}
+	s.metrics = newMetrics(s)
+	if err := s.Refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Refresh reloads the catalog. Requests continue to be mapped against the
+// previous catalog until the new one has loaded, and if it fails to load.
+func (s *Server) Refresh(ctx context.Context) error {
+	st, err := s.load(ctx)
+	if err != nil {
+		s.metrics.observeRefresh("error")
+		return fmt.Errorf("loading catalog: %w", err)
+	}
+	s.state.Store(st)
+	s.metrics.observeRefresh("success")
+
+	return nil
+}
+
+// load loads the catalog and constructs the mappers for it
+func (s *Server) load(ctx context.Context) (*state, error) {
+	catalog := mapper.NewMemoryCatalogSource(s.src)
+	c, err := catalog.Load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Helm values are mapped against inactive tags, so load them now
+	// rather than on the first request
+	if _, err := catalog.Load(ctx, true); err != nil {
+		return nil, err
+	}
+
+	opts := append(slices.Clone(s.opts), mapper.WithCatalogSource(catalog))
+	m, err := mapper.NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing mapper: %w", err)
+	}
+	dm, err := dockerfile.NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing dockerfile mapper: %w", err)
+	}
+	hm, err := helm.NewMapper(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("constructing helm mapper: %w", err)
+	}
+
+	return &state{
+		mapper:           m,
+		dockerfileMapper: dm,
+		helmMapper:       hm,
+		repos:            len(c.Repos),
+		generatedAt:      c.GeneratedAt,
+		loadedAt:         s.now(),
+	}, nil
+}
+
+// RefreshEvery refreshes the catalog at the interval, until the context is
+// cancelled. Failed refreshes are logged and retried at the next interval.
+func (s *Server) RefreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				log.Printf("WARN: refreshing catalog: %s", err)
+			}
+		}
+	}
+}
+
+// Handler returns the handler for the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /v1/map", s.instrument("map", s.handleMap))
+	mux.Handle("POST /v1/map", s.instrument("map_batch", s.handleMapBatch))
+	mux.Handle("POST /v1/map/dockerfile", s.instrument("map_dockerfile", s.handleMapDockerfile))
+	mux.Handle("POST /v1/map/helm-values", s.instrument("map_helm_values", s.handleMapHelmValues))
+	mux.Handle("GET /healthz", s.instrument("healthz", s.handleHealth))
+	mux.Handle("GET /metrics", s.instrument("metrics", s.metrics.handler().ServeHTTP))
+
+	return mux
+}
+
+// handleMap maps the image in the image query parameter
+func (s *Server) handleMap(w http.ResponseWriter, r *http.Request) {
+	image := r.URL.Query().Get("image")
+	if image == "" {
+		writeError(w, http.StatusBadRequest, errors.New("missing image query parameter"))
+		return
+	}
+
+	mapping, err := s.state.Load().mapper.Map(image)
+	if err != nil {
+		writeError(w, mapErrorStatus(err), fmt.Errorf("mapping image: %w", err))
+		return
+	}
+	s.metrics.observeMappings(mapping)
+
+	writeJSON(w, mapping)
+}
+
+// mapBatchRequest is the body of a batch map request
+type mapBatchRequest struct {
+	Images []string `json:"images"`
+}
+
+// handleMapBatch maps the images in the body
+func (s *Server) handleMapBatch(w http.ResponseWriter, r *http.Request) {
+	var req mapBatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decoding request: %w", err))
+		return
+	}
+	if len(req.Images) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no images in request"))
+		return
+	}
+
+	mappings, err := mapper.MapAll(s.state.Load().mapper, mapper.NewArgsIterator(req.Images), 0)
+	if err != nil {
+		writeError(w, mapErrorStatus(err), fmt.Errorf("mapping images: %w", err))
+		return
+	}
+	s.metrics.observeMappings(mappings...)
+
+	writeJSON(w, mappings)
+}
+
+// handleMapDockerfile maps the images in the Dockerfile in the body and
+// returns the mapped Dockerfile
+func (s *Server) handleMapDockerfile(w http.ResponseWriter, r *http.Request) {
+	input, err := readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	output, err := dockerfile.Rewrite(s.state.Load().dockerfileMapper, input, nil)
+	if err != nil {
+		writeError(w, mapErrorStatus(err), fmt.Errorf("mapping dockerfile: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	writeBody(w, output)
+}
+
+// handleMapHelmValues maps the images in the Helm values in the body and
+// returns the rewritten values
+func (s *Server) handleMapHelmValues(w http.ResponseWriter, r *http.Request) {
+	input, err := readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	output, err := helm.RewriteValues(s.state.Load().helmMapper, input)
+	if err != nil {
+		writeError(w, mapErrorStatus(err), fmt.Errorf("mapping values: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/yaml")
+	writeBody(w, output)
+}
+
+// health is the body of a health check response
+type health struct {
+	Status             string    `json:"status"`
+	Repos              int       `json:"repos"`
+	CatalogGeneratedAt time.Time `json:"catalogGeneratedAt"`
+	CatalogLoadedAt    time.Time `json:"catalogLoadedAt"`
+}
+
+// handleHealth reports that the server is up, and the catalog it's using
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	st := s.state.Load()
+
+	writeJSON(w, health{
+		Status:             "ok",
+		Repos:              st.repos,
+		CatalogGeneratedAt: st.generatedAt,
+		CatalogLoadedAt:    st.loadedAt,
+	})
+}
+
+// instrument records the requests handled by the handler
+func (s *Server) instrument(endpoint string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := s.now()
+		h(rw, r)
+		s.metrics.observeRequest(endpoint, rw.status, s.now().Sub(start))
+	})
+}
+
+// statusWriter records the status code written to the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// mapErrorStatus returns the status code for an error mapping images. Failing
+// to resolve digests from the registry isn't the fault of the client.
+func mapErrorStatus(err error) int {
+	if errors.Is(err, mapper.ErrResolveDigest) {
+		return http.StatusBadGateway
+	}
+
+	return http.StatusBadRequest
+}
+
+// readBody reads the request body, up to maxBodySize
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	input, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("reading request: %w", err)
+	}
+	if len(input) == 0 {
+		return nil, errors.New("empty request body")
+	}
+
+	return input, nil
+}
+
+// writeJSON writes v as the JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("WARN: writing response: %s", err)
+	}
+}
+
+// writeBody writes the body of the response
+func writeBody(w http.ResponseWriter, body []byte) {
+	if _, err := w.Write(body); err != nil {
+		log.Printf("WARN: writing response: %s", err)
+	}
+}
+
+// writeError writes the error as a JSON response with the status code
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{
+		Error: err.Error(),
+	})
+}
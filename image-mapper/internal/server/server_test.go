@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chainguard-dev/customer-success/scripts/image-mapper/internal/mapper"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+)
+
+// testCatalogSource returns the repos, or err if it's set
+type testCatalogSource struct {
+	repos []mapper.Repo
+	err   error
+	loads int
+}
+
+func (s *testCatalogSource) Load(_ context.Context, inactiveTags bool) (*mapper.Catalog, error) {
+	s.loads++
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	return &mapper.Catalog{
+		Version:      mapper.CatalogVersion,
+		GeneratedAt:  time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		InactiveTags: inactiveTags,
+		Repos:        s.repos,
+	}, nil
+}
+
+var testRepos = []mapper.Repo{
+	{
+		Name:        "nginx",
+		CatalogTier: "APPLICATION",
+		ActiveTags:  []string{"1.27", "1.27-dev"},
+	},
+	{
+		Name:        "go",
+		CatalogTier: "BASE",
+		Aliases:     []string{"golang"},
+		ActiveTags:  []string{"1.24", "1.24-dev"},
+	},
+}
+
+func TestServer(t *testing.T) {
+	s, err := New(t.Context(), &testCatalogSource{repos: testRepos})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "map",
+			method:     http.MethodGet,
+			path:       "/v1/map?image=nginx:1.27",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"image":"nginx:1.27","results":[{"ref":"cgr.dev/chainguard/nginx:1.27","repo":"nginx","tier":"APPLICATION","matchFn":"matchBasename","tagMatch":"exact","score":135}]}` + "\n",
+		},
+		{
+			name:       "map without image",
+			method:     http.MethodGet,
+			path:       "/v1/map",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"missing image query parameter"}` + "\n",
+		},
+		{
+			name:       "map batch",
+			method:     http.MethodPost,
+			path:       "/v1/map",
+			body:       `{"images":["nginx","example.com/unknown"]}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `[{"image":"nginx","results":[{"ref":"cgr.dev/chainguard/nginx","repo":"nginx","tier":"APPLICATION","matchFn":"matchBasename","score":115}]},{"image":"example.com/unknown"}]` + "\n",
+		},
+		{
+			name:       "map batch without images",
+			method:     http.MethodPost,
+			path:       "/v1/map",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"no images in request"}` + "\n",
+		},
+		{
+			name:       "map dockerfile",
+			method:     http.MethodPost,
+			path:       "/v1/map/dockerfile",
+			body:       "FROM golang:1.24 AS build\nRUN go build\n",
+			wantStatus: http.StatusOK,
+			wantBody:   "FROM cgr.dev/chainguard/go:1.24-dev AS build\nRUN go build\n",
+		},
+		{
+			name:       "map helm values",
+			method:     http.MethodPost,
+			path:       "/v1/map/helm-values",
+			body:       "image:\n  repository: nginx\n  tag: \"1.27\"\n",
+			wantStatus: http.StatusOK,
+			wantBody:   "image:\n  repository: cgr.dev/chainguard/nginx\n  tag: \"1.27\"\n",
+		},
+		{
+			name:       "map helm values without body",
+			method:     http.MethodPost,
+			path:       "/v1/map/helm-values",
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":"empty request body"}` + "\n",
+		},
+		{
+			name:       "health",
+			method:     http.MethodGet,
+			path:       "/healthz",
+			wantStatus: http.StatusOK,
+			wantBody:   `{"status":"ok","repos":2,"catalogGeneratedAt":"2026-01-02T03:04:05Z","catalogLoadedAt":"` + s.state.Load().loadedAt.Format(time.RFC3339Nano) + `"}` + "\n",
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodDelete,
+			path:       "/v1/map",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Method Not Allowed\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(t.Context(), tc.method, srv.URL+tc.path, strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %d, got %d", tc.wantStatus, resp.StatusCode)
+			}
+			if diff := cmp.Diff(tc.wantBody, string(body)); diff != "" {
+				t.Errorf("unexpected body (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestServerRefresh(t *testing.T) {
+	src := &testCatalogSource{repos: testRepos[:1]}
+	s, err := New(t.Context(), src)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Both the active and inactive tags are loaded up front
+	if src.loads != 2 {
+		t.Errorf("expected the catalog to be loaded twice, got %d", src.loads)
+	}
+
+	mapGo := func() []string {
+		mapping, err := s.state.Load().mapper.Map("golang")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		return mapping.Refs()
+	}
+	if diff := cmp.Diff([]string{}, mapGo()); diff != "" {
+		t.Errorf("unexpected results before refresh (-want +got):\n%s", diff)
+	}
+
+	src.repos = testRepos
+	if err := s.Refresh(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff := cmp.Diff([]string{"cgr.dev/chainguard/go"}, mapGo()); diff != "" {
+		t.Errorf("unexpected results after refresh (-want +got):\n%s", diff)
+	}
+
+	// The previous catalog is kept if the refresh fails
+	src.err = errors.New("catalog unavailable")
+	if err := s.Refresh(t.Context()); err == nil {
+		t.Fatalf("expected error")
+	}
+	if diff := cmp.Diff([]string{"cgr.dev/chainguard/go"}, mapGo()); diff != "" {
+		t.Errorf("unexpected results after failed refresh (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewError(t *testing.T) {
+	if _, err := New(t.Context(), &testCatalogSource{err: errors.New("catalog unavailable")}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestServerDigestError(t *testing.T) {
+	// The registry doesn't have any of the mapped images, so their digests
+	// can't be resolved
+	reg := httptest.NewServer(registry.New(registry.Logger(log.New(io.Discard, "", 0))))
+	defer reg.Close()
+
+	s, err := New(
+		t.Context(),
+		&testCatalogSource{repos: testRepos},
+		mapper.WithRepository(strings.TrimPrefix(reg.URL, "http://")+"/chainguard"),
+		mapper.WithPinDigests(true),
+		mapper.WithKeychain(authn.NewMultiKeychain()),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	h := s.Handler()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/v1/map?image=nginx:1.27", nil),
+		httptest.NewRequest(http.MethodPost, "/v1/map", strings.NewReader(`{"images":["nginx:1.27"]}`)),
+		httptest.NewRequest(http.MethodPost, "/v1/map/dockerfile", strings.NewReader("FROM nginx:1.27\n")),
+		httptest.NewRequest(http.MethodPost, "/v1/map/helm-values", strings.NewReader("image:\n  repository: nginx\n  tag: \"1.27\"\n")),
+	} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadGateway {
+			t.Errorf("%s %s: expected status %d, got %d: %s", req.Method, req.URL, http.StatusBadGateway, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	s, err := New(t.Context(), &testCatalogSource{repos: testRepos})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.now = func() time.Time {
+		return s.state.Load().loadedAt.Add(time.Minute)
+	}
+	h := s.Handler()
+
+	for _, body := range []string{
+		`{"images":["nginx:1.27","example.com/unknown"]}`,
+		`not json`,
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/map", strings.NewReader(body)))
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := `# HELP image_mapper_catalog_age_seconds The time since the catalog was loaded.
+# TYPE image_mapper_catalog_age_seconds gauge
+image_mapper_catalog_age_seconds 60
+# HELP image_mapper_catalog_refreshes_total The number of times the catalog was loaded.
+# TYPE image_mapper_catalog_refreshes_total counter
+image_mapper_catalog_refreshes_total{result="success"} 1
+# HELP image_mapper_catalog_repos The number of repos in the catalog.
+# TYPE image_mapper_catalog_repos gauge
+image_mapper_catalog_repos 2
+# HELP image_mapper_http_request_duration_seconds The time spent handling HTTP requests.
+# TYPE image_mapper_http_request_duration_seconds histogram
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.005"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.01"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.025"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.05"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.1"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.25"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="0.5"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="1"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="2.5"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="5"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="10"} 2
+image_mapper_http_request_duration_seconds_bucket{endpoint="map_batch",le="+Inf"} 2
+image_mapper_http_request_duration_seconds_sum{endpoint="map_batch"} 0
+image_mapper_http_request_duration_seconds_count{endpoint="map_batch"} 2
+# HELP image_mapper_http_requests_total The number of HTTP requests handled.
+# TYPE image_mapper_http_requests_total counter
+image_mapper_http_requests_total{code="200",endpoint="map_batch"} 1
+image_mapper_http_requests_total{code="400",endpoint="map_batch"} 1
+# HELP image_mapper_images_mapped_total The number of images mapped by the map endpoints.
+# TYPE image_mapper_images_mapped_total counter
+image_mapper_images_mapped_total{status="mapped"} 1
+image_mapper_images_mapped_total{status="unmapped"} 1
+`
+	if diff := cmp.Diff(want, rec.Body.String()); diff != "" {
+		t.Errorf("unexpected metrics (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,77 @@
+package yamlhelpers
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDocuments(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "single document",
+			input: "a:\n    b: 1\n",
+			want:  "a:\n  b: 1\n",
+		},
+		{
+			name:  "multiple documents",
+			input: "a: 1\n---\n# comment\nb: 2\n",
+			want:  "a: 1\n---\n# comment\nb: 2\n",
+		},
+		{
+			name:  "leading separator",
+			input: "---\na: 1\n",
+			want:  "a: 1\n",
+		},
+		{
+			name:  "empty",
+			input: "",
+			want:  "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			docs, err := DecodeDocuments([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("unexpected error decoding: %s", err)
+			}
+			got, err := EncodeDocuments(docs)
+			if err != nil {
+				t.Fatalf("unexpected error encoding: %s", err)
+			}
+
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeDocumentsError(t *testing.T) {
+	if _, err := DecodeDocuments([]byte("a: 1\n---\nb: [\n")); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestScalarValue(t *testing.T) {
+	docs, err := DecodeDocuments([]byte("a: 1\nb:\n    c: 2\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	node := docs[0].Content[0]
+
+	if got := ScalarValue(Lookup(node, "a")); got != "1" {
+		t.Errorf("expected 1, got %q", got)
+	}
+	if got := ScalarValue(Lookup(node, "b")); got != "" {
+		t.Errorf("expected an empty string for a mapping, got %q", got)
+	}
+	if got := ScalarValue(Lookup(node, "missing")); got != "" {
+		t.Errorf("expected an empty string for a missing node, got %q", got)
+	}
+}
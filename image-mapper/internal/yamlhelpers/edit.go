@@ -0,0 +1,116 @@
+package yamlhelpers
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Edit replaces the value of a scalar node
+type Edit struct {
+	Node  *yaml.Node
+	Value string
+}
+
+// ApplyEdits replaces the values of scalar nodes in the input, which must be
+// the document (or stream of documents) the nodes were decoded from.
+//
+// Unlike marshalling the nodes, this leaves everything other than the edited
+// values exactly as it was, including comments, indentation and quoting.
+func ApplyEdits(input []byte, edits []Edit) ([]byte, error) {
+	type replacement struct {
+		start, end int
+		value      string
+	}
+
+	lineStarts := []int{0}
+	for i, b := range input {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+
+	var replacements []replacement
+	for _, edit := range edits {
+		node := edit.Node
+		if node.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: can only edit scalar nodes", node.Line)
+		}
+		if node.Line < 1 || node.Line > len(lineStarts) {
+			return nil, fmt.Errorf("line %d: out of range", node.Line)
+		}
+
+		// Columns are counted in characters, rather than bytes
+		start := lineStarts[node.Line-1]
+		for i := 1; i < node.Column && start < len(input); i++ {
+			_, size := utf8.DecodeRune(input[start:])
+			start += size
+		}
+
+		// Quoted values are replaced within the quotes, so the
+		// quoting style is preserved
+		var token string
+		switch node.Style {
+		case 0, yaml.TaggedStyle:
+			token = node.Value
+		case yaml.DoubleQuotedStyle:
+			token = `"` + node.Value + `"`
+		case yaml.SingleQuotedStyle:
+			token = `'` + node.Value + `'`
+		default:
+			return nil, fmt.Errorf("line %d: unsupported scalar style", node.Line)
+		}
+		if !bytes.HasPrefix(input[start:], []byte(token)) {
+			return nil, fmt.Errorf("line %d: value doesn't match the input: %s", node.Line, node.Value)
+		}
+		if len(token) > len(node.Value) {
+			start++
+		}
+
+		// Plain values that would be read back as something other
+		// than a string, like 1.20, are quoted so they aren't
+		// misinterpreted
+		value := edit.Value
+		if len(token) == len(node.Value) && !isPlainString(value) {
+			value = strconv.Quote(value)
+		}
+
+		replacements = append(replacements, replacement{
+			start: start,
+			end:   start + len(node.Value),
+			value: value,
+		})
+	}
+
+	// Apply the replacements from the end of the input backwards, so the
+	// offsets of the earlier replacements remain valid
+	slices.SortFunc(replacements, func(a, b replacement) int {
+		return b.start - a.start
+	})
+
+	output := slices.Clone(input)
+	for i, r := range replacements {
+		if i > 0 && r.end > replacements[i-1].start {
+			return nil, fmt.Errorf("overlapping edits at offset %d", r.start)
+		}
+		output = slices.Concat(output[:r.start], []byte(r.value), output[r.end:])
+	}
+
+	return output, nil
+}
+
+// isPlainString returns true if the value is read as a string when it is
+// written without quotes
+func isPlainString(value string) bool {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &node); err != nil || len(node.Content) == 0 {
+		return false
+	}
+	scalar := node.Content[0]
+
+	return scalar.Kind == yaml.ScalarNode && scalar.Tag == "!!str" && scalar.Value == value
+}
@@ -0,0 +1,141 @@
+package yamlhelpers
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApplyEdits(t *testing.T) {
+	input := `# A comment
+a:
+  image: nginx:1.25 # Trailing comment
+  quoted: "nginx:1.25"
+  single: 'nginx:1.25'
+  unicode: "é"   
+  list: [nginx, redis]
+  tag: 1.25
+  quotedTag: "1.25"
+---
+b:
+    image:   python
+`
+
+	want := `# A comment
+a:
+  image: cgr.dev/chainguard/nginx:1.27 # Trailing comment
+  quoted: "cgr.dev/chainguard/nginx:1.27"
+  single: 'cgr.dev/chainguard/nginx:1.27'
+  unicode: "ü"   
+  list: [cgr.dev/chainguard/nginx, redis]
+  tag: "1.20"
+  quotedTag: "1.20"
+---
+b:
+    image:   cgr.dev/chainguard/python
+`
+
+	dec := yaml.NewDecoder(strings.NewReader(input))
+	var docs []*yaml.Node
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error decoding input: %s", err)
+		}
+		docs = append(docs, doc.Content[0])
+	}
+
+	edits := []Edit{
+		{Node: Lookup(docs[0], "a", "image"), Value: "cgr.dev/chainguard/nginx:1.27"},
+		{Node: Lookup(docs[0], "a", "quoted"), Value: "cgr.dev/chainguard/nginx:1.27"},
+		{Node: Lookup(docs[0], "a", "single"), Value: "cgr.dev/chainguard/nginx:1.27"},
+		{Node: Lookup(docs[0], "a", "unicode"), Value: "ü"},
+		{Node: Lookup(docs[0], "a", "list").Content[0], Value: "cgr.dev/chainguard/nginx"},
+		{Node: Lookup(docs[0], "a", "tag"), Value: "1.20"},
+		{Node: Lookup(docs[0], "a", "quotedTag"), Value: "1.20"},
+		{Node: Lookup(docs[1], "b", "image"), Value: "cgr.dev/chainguard/python"},
+	}
+
+	got, err := ApplyEdits([]byte(input), edits)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected output (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplyEditsErrors(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		path  []string
+	}{
+		{
+			name:  "not a scalar",
+			input: "a:\n  b: c\n",
+			path:  []string{"a"},
+		},
+		{
+			name:  "block scalar",
+			input: "a: |\n  foo\n",
+			path:  []string{"a"},
+		},
+		{
+			name:  "escaped value",
+			input: "a: \"f\\u006fo\"\n",
+			path:  []string{"a"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.input), &doc); err != nil {
+				t.Fatalf("unexpected error decoding input: %s", err)
+			}
+
+			_, err := ApplyEdits([]byte(tc.input), []Edit{
+				{Node: Lookup(doc.Content[0], tc.path...), Value: "bar"},
+			})
+			if err == nil {
+				t.Error("expected error but got none")
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(`
+spec:
+  template:
+    spec:
+      containers:
+        - image: nginx
+`), &doc); err != nil {
+		t.Fatalf("unexpected error decoding input: %s", err)
+	}
+	root := doc.Content[0]
+
+	if got := Lookup(root, "spec", "template", "spec", "containers"); got == nil || got.Kind != yaml.SequenceNode {
+		t.Errorf("expected to find containers sequence, got %v", got)
+	}
+	if got := Lookup(root, "spec", "missing"); got != nil {
+		t.Errorf("expected nil for missing key, got %v", got)
+	}
+	if got := Lookup(root, "spec", "template", "spec", "containers", "image"); got != nil {
+		t.Errorf("expected nil when traversing a sequence, got %v", got)
+	}
+	if got := Lookup(root); got != root {
+		t.Errorf("expected the root node for an empty path")
+	}
+}
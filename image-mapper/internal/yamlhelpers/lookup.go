@@ -0,0 +1,36 @@
+package yamlhelpers
+
+import "gopkg.in/yaml.v3"
+
+// Lookup returns the node at the specified path in a mapping node, or nil if
+// the path doesn't exist
+func Lookup(node *yaml.Node, path ...string) *yaml.Node {
+	current := node
+	for _, key := range path {
+		if current == nil || current.Kind != yaml.MappingNode {
+			return nil
+		}
+
+		var next *yaml.Node
+		for i := 0; i < len(current.Content); i += 2 {
+			if current.Content[i].Value != key {
+				continue
+			}
+			next = current.Content[i+1]
+			break
+		}
+		current = next
+	}
+
+	return current
+}
+
+// ScalarValue returns the value of a scalar node, or an empty string if the
+// node is nil or isn't a scalar
+func ScalarValue(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+
+	return node.Value
+}
@@ -0,0 +1,24 @@
+package yamlhelpers
+
+import "gopkg.in/yaml.v3"
+
+// MergeNode merges the src mapping node into the dst mapping node, like Helm
+// merges values. Maps are merged recursively and every other value in src,
+// including lists, replaces the value in dst.
+func MergeNode(dst *yaml.Node, src *yaml.Node) {
+	if dst == nil || src == nil || dst.Kind != yaml.MappingNode || src.Kind != yaml.MappingNode {
+		return
+	}
+
+	for i := 0; i < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+
+		existing := Lookup(dst, key.Value)
+		if existing != nil && existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			MergeNode(existing, value)
+			continue
+		}
+
+		AddNode([]string{key.Value}, dst, value)
+	}
+}
@@ -0,0 +1,80 @@
+package yamlhelpers
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMergeNode(t *testing.T) {
+	testCases := []struct {
+		name string
+		dst  string
+		src  string
+		want string
+	}{
+		{
+			name: "add keys",
+			dst:  "a: 1\n",
+			src:  "b: 2\n",
+			want: "a: 1\nb: 2\n",
+		},
+		{
+			name: "replace values",
+			dst:  "a: 1\nb: 2\n",
+			src:  "a: 3\n",
+			want: "a: 3\nb: 2\n",
+		},
+		{
+			name: "merge nested maps",
+			dst: `image:
+    repository: nginx
+    tag: "1.27"
+replicas: 2
+`,
+			src: `image:
+    repository: cgr.dev/chainguard/nginx
+`,
+			want: `image:
+    repository: cgr.dev/chainguard/nginx
+    tag: "1.27"
+replicas: 2
+`,
+		},
+		{
+			name: "replace lists",
+			dst:  "containers:\n    - name: a\n    - name: b\n",
+			src:  "containers:\n    - name: c\n",
+			want: "containers:\n    - name: c\n",
+		},
+		{
+			name: "replace scalar with map",
+			dst:  "image: nginx\n",
+			src:  "image:\n    repository: nginx\n",
+			want: "image:\n    repository: nginx\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var dst, src yaml.Node
+			if err := yaml.Unmarshal([]byte(tc.dst), &dst); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if err := yaml.Unmarshal([]byte(tc.src), &src); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			MergeNode(dst.Content[0], src.Content[0])
+
+			got, err := yaml.Marshal(&dst)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if diff := cmp.Diff(tc.want, string(got)); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+		})
+	}
+}